@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 
+	"titan-ipweb/internal/bandwidth"
 	"titan-ipweb/internal/config"
 	"titan-ipweb/internal/handler"
+	"titan-ipweb/internal/history"
+	"titan-ipweb/internal/reconcile"
+	"titan-ipweb/internal/renewal"
+	"titan-ipweb/internal/saga"
 	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/usage"
+	"titan-ipweb/internal/webhook"
+	"titan-ipweb/model"
 
 	"github.com/zeromicro/go-zero/core/conf"
+	"github.com/zeromicro/go-zero/core/service"
+	"github.com/zeromicro/go-zero/core/stores/redis"
 	"github.com/zeromicro/go-zero/rest"
 )
 
-var configFile = flag.String("f", "etc/api.yaml", "the config file")
+var (
+	configFile        = flag.String("f", "etc/api.yaml", "the config file")
+	rotatePasswordKey = flag.Bool("rotate-password-key", false, "re-encrypt the sub user passwords with the current key and exit")
+)
 
 func main() {
 	flag.Parse()
@@ -20,12 +34,41 @@ func main() {
 	var c config.Config
 	conf.MustLoad(*configFile, &c)
 
+	if *rotatePasswordKey {
+		rotate(c)
+		return
+	}
+
 	server := rest.MustNewServer(c.RestConf)
-	defer server.Stop()
 
 	ctx := svc.NewServiceContext(c)
 	handler.RegisterHandlers(server, ctx)
+	webhook.Subscribe(ctx)
+
+	group := service.NewServiceGroup()
+	defer group.Stop()
+
+	group.Add(server)
+	group.Add(saga.NewRetrier(ctx))
+	group.Add(reconcile.NewReconciler(ctx))
+	group.Add(renewal.NewScheduler(ctx))
+	group.Add(bandwidth.NewChecker(ctx))
+	group.Add(usage.NewWatcher(ctx))
+	group.Add(webhook.NewSender(ctx))
+	group.Add(history.NewCollector(ctx))
 
 	fmt.Printf("Starting server at %s:%d...\n", c.Host, c.Port)
-	server.Start()
+	group.Start()
+}
+
+func rotate(c config.Config) {
+	if err := model.SetPasswordKeys(c.Password.KeyID, c.Password.Keys); err != nil {
+		panic(err)
+	}
+
+	count, err := model.RotatePasswordKey(context.Background(), redis.MustNewRedis(c.Redis))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("re-encrypt %d sub user passwords with key %s\n", count, c.Password.KeyID)
 }
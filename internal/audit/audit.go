@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// actor of the mutations done by the background workers
+const ActorSystem = "system"
+
+const (
+	ActionCreateSubUser     = "create_sub_user"
+	ActionDeleteSubUser     = "delete_sub_user"
+	ActionDeprecateSubUser  = "deprecate_sub_user"
+	ActionStartSubUser      = "start_sub_user"
+	ActionStopSubUser       = "stop_sub_user"
+	ActionEditLimit         = "edit_limit"
+	ActionEditRenewalPolicy = "edit_renewal_policy"
+	ActionModifyPassword    = "modify_password"
+	ActionSwitchNode        = "switch_node"
+	ActionThrottleSubUser   = "throttle_sub_user"
+	ActionUnthrottleSubUser = "unthrottle_sub_user"
+	ActionRenewSubUser      = "renew_sub_user"
+	ActionSuspendAccount    = "suspend_account"
+	ActionResumeAccount     = "resume_account"
+	ActionReconcileQuota    = "reconcile_quota"
+	ActionCreateTeam        = "create_team"
+	ActionDeleteTeam        = "delete_team"
+	ActionInviteMember      = "invite_member"
+	ActionJoinTeam          = "join_team"
+	ActionLeaveTeam         = "leave_team"
+	ActionRemoveMember      = "remove_member"
+	ActionUpdateMemberRole  = "update_member_role"
+	ActionEditQuota         = "edit_quota"
+	ActionFreezeAccount     = "freeze_account"
+	ActionUnfreezeAccount   = "unfreeze_account"
+)
+
+var Actions = []string{
+	ActionCreateSubUser,
+	ActionDeleteSubUser,
+	ActionDeprecateSubUser,
+	ActionStartSubUser,
+	ActionStopSubUser,
+	ActionEditLimit,
+	ActionEditRenewalPolicy,
+	ActionModifyPassword,
+	ActionSwitchNode,
+	ActionThrottleSubUser,
+	ActionUnthrottleSubUser,
+	ActionRenewSubUser,
+	ActionSuspendAccount,
+	ActionResumeAccount,
+	ActionReconcileQuota,
+	ActionCreateTeam,
+	ActionDeleteTeam,
+	ActionInviteMember,
+	ActionJoinTeam,
+	ActionLeaveTeam,
+	ActionRemoveMember,
+	ActionUpdateMemberRole,
+	ActionEditQuota,
+	ActionFreezeAccount,
+	ActionUnfreezeAccount,
+}
+
+func IsValidAction(action string) bool {
+	for _, a := range Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+type Entry struct {
+	// the account the entry belong to
+	UserID      string
+	Action      string
+	SubUsername string
+	// model.SubUser, model.User or model.Membership before and after the mutation, nil means not exist
+	Before interface{}
+	After  interface{}
+	// called the IPPM server or not, IPPMErr is the result
+	IPPMCalled bool
+	IPPMErr    error
+}
+
+// Record append the entry to the audit log of the account, the actor is the
+// authenticated user of ctx or the system. the error only logged, the mutation
+// already done should not fail for the audit log
+func Record(ctx context.Context, svcCtx *svc.ServiceContext, entry *Entry) {
+	diff, err := model.AuditDiff(entry.Before, entry.After)
+	if err != nil {
+		logx.Errorf("audit diff of %s %s failed:%v", entry.Action, entry.SubUsername, err)
+	}
+
+	auditEntry := &model.AuditEntry{
+		Time:        time.Now().Unix(),
+		UserID:      entry.UserID,
+		ActorID:     ActorSystem,
+		ClientIP:    middleware.ClientIP(ctx),
+		Action:      entry.Action,
+		SubUsername: entry.SubUsername,
+		Diff:        model.MarshalAuditDiff(diff),
+	}
+
+	if authValue, ok := ctx.Value(middleware.AuthKey).(middleware.AuthCtxValue); ok {
+		auditEntry.ActorID = authValue.UserId
+		auditEntry.ActorEmail = authValue.Email
+	}
+
+	if entry.IPPMCalled {
+		auditEntry.IPPMResult = "success"
+		if entry.IPPMErr != nil {
+			auditEntry.IPPMResult = entry.IPPMErr.Error()
+		}
+	}
+
+	retention := svcCtx.Config.Audit.Retention * 24 * 60 * 60
+	if _, err := model.AddAuditEntry(context.WithoutCancel(ctx), svcCtx.Redis, auditEntry, retention, svcCtx.Config.Audit.MaxLen); err != nil {
+		logx.Errorf("add audit entry %s %s for user %s failed:%v", entry.Action, entry.SubUsername, entry.UserID, err)
+	}
+}
+
+// RecordStatus record the status of the sub user changed by the background workers
+func RecordStatus(ctx context.Context, svcCtx *svc.ServiceContext, subUser *model.SubUser, status, reason string) {
+	action := ActionStopSubUser
+	if status == constant.SubUserStatusActive {
+		action = ActionStartSubUser
+	}
+
+	after := *subUser
+	after.Status = status
+	after.StatusReason = reason
+	Record(ctx, svcCtx, &Entry{
+		UserID:      subUser.UserID,
+		Action:      action,
+		SubUsername: subUser.Username,
+		Before:      subUser,
+		After:       &after,
+		IPPMCalled:  true,
+	})
+}
+
+// RecordSuspended record the account suspended or resumed by the background workers
+func RecordSuspended(ctx context.Context, svcCtx *svc.ServiceContext, user *model.User, suspended bool) {
+	action := ActionResumeAccount
+	if suspended {
+		action = ActionSuspendAccount
+	}
+
+	after := *user
+	after.Suspended = suspended
+	Record(ctx, svcCtx, &Entry{
+		UserID: user.UUID,
+		Action: action,
+		Before: user,
+		After:  &after,
+	})
+}
@@ -0,0 +1,263 @@
+package bandwidth
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	lockKey = "titan:ipweb:lock:bandwidth"
+	workers = 16
+
+	ActionStop     = "stop"
+	ActionThrottle = "throttle"
+)
+
+// Checker compare the current bandwidth of sub users with their MaxBandwidthLimit,
+// stop or throttle the sub users exceed the limit
+type Checker struct {
+	svcCtx    *svc.ServiceContext
+	interval  time.Duration
+	action    string
+	tolerance int64
+	done      chan struct{}
+}
+
+func NewChecker(svcCtx *svc.ServiceContext) *Checker {
+	return &Checker{
+		svcCtx:    svcCtx,
+		interval:  time.Duration(svcCtx.Config.Bandwidth.Interval) * time.Second,
+		action:    svcCtx.Config.Bandwidth.Action,
+		tolerance: svcCtx.Config.Bandwidth.Tolerance,
+		done:      make(chan struct{}),
+	}
+}
+
+func (c *Checker) Start() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.check()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Checker) Stop() {
+	close(c.done)
+}
+
+func (c *Checker) check() {
+	lock := redis.NewRedisLock(c.svcCtx.Redis, lockKey)
+	lock.SetExpire(int(c.interval.Seconds()))
+
+	ok, err := lock.Acquire()
+	if err != nil {
+		logx.Errorf("acquire bandwidth lock failed:%v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.keepLock(ctx, cancel, lock)
+		close(stopped)
+	}()
+	// stop extending before the release, or the lock would be taken again
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	subUsers, err := model.GetAllSubUsers(ctx, c.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all sub users failed:%v", err)
+		return
+	}
+
+	checking := make([]*model.SubUser, 0, len(subUsers))
+	usernames := make([]string, 0, len(subUsers))
+	for _, subUser := range subUsers {
+		// the throttled one is checked to restore
+		if subUser.Status != constant.SubUserStatusActive || (subUser.MaxBandwidthLimit <= 0 && !subUser.Throttled) {
+			continue
+		}
+		checking = append(checking, subUser)
+		usernames = append(usernames, subUser.Username)
+	}
+
+	result := c.svcCtx.Stats.BaseStats(ctx, usernames)
+	if ctx.Err() != nil {
+		return
+	}
+
+	mr.ForEach(func(source chan<- *model.SubUser) {
+		for _, subUser := range checking {
+			source <- subUser
+		}
+	}, func(subUser *model.SubUser) {
+		stats, ok := result.Stats[subUser.Username]
+		if !ok {
+			logx.Errorf("check bandwidth of sub user %s failed:%s", subUser.Username, result.Failed[subUser.Username])
+			return
+		}
+		if err := c.checkSubUser(ctx, subUser, stats); err != nil {
+			logx.Errorf("check bandwidth of sub user %s failed:%v", subUser.Username, err)
+		}
+	}, mr.WithWorkers(workers))
+}
+
+// keepLock extend the lock before it expire, cancel the sweep if the lock lost
+func (c *Checker) keepLock(ctx context.Context, cancel context.CancelFunc, lock *redis.RedisLock) {
+	ticker := time.NewTicker(c.interval / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// acquire again by the owner only reset the expire
+			ok, err := lock.Acquire()
+			if err != nil || !ok {
+				logx.Errorf("extend bandwidth lock failed, stop the check:%v", err)
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Checker) checkSubUser(ctx context.Context, subUser *model.SubUser, stats *ippmclient.UserBaseStatsResp) error {
+	if subUser.Throttled {
+		// the throttled bandwidth stay around the limit, restore after it drop below the tolerance
+		if subUser.MaxBandwidthLimit <= 0 || stats.CurrentBandwidth < subUser.MaxBandwidthLimit-subUser.MaxBandwidthLimit*c.tolerance/100 {
+			return c.restore(ctx, subUser)
+		}
+		return nil
+	}
+
+	limit := subUser.MaxBandwidthLimit + subUser.MaxBandwidthLimit*c.tolerance/100
+	if stats.CurrentBandwidth <= limit {
+		return nil
+	}
+
+	logx.Infof("sub user %s bandwidth %d exceed limit %d, %s it", subUser.Username, stats.CurrentBandwidth, subUser.MaxBandwidthLimit, c.action)
+	if c.action == ActionThrottle {
+		return c.throttle(ctx, subUser)
+	}
+
+	err := c.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "stop"})
+	if err != nil {
+		return err
+	}
+	if err := model.SetSubUserStatus(c.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonBandwidthExceeded); err != nil {
+		return err
+	}
+	audit.RecordStatus(ctx, c.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonBandwidthExceeded)
+
+	c.svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:        event.TypeSubUserStopped,
+		UserID:      subUser.UserID,
+		SubUsername: subUser.Username,
+		Used:        stats.CurrentBandwidth,
+		Limit:       subUser.MaxBandwidthLimit,
+		Reason:      constant.StatusReasonBandwidthExceeded,
+	})
+	return nil
+}
+
+// throttle split the bandwidth limit to upload and download rate limit,
+// the configured rate limit is kept to restore
+func (c *Checker) throttle(ctx context.Context, subUser *model.SubUser) error {
+	half := subUser.MaxBandwidthLimit / 2
+	upload := throttleRate(subUser.UploadRateLimit, half)
+	download := throttleRate(subUser.DownloadRateLimit, half)
+	if upload == subUser.UploadRateLimit && download == subUser.DownloadRateLimit {
+		// the configured rate limit is low enough, it is not effective yet
+		return nil
+	}
+
+	err := c.svcCtx.IPPMClient.ModifyUser(ctx, &ippmclient.ModifyUserReq{
+		UserName:          subUser.Username,
+		UploadRateLimit:   &upload,
+		DownloadRateLimit: &download,
+	})
+	if err != nil {
+		return err
+	}
+	if err := model.SetSubUserThrottled(c.svcCtx.Redis, subUser.Username, upload, download); err != nil {
+		return err
+	}
+
+	after := *subUser
+	after.Throttled = true
+	after.ThrottledUploadRateLimit = upload
+	after.ThrottledDownloadRateLimit = download
+	audit.Record(ctx, c.svcCtx, &audit.Entry{
+		UserID:      subUser.UserID,
+		Action:      audit.ActionThrottleSubUser,
+		SubUsername: subUser.Username,
+		Before:      subUser,
+		After:       &after,
+		IPPMCalled:  true,
+	})
+	return nil
+}
+
+// restore the configured rate limit of the throttled sub user
+func (c *Checker) restore(ctx context.Context, subUser *model.SubUser) error {
+	logx.Infof("sub user %s bandwidth drop, restore its rate limit", subUser.Username)
+	err := c.svcCtx.IPPMClient.ModifyUser(ctx, &ippmclient.ModifyUserReq{
+		UserName:          subUser.Username,
+		UploadRateLimit:   &subUser.UploadRateLimit,
+		DownloadRateLimit: &subUser.DownloadRateLimit,
+	})
+	if err != nil {
+		return err
+	}
+	if err := model.ClearSubUserThrottled(c.svcCtx.Redis, subUser.Username); err != nil {
+		return err
+	}
+
+	after := *subUser
+	after.Throttled = false
+	after.ThrottledUploadRateLimit = 0
+	after.ThrottledDownloadRateLimit = 0
+	audit.Record(ctx, c.svcCtx, &audit.Entry{
+		UserID:      subUser.UserID,
+		Action:      audit.ActionUnthrottleSubUser,
+		SubUsername: subUser.Username,
+		Before:      subUser,
+		After:       &after,
+		IPPMCalled:  true,
+	})
+	return nil
+}
+
+// 0 rate limit means unlimit
+func throttleRate(rate, max int64) int64 {
+	if rate == 0 || rate > max {
+		return max
+	}
+	return rate
+}
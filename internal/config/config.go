@@ -14,6 +14,21 @@ type Config struct {
 	// IP pop manager server
 	IPPMServer IPPMServer
 	Quota      Quota
+	Saga       Saga
+	Reconcile  Reconcile
+	Renewal    Renewal
+	SwitchNode SwitchNode
+	Password   Password
+	Bandwidth  Bandwidth
+	Usage      Usage
+	Webhook    Webhook
+	Audit      Audit
+	APIKey     APIKey
+	Team       Team
+	Batch      Batch
+	Stats      Stats
+	History    History
+	Admin      Admin
 	RunMode    string `json:",default=prod"` // dev / test / prod
 }
 
@@ -25,9 +40,129 @@ type TokenAuth struct {
 type Quota struct {
 	MaxBandwidthLimit int64
 	TotalTrafficLimit int64
+	// ceiling of the rate limit of each sub user, 0 means no ceiling
+	MaxUploadRateLimit   int64 `json:",optional"`
+	MaxDownloadRateLimit int64 `json:",optional"`
 }
 
 type IPPMServer struct {
 	URL          string
 	AccessSecret string
+	// request timeout, unit millisecond
+	Timeout int64 `json:",default=10000"`
+}
+
+type Saga struct {
+	// interval of retrying the pending operations, unit second
+	RetryInterval int64 `json:",default=60"`
+	// operations pending longer than timeout are finished or undone, unit second
+	Timeout int64 `json:",default=300"`
+}
+
+type Reconcile struct {
+	// interval of comparing local sub users with the IPPM server, unit second
+	Interval int64 `json:",default=3600"`
+	// repair the drift found by the periodic reconcile
+	Repair bool `json:",default=false"`
+}
+
+type Renewal struct {
+	// interval of checking the traffic period of sub users, unit second
+	Interval int64 `json:",default=300"`
+}
+
+type SwitchNode struct {
+	// each sub user can switch node Quota times in Period seconds
+	Period int `json:",default=60"`
+	Quota  int `json:",default=3"`
+}
+
+type Password struct {
+	// store the sub user password, if false the password only return once at creation and rotation
+	Store bool `json:",default=true"`
+	// length of the generated password
+	Length int `json:",default=16"`
+	// id of the key to encrypt the stored password, empty means plaintext
+	KeyID string `json:",optional"`
+	// key id to base64 of 32 bytes AES key, keep the old keys until rotation done
+	Keys map[string]string `json:",optional"`
+}
+
+type Bandwidth struct {
+	// interval of checking the bandwidth of sub users, unit second
+	Interval int64 `json:",default=60"`
+	// stop or throttle the sub user exceed MaxBandwidthLimit
+	Action string `json:",default=stop,options=stop|throttle"`
+	// percent allowed to exceed the limit
+	Tolerance int64 `json:",default=10"`
+}
+
+type Usage struct {
+	// interval of checking the traffic used of sub users, unit second
+	Interval int64 `json:",default=300"`
+	// percent of traffic used to notify, default 80 and 100
+	Thresholds []int64 `json:",optional"`
+}
+
+type Webhook struct {
+	// max webhooks of each user
+	MaxPerUser int `json:",default=10"`
+	// attempts before the delivery failed
+	MaxAttempts int64 `json:",default=8"`
+	// the first retry delay, doubled for each attempt, unit second
+	RetryBase int64 `json:",default=30"`
+	// request timeout, unit millisecond
+	Timeout int64 `json:",default=5000"`
+}
+
+type Audit struct {
+	// days to keep the audit log
+	Retention int64 `json:",default=90"`
+	// max entries of each account
+	MaxLen int64 `json:",default=10000"`
+}
+
+type APIKey struct {
+	// max api keys of each user
+	MaxPerUser int `json:",default=10"`
+}
+
+type Team struct {
+	// max members of each team, include the pending invitations
+	MaxMembers int `json:",default=20"`
+	// the invitation expire after, unit second
+	InviteExpire int64 `json:",default=604800"`
+}
+
+type Batch struct {
+	// max sub users created in one batch
+	MaxCount int `json:",default=200"`
+	// concurrent calls to the IPPM server of a batch
+	Concurrency int `json:",default=10"`
+}
+
+type Admin struct {
+	// email of the administrators, they always get the admin role at login
+	Emails []string `json:",optional"`
+}
+
+type Stats struct {
+	// seconds to cache the base stats of sub users read from the IPPM server
+	CacheTTL int64 `json:",default=10"`
+	// max sub users in one batch request
+	BatchSize int `json:",default=100"`
+	// concurrent batch requests of one fetch
+	Workers int `json:",default=4"`
+}
+
+type History struct {
+	// interval of collecting the stats of sub users into the local history, unit second
+	Interval int64 `json:",default=300"`
+	// concurrent requests to the IPPM server
+	Workers int `json:",default=10"`
+	// seconds to keep the 5 minutes, hourly and daily points,
+	// also the history pulled from the IPPM server at the first collection of a sub user
+	MinuteRetention int64 `json:",default=604800"`
+	HourRetention   int64 `json:",default=7776000"`
+	DayRetention    int64 `json:",default=63072000"`
 }
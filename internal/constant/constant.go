@@ -1,9 +1,29 @@
 package constant
 
 const (
+	RouteModeAuto   = 1
+	RouteModeManual = 2
+	RouteModeTimed  = 3
 	RouteModeCustom = 4
 
 	RunModeDev  = "dev"
 	RunModeTest = "test"
 	RunModeProd = "prod"
+
+	// sub users created by dev and test environment
+	TestSubUserPrefix = "test_"
+
+	SubUserStatusActive     = "active"
+	SubUserStatusStop       = "stop"
+	SubUserStatusDeprecated = "deprecated"
+
+	// reason of the sub user stopped by system
+	StatusReasonTrafficExhausted  = "traffic_exhausted"
+	StatusReasonBandwidthExceeded = "bandwidth_exceeded"
+	StatusReasonPeriodEnd         = "period_end"
+	StatusReasonAccountExhausted  = "account_exhausted"
+	StatusReasonAccountFrozen     = "account_frozen"
+	// reason of the sub user started by system
+	StatusReasonPeriodRenewed  = "period_renewed"
+	StatusReasonAccountResumed = "account_resumed"
 )
@@ -0,0 +1,118 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	TypeSubUserCreated    = "subuser.created"
+	TypeSubUserDeleted    = "subuser.deleted"
+	TypeSubUserDeprecated = "subuser.deprecated"
+	// the limit, route, password or renewal policy of sub user changed
+	TypeSubUserUpdated = "subuser.updated"
+	// the traffic used of sub user reach a threshold
+	TypeTrafficThreshold = "subuser.traffic_threshold"
+	// the sub user is stopped by the user or system
+	TypeSubUserStopped = "subuser.stopped"
+	// the sub user is started by the user or system
+	TypeSubUserStarted = "subuser.started"
+	// all sub users of the account are stopped for the purchased traffic exhausted
+	TypeAccountSuspended = "account.suspended"
+	// the account has traffic again, the sub users are restarted
+	TypeAccountResumed = "account.resumed"
+	// the account is frozen by the admin, all sub users are stopped
+	TypeAccountFrozen = "account.frozen"
+	// the account is unfrozen by the admin
+	TypeAccountUnfrozen = "account.unfrozen"
+)
+
+var Types = []string{
+	TypeSubUserCreated,
+	TypeSubUserDeleted,
+	TypeSubUserDeprecated,
+	TypeSubUserUpdated,
+	TypeTrafficThreshold,
+	TypeSubUserStopped,
+	TypeSubUserStarted,
+	TypeAccountSuspended,
+	TypeAccountResumed,
+	TypeAccountFrozen,
+	TypeAccountUnfrozen,
+}
+
+func IsValidType(t string) bool {
+	for _, v := range Types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+type Event struct {
+	Type        string `json:"type"`
+	UserID      string `json:"user_id"`
+	SubUsername string `json:"sub_username,omitempty"`
+	// percent of traffic used, for TypeTrafficThreshold
+	Threshold int64 `json:"threshold,omitempty"`
+	Used      int64 `json:"used,omitempty"`
+	Limit     int64 `json:"limit,omitempty"`
+	// why the status changed
+	Reason string `json:"reason,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+type Handler func(ctx context.Context, e *Event)
+
+// Bus dispatch the events to the handlers in process
+type Bus struct {
+	lock     sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe register the handler for the event types, all types if empty
+func (b *Bus) Subscribe(handler Handler, types ...string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if len(types) == 0 {
+		types = []string{""}
+	}
+	for _, t := range types {
+		b.handlers[t] = append(b.handlers[t], handler)
+	}
+}
+
+// Publish call the handlers synchronously, the handler should not block too long
+func (b *Bus) Publish(ctx context.Context, e *Event) {
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+
+	b.lock.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[e.Type])+len(b.handlers[""]))
+	handlers = append(handlers, b.handlers[e.Type]...)
+	handlers = append(handlers, b.handlers[""]...)
+	b.lock.RUnlock()
+
+	for _, handler := range handlers {
+		b.call(ctx, handler, e)
+	}
+}
+
+func (b *Bus) call(ctx context.Context, handler Handler, e *Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logx.Errorf("handle event %s of %s panic:%v", e.Type, e.SubUsername, r)
+		}
+	}()
+	handler(ctx, e)
+}
@@ -0,0 +1,23 @@
+package event
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	var stopped, all int
+	bus.Subscribe(func(ctx context.Context, e *Event) { stopped++ }, TypeSubUserStopped)
+	bus.Subscribe(func(ctx context.Context, e *Event) { all++ })
+	bus.Subscribe(func(ctx context.Context, e *Event) { panic("bad handler") }, TypeTrafficThreshold)
+
+	ctx := context.Background()
+	bus.Publish(ctx, &Event{Type: TypeSubUserStopped, SubUsername: "sub1"})
+	bus.Publish(ctx, &Event{Type: TypeTrafficThreshold, SubUsername: "sub1", Threshold: 80})
+
+	if stopped != 1 || all != 2 {
+		t.Fatalf("unexpected stopped %d all %d", stopped, all)
+	}
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/admin"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 修改账户的带宽与流量上限
+func EditAccountQuotaHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.EditAccountQuotaReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		l := admin.NewEditAccountQuotaLogic(r.Context(), svcCtx)
+		err := l.EditAccountQuota(&req)
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(nil))
+		}
+	}
+}
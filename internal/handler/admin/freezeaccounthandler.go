@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/admin"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 冻结或解冻账户，冻结时停止所有子用户
+func FreezeAccountHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.FreezeAccountReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		l := admin.NewFreezeAccountLogic(r.Context(), svcCtx)
+		err := l.FreezeAccount(&req)
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(nil))
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/admin"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 按序号拉取账户列表
+func ListAccountsHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ListAccountsReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		l := admin.NewListAccountsLogic(r.Context(), svcCtx)
+		resp, err := l.ListAccounts(&req)
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(resp))
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/admin"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 对比本地子用户与IPPM服务器的用户
+func ReconcileHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ReconcileReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		l := admin.NewReconcileLogic(r.Context(), svcCtx)
+		resp, err := l.Reconcile(&req)
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(resp))
+		}
+	}
+}
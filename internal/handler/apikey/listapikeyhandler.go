@@ -0,0 +1,24 @@
+package apikey
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/apikey"
+	"titan-ipweb/internal/svc"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 获取API key列表
+func ListAPIKeyHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := apikey.NewListAPIKeyLogic(r.Context(), svcCtx)
+		resp, err := l.ListAPIKey()
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(resp))
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 导出所有子账户的代理列表，格式为host:port:user:pass，包含密码，api key需要manage权限
+func ExportSubUserHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ExportSubUserReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		// the logic stream the list to w, only the error before streaming return as json
+		l := logic.NewExportSubUserLogic(r.Context(), svcCtx, w)
+		err := l.ExportSubUser(&req)
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic"
+	"titan-ipweb/internal/svc"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 获取账户流量消耗
+func GetAccountUsageHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logic.NewGetAccountUsageLogic(r.Context(), svcCtx)
+		resp, err := l.GetAccountUsage()
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(resp))
+		}
+	}
+}
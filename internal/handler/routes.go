@@ -6,7 +6,12 @@ package handler
 import (
 	"net/http"
 
+	admin "titan-ipweb/internal/handler/admin"
+	apikey "titan-ipweb/internal/handler/apikey"
+	audit "titan-ipweb/internal/handler/audit"
 	auth "titan-ipweb/internal/handler/auth"
+	team "titan-ipweb/internal/handler/team"
+	webhook "titan-ipweb/internal/handler/webhook"
 	"titan-ipweb/internal/svc"
 
 	"github.com/zeromicro/go-zero/rest"
@@ -17,6 +22,81 @@ func RegisterHandlers(server *rest.Server, serverCtx *svc.ServiceContext) {
 		rest.WithMiddlewares(
 			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth},
 			[]rest.Route{
+				{
+					// 获取账户流量消耗
+					Method:  http.MethodGet,
+					Path:    "/account-usage",
+					Handler: GetAccountUsageHandler(serverCtx),
+				},
+				{
+					// 获取子账户详情
+					Method:  http.MethodGet,
+					Path:    "/get",
+					Handler: GetSubUserHandler(serverCtx),
+				},
+				{
+					// 拉取子用户列表
+					Method:  http.MethodGet,
+					Path:    "/list",
+					Handler: ListSubUserHandler(serverCtx),
+				},
+				{
+					// 获取废弃的子用户列表
+					Method:  http.MethodGet,
+					Path:    "/list-deprecated",
+					Handler: ListDeprecatedSubUserHandler(serverCtx),
+				},
+				{
+					// 拉取pops列表
+					Method:  http.MethodGet,
+					Path:    "/pops",
+					Handler: ListPopsHandler(serverCtx),
+				},
+				{
+					// 获取子账户流量周期与续期策略
+					Method:  http.MethodGet,
+					Path:    "/renewal",
+					Handler: GetRenewalPolicyHandler(serverCtx),
+				},
+				{
+					// 获取总的配额
+					Method:  http.MethodGet,
+					Path:    "/total-quota",
+					Handler: GetTotalQuotaHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/subuser"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth, serverCtx.Owner},
+			[]rest.Route{
+				{
+					// 批量创建子用户
+					Method:  http.MethodPost,
+					Path:    "/batch/create",
+					Handler: BatchCreateSubUserHandler(serverCtx),
+				},
+				{
+					// 批量废弃子用户
+					Method:  http.MethodPost,
+					Path:    "/batch/deprecated",
+					Handler: BatchDeprecatedSubUserHandler(serverCtx),
+				},
+				{
+					// 批量编辑子账户的流量配额与带宽限制
+					Method:  http.MethodPost,
+					Path:    "/batch/edit",
+					Handler: BatchEditSubUserLimitHandler(serverCtx),
+				},
+				{
+					// 批量更新子账户状态
+					Method:  http.MethodPost,
+					Path:    "/batch/update-status",
+					Handler: BatchUpdateSubUserStatusHandler(serverCtx),
+				},
 				{
 					// 创建子用户
 					Method:  http.MethodPost,
@@ -42,28 +122,28 @@ func RegisterHandlers(server *rest.Server, serverCtx *svc.ServiceContext) {
 					Handler: EditSubUserLimitHandler(serverCtx),
 				},
 				{
-					// 拉取子用户列表
-					Method:  http.MethodGet,
-					Path:    "/list",
-					Handler: ListSubUserHandler(serverCtx),
+					// 导出所有子账户的代理列表，格式为host:port:user:pass，包含密码，api key需要manage权限
+					Method:  http.MethodPost,
+					Path:    "/export",
+					Handler: ExportSubUserHandler(serverCtx),
 				},
 				{
-					// 获取废弃的子用户列表
-					Method:  http.MethodGet,
-					Path:    "/list-deprecated",
-					Handler: ListDeprecatedSubUserHandler(serverCtx),
+					// 修改子账户密码，密码为空时随机生成
+					Method:  http.MethodPost,
+					Path:    "/password",
+					Handler: ModifySubUserPasswordHandler(serverCtx),
 				},
 				{
-					// 拉取pops列表
-					Method:  http.MethodGet,
-					Path:    "/pops",
-					Handler: ListPopsHandler(serverCtx),
+					// 修改子账户流量周期与续期策略
+					Method:  http.MethodPost,
+					Path:    "/renewal/edit",
+					Handler: EditRenewalPolicyHandler(serverCtx),
 				},
 				{
-					// 获取总的配额
-					Method:  http.MethodGet,
-					Path:    "/total-quota",
-					Handler: GetTotalQuotaHandler(serverCtx),
+					// 切换子账户出口节点
+					Method:  http.MethodPost,
+					Path:    "/switch-node",
+					Handler: SwitchNodeHandler(serverCtx),
 				},
 				{
 					// 更新子账户状态
@@ -153,4 +233,199 @@ func RegisterHandlers(server *rest.Server, serverCtx *svc.ServiceContext) {
 		),
 		rest.WithPrefix("/api/auth"),
 	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth, serverCtx.Admin},
+			[]rest.Route{
+				{
+					// 获取账户的配额
+					Method:  http.MethodGet,
+					Path:    "/account",
+					Handler: admin.GetAccountHandler(serverCtx),
+				},
+				{
+					// 冻结或解冻账户，冻结时停止所有子用户
+					Method:  http.MethodPost,
+					Path:    "/account/freeze",
+					Handler: admin.FreezeAccountHandler(serverCtx),
+				},
+				{
+					// 修改账户的带宽与流量上限
+					Method:  http.MethodPost,
+					Path:    "/account/quota",
+					Handler: admin.EditAccountQuotaHandler(serverCtx),
+				},
+				{
+					// 按序号拉取账户列表
+					Method:  http.MethodGet,
+					Path:    "/accounts",
+					Handler: admin.ListAccountsHandler(serverCtx),
+				},
+				{
+					// 对比本地子用户与IPPM服务器的用户
+					Method:  http.MethodPost,
+					Path:    "/reconcile",
+					Handler: admin.ReconcileHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/admin"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth},
+			[]rest.Route{
+				{
+					// 获取webhook投递记录
+					Method:  http.MethodGet,
+					Path:    "/deliveries",
+					Handler: webhook.ListWebhookDeliveryHandler(serverCtx),
+				},
+				{
+					// 获取webhook列表
+					Method:  http.MethodGet,
+					Path:    "/list",
+					Handler: webhook.ListWebhookHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/webhook"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth, serverCtx.Owner},
+			[]rest.Route{
+				{
+					// 注册webhook
+					Method:  http.MethodPost,
+					Path:    "/create",
+					Handler: webhook.CreateWebhookHandler(serverCtx),
+				},
+				{
+					// 删除webhook
+					Method:  http.MethodPost,
+					Path:    "/delete",
+					Handler: webhook.DeleteWebhookHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/webhook"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth},
+			[]rest.Route{
+				{
+					// 获取审计日志
+					Method:  http.MethodGet,
+					Path:    "/list",
+					Handler: audit.ListAuditHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/audit"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth},
+			[]rest.Route{
+				{
+					// 创建API key
+					Method:  http.MethodPost,
+					Path:    "/create",
+					Handler: apikey.CreateAPIKeyHandler(serverCtx),
+				},
+				{
+					// 获取API key列表
+					Method:  http.MethodGet,
+					Path:    "/list",
+					Handler: apikey.ListAPIKeyHandler(serverCtx),
+				},
+				{
+					// 撤销API key
+					Method:  http.MethodPost,
+					Path:    "/revoke",
+					Handler: apikey.RevokeAPIKeyHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/apikey"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth, serverCtx.Staff},
+			[]rest.Route{
+				{
+					// 查看任意账户，只读
+					Method:  http.MethodGet,
+					Path:    "/account",
+					Handler: InspectAccountHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/inspect"),
+	)
+
+	server.AddRoutes(
+		rest.WithMiddlewares(
+			[]rest.Middleware{serverCtx.Header, serverCtx.UserAgent, serverCtx.Auth},
+			[]rest.Route{
+				{
+					// 接受团队邀请
+					Method:  http.MethodPost,
+					Path:    "/accept",
+					Handler: team.AcceptTeamInviteHandler(serverCtx),
+				},
+				{
+					// 创建团队，团队共享创建者的配额与子用户
+					Method:  http.MethodPost,
+					Path:    "/create",
+					Handler: team.CreateTeamHandler(serverCtx),
+				},
+				{
+					// 解散团队
+					Method:  http.MethodPost,
+					Path:    "/delete",
+					Handler: team.DeleteTeamHandler(serverCtx),
+				},
+				{
+					// 获取所在团队的信息
+					Method:  http.MethodGet,
+					Path:    "/get",
+					Handler: team.GetTeamHandler(serverCtx),
+				},
+				{
+					// 邀请成员，发送验证码到被邀请的邮箱
+					Method:  http.MethodPost,
+					Path:    "/invite",
+					Handler: team.InviteTeamMemberHandler(serverCtx),
+				},
+				{
+					// 退出团队
+					Method:  http.MethodPost,
+					Path:    "/leave",
+					Handler: team.LeaveTeamHandler(serverCtx),
+				},
+				{
+					// 移除团队成员
+					Method:  http.MethodPost,
+					Path:    "/member/remove",
+					Handler: team.RemoveTeamMemberHandler(serverCtx),
+				},
+				{
+					// 修改团队成员的角色
+					Method:  http.MethodPost,
+					Path:    "/member/role",
+					Handler: team.UpdateTeamMemberHandler(serverCtx),
+				},
+			}...,
+		),
+		rest.WithPrefix("/api/team"),
+	)
 }
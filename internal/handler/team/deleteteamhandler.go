@@ -0,0 +1,24 @@
+package team
+
+import (
+	"net/http"
+
+	"titan-ipweb/internal/handler/utils"
+	"titan-ipweb/internal/logic/team"
+	"titan-ipweb/internal/svc"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// 解散团队
+func DeleteTeamHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := team.NewDeleteTeamLogic(r.Context(), svcCtx)
+		err := l.DeleteTeam()
+		if err != nil {
+			httpx.OkJsonCtx(r.Context(), w, utils.Error(err))
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, utils.Success(nil))
+		}
+	}
+}
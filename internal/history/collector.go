@@ -0,0 +1,261 @@
+package history
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const lockKey = "titan:ipweb:lock:history"
+
+// Collector pull the 5 minutes stats of sub users from the IPPM server into the local history,
+// and roll them up to the hourly and daily points, so the charts outlive the retention of the IPPM server
+// and the sub users deleted
+type Collector struct {
+	svcCtx   *svc.ServiceContext
+	interval time.Duration
+	done     chan struct{}
+}
+
+func NewCollector(svcCtx *svc.ServiceContext) *Collector {
+	return &Collector{
+		svcCtx:   svcCtx,
+		interval: time.Duration(svcCtx.Config.History.Interval) * time.Second,
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *Collector) Start() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.collectAll()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Collector) Stop() {
+	close(c.done)
+}
+
+func (c *Collector) collectAll() {
+	lock := redis.NewRedisLock(c.svcCtx.Redis, lockKey)
+	lock.SetExpire(int(c.interval.Seconds()))
+
+	ok, err := lock.Acquire()
+	if err != nil {
+		logx.Errorf("acquire history lock failed:%v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	// the sweep may take longer than the interval, keep the lock until it done
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.keepLock(ctx, cancel, lock)
+		close(stopped)
+	}()
+	// stop extending before the release, or the lock would be taken again
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	subUsers, err := model.GetAllSubUsers(ctx, c.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all sub users failed:%v", err)
+		return
+	}
+
+	// the deprecated sub users keep their history, but no new stats
+	mr.ForEach(func(source chan<- *model.SubUser) {
+		for _, subUser := range subUsers {
+			if subUser.Status == constant.SubUserStatusDeprecated {
+				continue
+			}
+			source <- subUser
+		}
+	}, func(subUser *model.SubUser) {
+		if err := c.collect(ctx, subUser); err != nil {
+			logx.Errorf("collect history of sub user %s failed:%v", subUser.Username, err)
+		}
+	}, mr.WithWorkers(c.svcCtx.Config.History.Workers))
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	before := time.Now().Unix() - c.svcCtx.Config.History.DayRetention
+	if err := model.TrimHistorySubUsers(ctx, c.svcCtx.Redis, before); err != nil {
+		logx.Errorf("trim history sub users failed:%v", err)
+	}
+}
+
+// keepLock extend the lock before it expire, cancel the sweep if the lock lost
+func (c *Collector) keepLock(ctx context.Context, cancel context.CancelFunc, lock *redis.RedisLock) {
+	ticker := time.NewTicker(c.interval / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// acquire again by the owner only reset the expire
+			ok, err := lock.Acquire()
+			if err != nil || !ok {
+				logx.Errorf("extend history lock failed, stop the sweep:%v", err)
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context, subUser *model.SubUser) error {
+	config := c.svcCtx.Config.History
+	now := time.Now().Unix()
+
+	collected, err := model.GetHistoryCollected(ctx, c.svcCtx.Redis, subUser.UserID, subUser.Username)
+	if err != nil {
+		return err
+	}
+
+	start := collected
+	backfilled := collected == 0
+	if backfilled {
+		// first time, keep what the IPPM server still has
+		if err := c.backfill(ctx, subUser.Username, now); err != nil {
+			return err
+		}
+		start = now - config.MinuteRetention
+	}
+
+	// the latest bucket may be partial when pulled last time, pull it again
+	points, err := c.pull(ctx, subUser.Username, model.HistoryMinute, start, now)
+	if err != nil {
+		return err
+	}
+
+	if err := model.SaveHistoryPoints(ctx, c.svcCtx.Redis, model.HistoryMinute, subUser.Username, points, config.MinuteRetention); err != nil {
+		return err
+	}
+
+	// the idle sub user has no points, start from the last bucket next time
+	step := model.HistoryStep(model.HistoryMinute)
+	collected = now/step*step - step
+	if len(points) > 0 {
+		from, to := points[0].Timestamp, points[len(points)-1].Timestamp
+		if backfilled {
+			// the first hour may be partial in the 5 minutes points, keep the backfilled one
+			hour := model.HistoryStep(model.HistoryHour)
+			from = (from + hour - 1) / hour * hour
+		}
+
+		if from <= to {
+			if err := c.rollup(ctx, subUser.Username, model.HistoryMinute, model.HistoryHour, from, to, config.HourRetention); err != nil {
+				return err
+			}
+			if err := c.rollup(ctx, subUser.Username, model.HistoryHour, model.HistoryDay, from, to, config.DayRetention); err != nil {
+				return err
+			}
+		}
+
+		if to > collected {
+			collected = to
+		}
+	}
+
+	return model.AddHistorySubUser(ctx, c.svcCtx.Redis, subUser.UserID, subUser.Username, collected)
+}
+
+func (c *Collector) backfill(ctx context.Context, username string, now int64) error {
+	config := c.svcCtx.Config.History
+	for resolution, retention := range map[string]int64{model.HistoryHour: config.HourRetention, model.HistoryDay: config.DayRetention} {
+		points, err := c.pull(ctx, username, resolution, now-retention, now)
+		if err != nil {
+			return err
+		}
+
+		if err := model.SaveHistoryPoints(ctx, c.svcCtx.Redis, resolution, username, points, retention); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pull the chart from the IPPM server, the empty points are not stored
+func (c *Collector) pull(ctx context.Context, username, resolution string, start, end int64) ([]*model.HistoryPoint, error) {
+	resp, err := c.svcCtx.IPPMClient.GetUserStatsChart(ctx, &ippmclient.UserStatsChartReq{
+		Type:      resolution,
+		Username:  username,
+		StartTime: start,
+		EndTime:   end,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	step := model.HistoryStep(resolution)
+	points := make([]*model.HistoryPoint, 0, len(resp.Stats))
+	for _, stat := range resp.Stats {
+		if stat == nil || (stat.Bandwidth == 0 && stat.Traffic == 0) {
+			continue
+		}
+		points = append(points, &model.HistoryPoint{
+			Timestamp: stat.Timestamp / step * step,
+			Bandwidth: stat.Bandwidth,
+			Traffic:   stat.Traffic,
+		})
+	}
+	return points, nil
+}
+
+// rollup recount the buckets of resolution to which cover [from, to] by the points of the finer resolution,
+// the traffic is the sum and the bandwidth is the peak
+func (c *Collector) rollup(ctx context.Context, username, finer, resolution string, from, to, retention int64) error {
+	step := model.HistoryStep(resolution)
+	start := from / step * step
+	end := to/step*step + step - 1
+
+	history, err := model.GetHistoryPoints(ctx, c.svcCtx.Redis, finer, []string{username}, start, end)
+	if err != nil {
+		return err
+	}
+
+	buckets := make(map[int64]*model.HistoryPoint)
+	points := make([]*model.HistoryPoint, 0)
+	for _, point := range history[username] {
+		ts := point.Timestamp / step * step
+		bucket, ok := buckets[ts]
+		if !ok {
+			bucket = &model.HistoryPoint{Timestamp: ts}
+			buckets[ts] = bucket
+			points = append(points, bucket)
+		}
+
+		bucket.Traffic += point.Traffic
+		if point.Bandwidth > bucket.Bandwidth {
+			bucket.Bandwidth = point.Bandwidth
+		}
+	}
+
+	return model.SaveHistoryPoints(ctx, c.svcCtx.Redis, resolution, username, points, retention)
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type EditAccountQuotaLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 修改账户的带宽与流量上限
+func NewEditAccountQuotaLogic(ctx context.Context, svcCtx *svc.ServiceContext) *EditAccountQuotaLogic {
+	return &EditAccountQuotaLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *EditAccountQuotaLogic) EditAccountQuota(req *types.EditAccountQuotaReq) error {
+	if req.MaxBandwidthLimit == nil && req.TotalTrafficLimit == nil {
+		return fmt.Errorf("nothing to edit")
+	}
+
+	if (req.MaxBandwidthLimit != nil && *req.MaxBandwidthLimit < 0) || (req.TotalTrafficLimit != nil && *req.TotalTrafficLimit < 0) {
+		return fmt.Errorf("limit can not be negative")
+	}
+
+	before, err := getAccount(l.svcCtx, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	// reject the limit less than the allocated, the admin should delete sub users first
+	if err := model.SetQuotaLimit(l.ctx, l.svcCtx.Redis, req.UserId, req.MaxBandwidthLimit, req.TotalTrafficLimit); err != nil {
+		return err
+	}
+
+	after := *before
+	if req.MaxBandwidthLimit != nil {
+		after.MaxBandwidthLimit = *req.MaxBandwidthLimit
+	}
+	if req.TotalTrafficLimit != nil {
+		after.TotalTrafficLimit = *req.TotalTrafficLimit
+	}
+
+	logx.Infof("edit quota of user %s, bandwidth %d -> %d, traffic %d -> %d", req.UserId,
+		before.MaxBandwidthLimit, after.MaxBandwidthLimit, before.TotalTrafficLimit, after.TotalTrafficLimit)
+	audit.Record(l.ctx, l.svcCtx, &audit.Entry{
+		UserID: req.UserId,
+		Action: audit.ActionEditQuota,
+		Before: before,
+		After:  &after,
+	})
+	return nil
+}
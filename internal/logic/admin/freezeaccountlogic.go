@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type FreezeAccountLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 冻结或解冻账户，冻结时停止所有子用户
+func NewFreezeAccountLogic(ctx context.Context, svcCtx *svc.ServiceContext) *FreezeAccountLogic {
+	return &FreezeAccountLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *FreezeAccountLogic) FreezeAccount(req *types.FreezeAccountReq) error {
+	user, err := getAccount(l.svcCtx, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	if req.Frozen {
+		return l.freeze(user)
+	}
+	return l.unfreeze(user)
+}
+
+// freeze mark the user frozen first, so the sub users can not be started again while stopping
+func (l *FreezeAccountLogic) freeze(user *model.User) error {
+	if !user.Frozen {
+		if err := model.SetUserFrozen(l.svcCtx.Redis, user.UUID, true); err != nil {
+			return err
+		}
+		l.record(user, true)
+	}
+
+	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, user.UUID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	// retry the freeze if some sub users stop failed
+	for _, subUser := range subUsers {
+		if subUser.Status != constant.SubUserStatusActive {
+			continue
+		}
+
+		err := l.svcCtx.IPPMClient.StartOrStopUser(l.ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "stop"})
+		if err != nil {
+			return fmt.Errorf("stop sub user %s failed:%w", subUser.Username, err)
+		}
+
+		if err := model.SetSubUserStatus(l.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonAccountFrozen); err != nil {
+			return err
+		}
+		audit.RecordStatus(l.ctx, l.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonAccountFrozen)
+	}
+	return nil
+}
+
+// unfreeze only restart the sub users stopped by freeze
+func (l *FreezeAccountLogic) unfreeze(user *model.User) error {
+	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, user.UUID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, subUser := range subUsers {
+		if subUser.Status != constant.SubUserStatusStop || subUser.StatusReason != constant.StatusReasonAccountFrozen {
+			continue
+		}
+
+		// the suspended user resume by the usage watcher when it has traffic again
+		if user.Suspended {
+			if err := model.SetSubUserStatus(l.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonAccountExhausted); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := l.svcCtx.IPPMClient.StartOrStopUser(l.ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "start"})
+		if err != nil {
+			return fmt.Errorf("start sub user %s failed:%w", subUser.Username, err)
+		}
+
+		if err := model.SetSubUserStatus(l.svcCtx.Redis, subUser.Username, constant.SubUserStatusActive, ""); err != nil {
+			return err
+		}
+		audit.RecordStatus(l.ctx, l.svcCtx, subUser, constant.SubUserStatusActive, "")
+	}
+
+	if !user.Frozen {
+		return nil
+	}
+
+	if err := model.SetUserFrozen(l.svcCtx.Redis, user.UUID, false); err != nil {
+		return err
+	}
+	l.record(user, false)
+	return nil
+}
+
+func (l *FreezeAccountLogic) record(user *model.User, frozen bool) {
+	logx.Infof("set user %s frozen %t", user.UUID, frozen)
+
+	action, eventType := audit.ActionUnfreezeAccount, event.TypeAccountUnfrozen
+	if frozen {
+		action, eventType = audit.ActionFreezeAccount, event.TypeAccountFrozen
+	}
+
+	after := *user
+	after.Frozen = frozen
+	audit.Record(l.ctx, l.svcCtx, &audit.Entry{
+		UserID: user.UUID,
+		Action: action,
+		Before: user,
+		After:  &after,
+	})
+
+	l.svcCtx.EventBus.Publish(l.ctx, &event.Event{
+		Type:   eventType,
+		UserID: user.UUID,
+		Reason: constant.StatusReasonAccountFrozen,
+	})
+}
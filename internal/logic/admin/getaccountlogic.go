@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetAccountLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取账户的配额
+func NewGetAccountLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetAccountLogic {
+	return &GetAccountLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *GetAccountLogic) GetAccount(req *types.GetAccountReq) (resp *types.AdminAccount, err error) {
+	user, err := getAccount(l.svcCtx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return toAdminAccount(user), nil
+}
+
+func getAccount(svcCtx *svc.ServiceContext, userID string) (*model.User, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user_id is required")
+	}
+
+	user, err := model.GetUser(svcCtx.Redis, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user %s not exist", userID)
+	}
+	return user, nil
+}
+
+func toAdminAccount(user *model.User) *types.AdminAccount {
+	return &types.AdminAccount{
+		UserId:                user.UUID,
+		Email:                 user.Email,
+		Index:                 user.Index,
+		MaxBandwidthLimit:     user.MaxBandwidthLimit,
+		MaxBandwidthAllocated: user.MaxBandwidthAllocated,
+		TotalTrafficLimit:     user.TotalTrafficLimit,
+		TotalTrafficAllocated: user.TotalTrafficAllocated,
+		TrafficConsumed:       user.TrafficConsumed,
+		Suspended:             user.Suspended,
+		Frozen:                user.Frozen,
+	}
+}
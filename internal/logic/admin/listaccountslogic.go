@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"context"
+	"sort"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ListAccountsLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 按序号拉取账户列表
+func NewListAccountsLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ListAccountsLogic {
+	return &ListAccountsLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ListAccountsLogic) ListAccounts(req *types.ListAccountsReq) (resp *types.ListAccountsResponse, err error) {
+	users, err := model.GetAllUsers(l.ctx, l.svcCtx.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Index < users[j].Index
+	})
+
+	start, end := req.Start, req.End
+	if start < 0 {
+		start = 0
+	}
+	if end <= 0 || end > len(users) {
+		end = len(users)
+	}
+	if start > end {
+		start = end
+	}
+
+	accounts := make([]*types.AdminAccount, 0, end-start)
+	for _, user := range users[start:end] {
+		accounts = append(accounts, toAdminAccount(user))
+	}
+
+	return &types.ListAccountsResponse{Accounts: accounts, Total: len(users)}, nil
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"context"
+
+	"titan-ipweb/internal/reconcile"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ReconcileLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 对比本地子用户与IPPM服务器的用户
+func NewReconcileLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ReconcileLogic {
+	return &ReconcileLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ReconcileLogic) Reconcile(req *types.ReconcileReq) (resp *types.ReconcileResponse, err error) {
+	logx.Infof("Reconcile %#v", req)
+	return reconcile.NewReconciler(l.svcCtx).Run(l.ctx, req.Repair)
+}
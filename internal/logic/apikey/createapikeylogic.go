@@ -0,0 +1,107 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const maxAPIKeyNameLength = 64
+
+type CreateAPIKeyLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 创建API key
+func NewCreateAPIKeyLogic(ctx context.Context, svcCtx *svc.ServiceContext) *CreateAPIKeyLogic {
+	return &CreateAPIKeyLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *CreateAPIKeyLogic) CreateAPIKey(req *types.CreateAPIKeyReq) (resp *types.CreateAPIKeyResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	// the key with less scopes can not create a key with more scopes
+	if autCtxValue.APIKeyID != "" {
+		return nil, fmt.Errorf("can not create api key by api key, please login")
+	}
+
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		return nil, fmt.Errorf("name length must be in 1-%d", maxAPIKeyNameLength)
+	}
+
+	for _, scope := range req.Scopes {
+		if scope != middleware.ScopeRead && scope != middleware.ScopeManage {
+			return nil, fmt.Errorf("invalid scope %s, must be %s", scope, strings.Join(middleware.Scopes, " or "))
+		}
+	}
+
+	if req.ExpireDays < 0 {
+		return nil, fmt.Errorf("invalid expire days %d", req.ExpireDays)
+	}
+
+	count, err := model.APIKeyCount(l.svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= l.svcCtx.Config.APIKey.MaxPerUser {
+		return nil, fmt.Errorf("can not create more than %d api keys", l.svcCtx.Config.APIKey.MaxPerUser)
+	}
+
+	now := time.Now().Unix()
+	apiKey := &model.APIKey{
+		UserID:     autCtxValue.UserId,
+		Name:       req.Name,
+		Scopes:     strings.Join(req.Scopes, ","),
+		CreateTime: now,
+	}
+	if req.ExpireDays > 0 {
+		apiKey.ExpireTime = now + req.ExpireDays*24*60*60
+	}
+
+	key, err := model.NewAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.AddAPIKey(l.svcCtx.Redis, apiKey); err != nil {
+		return nil, err
+	}
+
+	return &types.CreateAPIKeyResponse{APIKey: *toAPIKey(apiKey), Key: key}, nil
+}
+
+// toAPIKey convert the api key to api type, without the hash
+func toAPIKey(apiKey *model.APIKey) *types.APIKey {
+	scopes := apiKey.ScopeList()
+	if scopes == nil {
+		scopes = make([]string, 0)
+	}
+
+	return &types.APIKey{
+		Id:           apiKey.ID,
+		Name:         apiKey.Name,
+		Scopes:       scopes,
+		ExpireTime:   apiKey.ExpireTime,
+		CreateTime:   apiKey.CreateTime,
+		LastUsedTime: apiKey.LastUsedTime,
+	}
+}
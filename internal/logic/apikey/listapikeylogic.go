@@ -0,0 +1,47 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ListAPIKeyLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取API key列表
+func NewListAPIKeyLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ListAPIKeyLogic {
+	return &ListAPIKeyLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ListAPIKeyLogic) ListAPIKey() (resp *types.ListAPIKeyResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	apiKeys, err := model.GetUserAPIKeys(l.ctx, l.svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &types.ListAPIKeyResponse{APIKeys: make([]*types.APIKey, 0, len(apiKeys))}
+	for _, apiKey := range apiKeys {
+		resp.APIKeys = append(resp.APIKeys, toAPIKey(apiKey))
+	}
+	return resp, nil
+}
@@ -0,0 +1,47 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type RevokeAPIKeyLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 撤销API key
+func NewRevokeAPIKeyLogic(ctx context.Context, svcCtx *svc.ServiceContext) *RevokeAPIKeyLogic {
+	return &RevokeAPIKeyLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *RevokeAPIKeyLogic) RevokeAPIKey(req *types.RevokeAPIKeyReq) error {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return fmt.Errorf("auth failed")
+	}
+
+	apiKey, err := model.GetAPIKey(l.svcCtx.Redis, req.Id)
+	if err != nil {
+		return err
+	}
+
+	if apiKey == nil || apiKey.UserID != autCtxValue.UserId {
+		return fmt.Errorf("api key %s not exist", req.Id)
+	}
+
+	return model.RemoveAPIKey(l.svcCtx.Redis, autCtxValue.UserId, req.Id)
+}
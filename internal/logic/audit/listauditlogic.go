@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const maxAuditPageSize = 100
+
+type ListAuditLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取审计日志
+func NewListAuditLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ListAuditLogic {
+	return &ListAuditLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ListAuditLogic) ListAudit(req *types.ListAuditReq) (resp *types.ListAuditResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	if req.Size <= 0 || req.Size > maxAuditPageSize {
+		return nil, fmt.Errorf("size must be in 1-%d", maxAuditPageSize)
+	}
+
+	if req.Action != "" && !audit.IsValidAction(req.Action) {
+		return nil, fmt.Errorf("unknown action %s", req.Action)
+	}
+
+	if req.StartTime > 0 && req.EndTime > 0 && req.StartTime > req.EndTime {
+		return nil, fmt.Errorf("start time %d after end time %d", req.StartTime, req.EndTime)
+	}
+
+	filter := model.AuditFilter{
+		SubUsername: req.Username,
+		Action:      req.Action,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	}
+	entries, next, err := model.GetAuditEntries(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, filter, req.Cursor, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &types.ListAuditResponse{Entries: make([]*types.AuditEntry, 0, len(entries)), NextCursor: next}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, toAuditEntry(entry))
+	}
+	return resp, nil
+}
+
+func toAuditEntry(entry *model.AuditEntry) *types.AuditEntry {
+	e := &types.AuditEntry{
+		Id:         entry.ID,
+		Time:       entry.Time,
+		ActorId:    entry.ActorID,
+		ActorEmail: entry.ActorEmail,
+		ClientIP:   entry.ClientIP,
+		Action:     entry.Action,
+		Username:   entry.SubUsername,
+		IPPMResult: entry.IPPMResult,
+	}
+
+	if entry.Diff != "" {
+		if err := json.Unmarshal([]byte(entry.Diff), &e.Diff); err != nil {
+			logx.Errorf("unmarshal audit diff %s failed:%v", entry.ID, err)
+		}
+	}
+	return e
+}
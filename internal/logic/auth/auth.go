@@ -3,14 +3,17 @@ package auth
 import (
 	"time"
 	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func generateToken(accessSecret, uuid, email string, expire time.Duration) (string, error) {
+func generateToken(accessSecret, uuid, email, role string, expire time.Duration) (string, error) {
 	claims := middleware.Claims{
 		UserId: uuid,
 		Email:  email,
+		Role:   role,
 		//SessionKey: sessionKey,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
@@ -21,3 +24,13 @@ func generateToken(accessSecret, uuid, email string, expire time.Duration) (stri
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(accessSecret))
 }
+
+// userRole return the role in the token, the emails in the admin list are always admin
+func userRole(svcCtx *svc.ServiceContext, role, email string) string {
+	return middleware.UserRole(svcCtx.Config.Admin.Emails, role, email)
+}
+
+// recordUserRole keep the role from the user server, the api keys of the user take it on every request
+func recordUserRole(svcCtx *svc.ServiceContext, uuid, role string) error {
+	return model.SetUserRole(svcCtx.Redis, uuid, middleware.ResolveRole(role))
+}
@@ -50,17 +50,23 @@ func (l *LoginByGoogleLogic) LoginByGoogle(req *types.LoginByGoogleRequest) (res
 		}
 
 		user := &model.User{
-			UUID:              res.UserUuid,
-			Email:             res.Email,
-			Index:             index,
-			MaxBandwidthLimit: l.svcCtx.Config.Quota.MaxBandwidthLimit,
-			TotalTrafficLimit: l.svcCtx.Config.Quota.TotalTrafficLimit,
+			UUID:                 res.UserUuid,
+			Email:                res.Email,
+			Index:                index,
+			MaxBandwidthLimit:    l.svcCtx.Config.Quota.MaxBandwidthLimit,
+			TotalTrafficLimit:    l.svcCtx.Config.Quota.TotalTrafficLimit,
+			MaxUploadRateLimit:   l.svcCtx.Config.Quota.MaxUploadRateLimit,
+			MaxDownloadRateLimit: l.svcCtx.Config.Quota.MaxDownloadRateLimit,
 		}
 		if err := model.SaveUser(l.svcCtx.Redis, user); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := recordUserRole(l.svcCtx, res.UserUuid, res.Role); err != nil {
+		return nil, err
+	}
+
 	accessExpire := l.svcCtx.Config.TokenAuth.AccessExpire
 	td, err := time.ParseDuration(accessExpire)
 	if err != nil {
@@ -68,7 +74,8 @@ func (l *LoginByGoogleLogic) LoginByGoogle(req *types.LoginByGoogleRequest) (res
 	}
 
 	accessSecret := l.svcCtx.Config.TokenAuth.AccessSecret
-	token, err := generateToken(accessSecret, res.UserUuid, res.Email, td)
+	role := userRole(l.svcCtx, res.Role, res.Email)
+	token, err := generateToken(accessSecret, res.UserUuid, res.Email, role, td)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +87,7 @@ func (l *LoginByGoogleLogic) LoginByGoogle(req *types.LoginByGoogleRequest) (res
 		RefreshToken: res.RefreshToken,
 		UserId:       res.UserUuid,
 		Email:        res.Email,
-		Role:         res.Role,
+		Role:         role,
 		// InviteCode:   userInfo.InviteCode,
 		ExpiresAt: expiresAt,
 	}, nil
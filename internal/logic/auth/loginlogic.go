@@ -54,17 +54,23 @@ func (l *LoginLogic) Login(req *types.LoginRequest) (resp *types.LoginResponse,
 		}
 
 		user := &model.User{
-			UUID:              res.UserUuid,
-			Email:             req.UserId,
-			Index:             index,
-			MaxBandwidthLimit: l.svcCtx.Config.Quota.MaxBandwidthLimit,
-			TotalTrafficLimit: l.svcCtx.Config.Quota.TotalTrafficLimit,
+			UUID:                 res.UserUuid,
+			Email:                req.UserId,
+			Index:                index,
+			MaxBandwidthLimit:    l.svcCtx.Config.Quota.MaxBandwidthLimit,
+			TotalTrafficLimit:    l.svcCtx.Config.Quota.TotalTrafficLimit,
+			MaxUploadRateLimit:   l.svcCtx.Config.Quota.MaxUploadRateLimit,
+			MaxDownloadRateLimit: l.svcCtx.Config.Quota.MaxDownloadRateLimit,
 		}
 		if err := model.SaveUser(l.svcCtx.Redis, user); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := recordUserRole(l.svcCtx, res.UserUuid, res.Role); err != nil {
+		return nil, err
+	}
+
 	accessExpire := l.svcCtx.Config.TokenAuth.AccessExpire
 	td, err := time.ParseDuration(accessExpire)
 	if err != nil {
@@ -72,7 +78,8 @@ func (l *LoginLogic) Login(req *types.LoginRequest) (resp *types.LoginResponse,
 	}
 
 	accessSecret := l.svcCtx.Config.TokenAuth.AccessSecret
-	token, err := generateToken(accessSecret, res.UserUuid, req.UserId, td)
+	role := userRole(l.svcCtx, res.Role, req.UserId)
+	token, err := generateToken(accessSecret, res.UserUuid, req.UserId, role, td)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +91,7 @@ func (l *LoginLogic) Login(req *types.LoginRequest) (resp *types.LoginResponse,
 		RefreshToken: res.RefreshToken,
 		UserId:       res.UserUuid,
 		Email:        req.UserId,
-		Role:         res.Role,
+		Role:         role,
 		// InviteCode:   userInfo.InviteCode,
 		ExpiresAt: expiresAt,
 	}, nil
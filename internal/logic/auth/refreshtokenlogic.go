@@ -47,6 +47,10 @@ func (l *RefreshTokenLogic) RefreshToken(req *types.RefreshTokenRequest) (resp *
 		return nil, fmt.Errorf("user %s not exist", res.UserUuid)
 	}
 
+	if err := recordUserRole(l.svcCtx, res.UserUuid, res.Role); err != nil {
+		return nil, err
+	}
+
 	accessExpire := l.svcCtx.Config.TokenAuth.AccessExpire
 	td, err := time.ParseDuration(accessExpire)
 	if err != nil {
@@ -54,7 +58,8 @@ func (l *RefreshTokenLogic) RefreshToken(req *types.RefreshTokenRequest) (resp *
 	}
 
 	accessSecret := l.svcCtx.Config.TokenAuth.AccessSecret
-	token, err := generateToken(accessSecret, res.UserUuid, user.Email, td)
+	role := userRole(l.svcCtx, res.Role, user.Email)
+	token, err := generateToken(accessSecret, res.UserUuid, user.Email, role, td)
 
 	expiresAt := time.Now().Add(td).Unix()
 
@@ -62,7 +67,7 @@ func (l *RefreshTokenLogic) RefreshToken(req *types.RefreshTokenRequest) (resp *
 		AccessToken:  token,
 		RefreshToken: res.RefreshToken,
 		UserId:       res.UserUuid,
-		Role:         res.Role,
+		Role:         role,
 		ExpiresAt:    expiresAt,
 	}, nil
 }
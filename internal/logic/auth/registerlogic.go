@@ -63,11 +63,13 @@ func (l *RegisterLogic) Register(req *types.UserRegisterReq) (resp *types.UserRe
 	}
 
 	user := &model.User{
-		UUID:              res.UserUuid,
-		Email:             req.Email,
-		Index:             index,
-		MaxBandwidthLimit: l.svcCtx.Config.Quota.MaxBandwidthLimit,
-		TotalTrafficLimit: l.svcCtx.Config.Quota.TotalTrafficLimit,
+		UUID:                 res.UserUuid,
+		Email:                req.Email,
+		Index:                index,
+		MaxBandwidthLimit:    l.svcCtx.Config.Quota.MaxBandwidthLimit,
+		TotalTrafficLimit:    l.svcCtx.Config.Quota.TotalTrafficLimit,
+		MaxUploadRateLimit:   l.svcCtx.Config.Quota.MaxUploadRateLimit,
+		MaxDownloadRateLimit: l.svcCtx.Config.Quota.MaxDownloadRateLimit,
 	}
 
 	if err := model.SaveUser(l.svcCtx.Redis, user); err != nil {
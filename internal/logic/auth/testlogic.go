@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/model"
 
@@ -36,7 +37,8 @@ func (l *TestLogic) Test() (resp string, err error) {
 	}
 
 	if user == nil {
-		u := &model.User{UUID: uuid, Email: email, MaxBandwidthLimit: l.svcCtx.Config.Quota.MaxBandwidthLimit, TotalTrafficLimit: l.svcCtx.Config.Quota.TotalTrafficLimit}
+		u := &model.User{UUID: uuid, Email: email, MaxBandwidthLimit: l.svcCtx.Config.Quota.MaxBandwidthLimit, TotalTrafficLimit: l.svcCtx.Config.Quota.TotalTrafficLimit,
+			MaxUploadRateLimit: l.svcCtx.Config.Quota.MaxUploadRateLimit, MaxDownloadRateLimit: l.svcCtx.Config.Quota.MaxDownloadRateLimit, Role: middleware.RoleOwner}
 		if err := model.SaveUser(l.svcCtx.Redis, u); err != nil {
 			return "", err
 		}
@@ -47,7 +49,7 @@ func (l *TestLogic) Test() (resp string, err error) {
 	if err != nil {
 		td = 24 * time.Hour
 	}
-	token, err := generateToken(l.svcCtx.Config.TokenAuth.AccessSecret, uuid, email, td)
+	token, err := generateToken(l.svcCtx.Config.TokenAuth.AccessSecret, uuid, email, middleware.RoleOwner, td)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,251 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+)
+
+type BatchCreateSubUserLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 批量创建子用户
+func NewBatchCreateSubUserLogic(ctx context.Context, svcCtx *svc.ServiceContext) *BatchCreateSubUserLogic {
+	return &BatchCreateSubUserLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+// batchItem is a sub user of the batch, the item with err is not created
+type batchItem struct {
+	req *types.CreateSubUserReq
+	op  *model.PendingOp
+	err error
+}
+
+func (l *BatchCreateSubUserLogic) BatchCreateSubUser(req *types.BatchCreateSubUserReq) (resp *types.BatchCreateSubUserResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	users, err := l.batchUsers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not exist, please login again")
+	}
+
+	if user.Frozen {
+		return nil, ErrAccountFrozen
+	}
+
+	if user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+
+	template := &types.CreateSubUserReq{
+		PopId:             req.PopId,
+		Route:             req.Route,
+		UploadRateLimit:   req.UploadRateLimit,
+		DownloadRateLimit: req.DownloadRateLimit,
+		MaxBandwidthLimit: req.MaxBandwidthLimit,
+		TotalTrafficLimit: req.TotalTrafficLimit,
+		PeriodType:        req.PeriodType,
+		PeriodDays:        req.PeriodDays,
+		RenewMode:         req.RenewMode,
+	}
+	if err := checkCreateSubUserReq(l.svcCtx, user, template); err != nil {
+		return nil, err
+	}
+
+	items := l.prepare(user, template, users)
+
+	// reserve the quota of the whole batch once
+	ops := make([]*model.PendingOp, 0, len(items))
+	for _, item := range items {
+		if item.err == nil {
+			ops = append(ops, item.op)
+		}
+	}
+
+	if len(ops) > 0 {
+		if err := l.reserve(user, ops); err != nil {
+			for _, op := range ops {
+				if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+					logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+				}
+			}
+			return nil, err
+		}
+	}
+
+	results := make([]*types.BatchCreateResult, len(items))
+	createLogic := NewCreateSubUserLogic(l.ctx, l.svcCtx)
+	mr.ForEach(func(source chan<- int) {
+		for i, item := range items {
+			if item.err != nil {
+				results[i] = &types.BatchCreateResult{Username: item.req.Username, Error: item.err.Error()}
+				continue
+			}
+			source <- i
+		}
+	}, func(i int) {
+		item := items[i]
+		subUser, err := l.create(createLogic, user, item)
+		if err != nil {
+			logx.Errorf("batch create sub user %s failed:%v", item.req.Username, err)
+			results[i] = &types.BatchCreateResult{Username: item.req.Username, Error: err.Error()}
+			return
+		}
+		results[i] = &types.BatchCreateResult{Username: item.req.Username, SubUser: subUser}
+	}, mr.WithWorkers(l.svcCtx.Config.Batch.Concurrency))
+
+	resp = &types.BatchCreateSubUserResponse{Results: results}
+	for _, result := range results {
+		if result.SubUser != nil {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	logx.Infof("user %s batch create %d sub users, %d failed", user.UUID, resp.Succeeded, resp.Failed)
+	return resp, nil
+}
+
+// batchUsers return the uploaded list, or generate names by the prefix
+func (l *BatchCreateSubUserLogic) batchUsers(req *types.BatchCreateSubUserReq) ([]*types.BatchSubUser, error) {
+	maxCount := l.svcCtx.Config.Batch.MaxCount
+	if len(req.Users) > 0 {
+		if len(req.Users) > maxCount {
+			return nil, fmt.Errorf("can not create more than %d sub users at once", maxCount)
+		}
+		return req.Users, nil
+	}
+
+	if req.Count <= 0 {
+		return nil, fmt.Errorf("count or users is required")
+	}
+
+	if req.Count > maxCount {
+		return nil, fmt.Errorf("can not create more than %d sub users at once", maxCount)
+	}
+
+	if req.Prefix == "" {
+		return nil, fmt.Errorf("prefix is required")
+	}
+
+	users := make([]*types.BatchSubUser, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		users = append(users, &types.BatchSubUser{Username: fmt.Sprintf("%s%03d", req.Prefix, req.StartIndex+i)})
+	}
+	return users, nil
+}
+
+// prepare check every sub user and begin its pending op
+func (l *BatchCreateSubUserLogic) prepare(user *model.User, template *types.CreateSubUserReq, users []*types.BatchSubUser) []*batchItem {
+	items := make([]*batchItem, 0, len(users))
+	seen := make(map[string]bool, len(users))
+	for _, u := range users {
+		itemReq := *template
+		itemReq.Username = genSubUserName(l.svcCtx.Config.RunMode, user.Index, u.Username)
+		itemReq.Password = u.Password
+
+		item := &batchItem{req: &itemReq}
+		items = append(items, item)
+
+		if u.Username == "" {
+			item.err = fmt.Errorf("empty username")
+			continue
+		}
+
+		if seen[itemReq.Username] {
+			item.err = fmt.Errorf("user %s duplicated in the batch", itemReq.Username)
+			continue
+		}
+		seen[itemReq.Username] = true
+
+		if itemReq.Password == "" {
+			password, err := genPassword(l.svcCtx.Config.Password.Length)
+			if err != nil {
+				item.err = err
+				continue
+			}
+			itemReq.Password = password
+		} else if err := checkPassword(itemReq.Password); err != nil {
+			item.err = err
+			continue
+		}
+
+		sUser, err := model.GetSubUser(l.svcCtx.Redis, itemReq.Username)
+		if err != nil {
+			item.err = err
+			continue
+		}
+		if sUser != nil {
+			item.err = fmt.Errorf("user %s already exist", itemReq.Username)
+			continue
+		}
+
+		op := &model.PendingOp{
+			Kind:              model.PendingOpCreate,
+			UserID:            user.UUID,
+			SubUsername:       itemReq.Username,
+			MaxBandwidthLimit: itemReq.MaxBandwidthLimit,
+			TotalTrafficLimit: itemReq.TotalTrafficLimit,
+		}
+		if err := model.BeginPendingOp(l.svcCtx.Redis, op); err != nil {
+			item.err = err
+			continue
+		}
+		item.op = op
+	}
+	return items
+}
+
+// reserve the quota of all ops and mark them quota reserved in one step,
+// a crash after it leave the release to the saga retrier
+func (l *BatchCreateSubUserLogic) reserve(user *model.User, ops []*model.PendingOp) error {
+	var bandwidth, traffic int64
+	subUsernames := make([]string, 0, len(ops))
+	for _, op := range ops {
+		bandwidth += op.MaxBandwidthLimit
+		traffic += op.TotalTrafficLimit
+		subUsernames = append(subUsernames, op.SubUsername)
+	}
+
+	if err := model.ReserveQuota(l.ctx, l.svcCtx.Redis, user.UUID, bandwidth, traffic, subUsernames...); err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		op.QuotaReserved = true
+	}
+	return nil
+}
+
+// create one sub user of the batch, the rollback of the failed one give back its share of the quota
+func (l *BatchCreateSubUserLogic) create(createLogic *CreateSubUserLogic, user *model.User, item *batchItem) (*types.SubUser, error) {
+	return createLogic.create(user, item.req, item.op)
+}
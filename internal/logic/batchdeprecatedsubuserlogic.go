@@ -0,0 +1,59 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type BatchDeprecatedSubUserLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 批量废弃子用户
+func NewBatchDeprecatedSubUserLogic(ctx context.Context, svcCtx *svc.ServiceContext) *BatchDeprecatedSubUserLogic {
+	return &BatchDeprecatedSubUserLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *BatchDeprecatedSubUserLogic) BatchDeprecatedSubUser(req *types.BatchDeprecatedSubUserReq) (resp *types.BatchResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not exist, please login again")
+	}
+
+	subUsers, failed, err := resolveBatchSubUsers(l.ctx, l.svcCtx, user, req.Usernames, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	deprecatedLogic := NewDeprecatedSubUserLogic(l.ctx, l.svcCtx)
+	results := runBatch(l.svcCtx, subUsers, func(subUser *model.SubUser) error {
+		return deprecatedLogic.DeprecatedSubUser(&types.DeprecatedSubUserReq{Username: subUser.Username})
+	})
+
+	resp = toBatchResponse(append(failed, results...))
+	logx.Infof("user %s batch deprecate %d sub users, %d failed", user.UUID, resp.Succeeded, resp.Failed)
+	return resp, nil
+}
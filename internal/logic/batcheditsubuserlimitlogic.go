@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type BatchEditSubUserLimitLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 批量编辑子账户的流量配额与带宽限制
+func NewBatchEditSubUserLimitLogic(ctx context.Context, svcCtx *svc.ServiceContext) *BatchEditSubUserLimitLogic {
+	return &BatchEditSubUserLimitLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *BatchEditSubUserLimitLogic) BatchEditSubUserLimit(req *types.BatchEditSubUserLimitReq) (resp *types.BatchResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	if req.MaxBandwidthLimit == nil && req.TotalTrafficLimit == nil && req.Route == nil &&
+		req.UploadRateLimit == nil && req.DownloadRateLimit == nil {
+		return nil, fmt.Errorf("nothing to edit")
+	}
+
+	if err := checkEditQuotaLimit(req.MaxBandwidthLimit, req.TotalTrafficLimit); err != nil {
+		return nil, err
+	}
+
+	if req.Route != nil {
+		if err := checkRoute(req.Route); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not exist, please login again")
+	}
+
+	subUsers, failed, err := resolveBatchSubUsers(l.ctx, l.svcCtx, user, req.Usernames, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the quota of the whole batch, then shrink first to free the quota for the growing ones
+	var bandwidthDelta, trafficDelta int64
+	shrinking := make([]*model.SubUser, 0, len(subUsers))
+	growing := make([]*model.SubUser, 0, len(subUsers))
+	for _, subUser := range subUsers {
+		b, t := l.delta(req, subUser)
+		bandwidthDelta += b
+		trafficDelta += t
+		if b > 0 || t > 0 {
+			growing = append(growing, subUser)
+		} else {
+			shrinking = append(shrinking, subUser)
+		}
+	}
+
+	if bandwidthDelta > 0 && user.MaxBandwidthAllocated+bandwidthDelta > user.MaxBandwidthLimit {
+		return nil, model.ErrNotEnoughBandwidth
+	}
+	if trafficDelta > 0 && user.TotalTrafficAllocated+trafficDelta > user.TotalTrafficLimit {
+		return nil, model.ErrNotEnoughTraffic
+	}
+
+	editLogic := NewEditSubUserLimitLogic(l.ctx, l.svcCtx)
+	edit := func(subUser *model.SubUser) error {
+		return editLogic.EditSubUserLimit(&types.EditSubUserLimitReq{
+			Username:          subUser.Username,
+			MaxBandwidthLimit: req.MaxBandwidthLimit,
+			TotalTrafficLimit: req.TotalTrafficLimit,
+			Route:             req.Route,
+			UploadRateLimit:   req.UploadRateLimit,
+			DownloadRateLimit: req.DownloadRateLimit,
+		})
+	}
+
+	results := append(failed, runBatch(l.svcCtx, shrinking, edit)...)
+	results = append(results, runBatch(l.svcCtx, growing, edit)...)
+
+	resp = toBatchResponse(results)
+	logx.Infof("user %s batch edit limit of %d sub users, %d failed", user.UUID, resp.Succeeded, resp.Failed)
+	return resp, nil
+}
+
+// delta return the change of the allocated bandwidth and traffic of the sub user
+func (l *BatchEditSubUserLimitLogic) delta(req *types.BatchEditSubUserLimitReq, subUser *model.SubUser) (bandwidth, traffic int64) {
+	if req.MaxBandwidthLimit != nil {
+		bandwidth = *req.MaxBandwidthLimit - subUser.MaxBandwidthLimit
+	}
+	if req.TotalTrafficLimit != nil {
+		traffic = *req.TotalTrafficLimit - subUser.TotalTrafficLimit
+	}
+	return bandwidth, traffic
+}
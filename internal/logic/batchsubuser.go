@@ -0,0 +1,118 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/mr"
+)
+
+// resolveBatchSubUsers return the sub users of the account selected by the usernames or the filter,
+// the usernames not belong to the account are returned as failed results
+func resolveBatchSubUsers(ctx context.Context, svcCtx *svc.ServiceContext, user *model.User, usernames []string, filter *types.SubUserFilter) ([]*model.SubUser, []*types.BatchResult, error) {
+	maxCount := svcCtx.Config.Batch.MaxCount
+	if len(usernames) > 0 {
+		if len(usernames) > maxCount {
+			return nil, nil, fmt.Errorf("can not handle more than %d sub users at once", maxCount)
+		}
+		return getBatchSubUsers(svcCtx, user.UUID, usernames)
+	}
+
+	if filter == nil || (filter.PopId == "" && filter.Status == "" && filter.Prefix == "") {
+		return nil, nil, fmt.Errorf("usernames or filter is required")
+	}
+
+	if filter.Status != "" && filter.Status != subUserStatusActive && filter.Status != subUserStatusStop {
+		return nil, nil, fmt.Errorf("filter status %s is not %s or %s", filter.Status, subUserStatusActive, subUserStatusStop)
+	}
+
+	all, err := model.GetSubUsers(ctx, svcCtx.Redis, user.UUID, 0, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefix := ""
+	if filter.Prefix != "" {
+		prefix = genSubUserName(svcCtx.Config.RunMode, user.Index, filter.Prefix)
+	}
+
+	subUsers := make([]*model.SubUser, 0)
+	for _, subUser := range all {
+		if subUser.Status == subUserStatusDeprecated {
+			continue
+		}
+		if filter.PopId != "" && subUser.PopID != filter.PopId {
+			continue
+		}
+		if filter.Status != "" && subUser.Status != filter.Status {
+			continue
+		}
+		if prefix != "" && !strings.HasPrefix(subUser.Username, prefix) {
+			continue
+		}
+		subUsers = append(subUsers, subUser)
+	}
+
+	if len(subUsers) > maxCount {
+		return nil, nil, fmt.Errorf("%d sub users matched, can not handle more than %d at once", len(subUsers), maxCount)
+	}
+	return subUsers, nil, nil
+}
+
+func getBatchSubUsers(svcCtx *svc.ServiceContext, accountID string, usernames []string) ([]*model.SubUser, []*types.BatchResult, error) {
+	subUsers := make([]*model.SubUser, 0, len(usernames))
+	failed := make([]*types.BatchResult, 0)
+	seen := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		subUser, err := model.GetSubUser(svcCtx.Redis, username)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if subUser == nil || subUser.UserID != accountID {
+			failed = append(failed, &types.BatchResult{Username: username, Error: fmt.Sprintf("sub user %s not exist", username)})
+			continue
+		}
+		subUsers = append(subUsers, subUser)
+	}
+	return subUsers, failed, nil
+}
+
+// runBatch call fn on the sub users with bounded concurrency, the results keep the order of the sub users
+func runBatch(svcCtx *svc.ServiceContext, subUsers []*model.SubUser, fn func(subUser *model.SubUser) error) []*types.BatchResult {
+	results := make([]*types.BatchResult, len(subUsers))
+	mr.ForEach(func(source chan<- int) {
+		for i := range subUsers {
+			source <- i
+		}
+	}, func(i int) {
+		result := &types.BatchResult{Username: subUsers[i].Username}
+		if err := fn(subUsers[i]); err != nil {
+			result.Error = err.Error()
+		}
+		results[i] = result
+	}, mr.WithWorkers(svcCtx.Config.Batch.Concurrency))
+	return results
+}
+
+func toBatchResponse(results []*types.BatchResult) *types.BatchResponse {
+	resp := &types.BatchResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	return resp
+}
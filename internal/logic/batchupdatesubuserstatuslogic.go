@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type BatchUpdateSubUserStatusLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 批量更新子账户状态
+func NewBatchUpdateSubUserStatusLogic(ctx context.Context, svcCtx *svc.ServiceContext) *BatchUpdateSubUserStatusLogic {
+	return &BatchUpdateSubUserStatusLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *BatchUpdateSubUserStatusLogic) BatchUpdateSubUserStatus(req *types.BatchUpdateSubUserStatusReq) (resp *types.BatchResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	if req.Status != subUserStatusActive && req.Status != subUserStatusStop {
+		return nil, fmt.Errorf("user status %s is not %s or %s", req.Status, subUserStatusActive, subUserStatusStop)
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not exist, please login again")
+	}
+
+	// fail the whole batch early instead of every item
+	if req.Status == subUserStatusActive && user.Frozen {
+		return nil, ErrAccountFrozen
+	}
+	if req.Status == subUserStatusActive && user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+
+	subUsers, failed, err := resolveBatchSubUsers(l.ctx, l.svcCtx, user, req.Usernames, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	statusLogic := NewUpdateSubUserStatusLogic(l.ctx, l.svcCtx)
+	results := runBatch(l.svcCtx, subUsers, func(subUser *model.SubUser) error {
+		if subUser.Status == req.Status {
+			return nil
+		}
+		return statusLogic.UpdateSubUserStatus(&types.UpdateSubUserStatusReq{Username: subUser.Username, Status: req.Status})
+	})
+
+	resp = toBatchResponse(append(failed, results...))
+	logx.Infof("user %s batch update %d sub users to %s, %d failed", user.UUID, resp.Succeeded, req.Status, resp.Failed)
+	return resp, nil
+}
@@ -1,7 +1,9 @@
 package logic
 
+import "titan-ipweb/internal/constant"
+
 const (
-	subUserStatusActive     = "active"
-	subUserStatusStop       = "stop"
-	subUserStatusDeprecated = "deprecated"
+	subUserStatusActive     = constant.SubUserStatusActive
+	subUserStatusStop       = constant.SubUserStatusStop
+	subUserStatusDeprecated = constant.SubUserStatusDeprecated
 )
@@ -1,16 +1,15 @@
 package logic
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"time"
 
+	"titan-ipweb/internal/audit"
 	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/saga"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
 	"titan-ipweb/ippmclient"
@@ -29,7 +28,7 @@ func genSubUserName(env string, index int64, username string) string {
 	if env == constant.RunModeProd {
 		return fmt.Sprintf("%05d_%s", index, username)
 	}
-	return fmt.Sprintf("test_%05d_%s", index, username)
+	return fmt.Sprintf("%s%05d_%s", constant.TestSubUserPrefix, index, username)
 }
 
 // 创建socks5用户
@@ -49,7 +48,15 @@ func (l *CreateSubUserLogic) CreateSubUser(req *types.CreateSubUserReq) (resp *t
 		return nil, fmt.Errorf("auth failed")
 	}
 
-	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.UserId)
+	if req.Password == "" {
+		if req.Password, err = genPassword(l.svcCtx.Config.Password.Length); err != nil {
+			return nil, err
+		}
+	} else if err := checkPassword(req.Password); err != nil {
+		return nil, err
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
@@ -58,12 +65,16 @@ func (l *CreateSubUserLogic) CreateSubUser(req *types.CreateSubUserReq) (resp *t
 		return nil, fmt.Errorf("user not exist, please login again")
 	}
 
-	// update user quota
-	user.MaxBandwidthAllocated += req.MaxBandwidthLimit
-	user.TotalTrafficAllocated += req.TotalTrafficLimit
+	if user.Frozen {
+		return nil, ErrAccountFrozen
+	}
 
-	if user.MaxBandwidthLimit < user.MaxBandwidthAllocated {
-		return nil, fmt.Errorf("not enough bandwidth allocate for user %s", req.Username)
+	if user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+
+	if err := checkCreateSubUserReq(l.svcCtx, user, req); err != nil {
+		return nil, err
 	}
 
 	req.Username = genSubUserName(l.svcCtx.Config.RunMode, user.Index, req.Username)
@@ -76,8 +87,55 @@ func (l *CreateSubUserLogic) CreateSubUser(req *types.CreateSubUserReq) (resp *t
 		return nil, fmt.Errorf("user %s already exist", req.Username)
 	}
 
+	op := &model.PendingOp{
+		Kind:              model.PendingOpCreate,
+		UserID:            user.UUID,
+		SubUsername:       req.Username,
+		MaxBandwidthLimit: req.MaxBandwidthLimit,
+		TotalTrafficLimit: req.TotalTrafficLimit,
+	}
+	if err := model.BeginPendingOp(l.svcCtx.Redis, op); err != nil {
+		return nil, err
+	}
+
+	if err := model.ReserveQuota(l.ctx, l.svcCtx.Redis, user.UUID, req.MaxBandwidthLimit, req.TotalTrafficLimit, op.SubUsername); err != nil {
+		if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+			logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+		}
+		return nil, err
+	}
+	op.QuotaReserved = true
+
+	return l.create(user, req, op)
+}
+
+// checkCreateSubUserReq check the options shared by the sub users to create
+func checkCreateSubUserReq(svcCtx *svc.ServiceContext, user *model.User, req *types.CreateSubUserReq) error {
+	if err := model.CheckPeriod(req.PeriodType, req.PeriodDays, req.RenewMode); err != nil {
+		return err
+	}
+
+	if err := checkQuotaLimit(req.MaxBandwidthLimit, req.TotalTrafficLimit); err != nil {
+		return err
+	}
+
+	if req.Route == nil {
+		req.Route = &types.Route{Mode: constant.RouteModeCustom}
+	}
+
+	if err := checkRoute(req.Route); err != nil {
+		return err
+	}
+
+	return checkRateLimit(svcCtx, user, req.UploadRateLimit, req.DownloadRateLimit)
+}
+
+// create the sub user on the IPPM server and save it, the quota of op must be reserved
+func (l *CreateSubUserLogic) create(user *model.User, req *types.CreateSubUserReq, op *model.PendingOp) (*types.SubUser, error) {
 	createUserResp, err := l.createSubUser(req)
 	if err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionCreateSubUser, user.UUID, req.Username, nil, nil, err)
+		l.rollback(op)
 		return nil, err
 	}
 
@@ -91,76 +149,79 @@ func (l *CreateSubUserLogic) CreateSubUser(req *types.CreateSubUserReq) (resp *t
 		DownloadRateLimit: createUserResp.DownloadRateLimit,
 		CreateTime:        createUserResp.CreateTime,
 		Status:            createUserResp.Status,
+		StartTime:         createUserResp.StartTime,
+		EndTime:           createUserResp.EndTime,
+		PeriodAnchor:      createUserResp.StartTime,
 		UserID:            user.UUID,
 		PopID:             req.PopId,
+		PeriodType:        req.PeriodType,
+		PeriodDays:        req.PeriodDays,
+		RenewMode:         req.RenewMode,
+	}
+	setSubUserRoute(subUser, createUserResp.Route)
+
+	// the password only return once
+	if !l.svcCtx.Config.Password.Store {
+		subUser.Password = ""
+	}
+
+	// a deleted sub user may have the same name, not inherit its history
+	if err := model.ClearHistorySubUser(l.ctx, l.svcCtx.Redis, user.UUID, subUser.Username); err != nil {
+		logx.Errorf("clear history of sub user %s failed:%v", subUser.Username, err)
 	}
 
 	if err := model.SaveSubUser(l.svcCtx.Redis, subUser); err != nil {
+		l.rollback(op)
 		return nil, err
 	}
 
-	if err := model.AddSubUserToList(l.svcCtx.Redis, autCtxValue.UserId, subUser.Username); err != nil {
+	if err := model.AddSubUserToList(l.svcCtx.Redis, user.UUID, subUser.Username); err != nil {
+		l.rollback(op)
 		return nil, err
 	}
 
-	if err := model.SaveUser(l.svcCtx.Redis, user); err != nil {
-		return nil, err
+	// the retrier will find the sub user complete if remove failed
+	if err := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); err != nil {
+		logx.Errorf("remove pending op %s failed:%v", op.SubUsername, err)
 	}
 
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionCreateSubUser, user.UUID, subUser.Username, nil, subUser, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserCreated, user.UUID, subUser.Username, eventReasonUser)
 	return createUserResp, nil
 }
 
 func (l *CreateSubUserLogic) createSubUser(req *types.CreateSubUserReq) (resp *types.SubUser, err error) {
-	url := fmt.Sprintf("%s/user/create", l.svcCtx.Config.IPPMServer.URL)
 	createUserReq := ippmclient.CreateUserReq{
 		UserName:          req.Username,
 		Password:          req.Password,
 		PopId:             req.PopId,
-		Route:             &ippmclient.Route{Mode: constant.RouteModeCustom},
+		Route:             toIPPMRoute(req.Route),
 		UploadRateLimit:   req.UploadRateLimit,
 		DownloadRateLimit: req.DownloadRateLimit,
+		MaxBandwidthLimit: req.MaxBandwidthLimit,
 	}
 
+	now := time.Now().Unix()
 	traffic := &ippmclient.TrafficLimit{
-		StartTime:    time.Now().Unix(),
-		EndTime:      time.Now().Add(30 * 24 * time.Hour).Unix(),
+		StartTime:    now,
+		EndTime:      model.PeriodEnd(now, now, req.PeriodType, req.PeriodDays),
 		TotalTraffic: req.TotalTrafficLimit,
 	}
 	createUserReq.TrafficLimit = traffic
-	buf, err := json.Marshal(createUserReq)
-	if err != nil {
-		return nil, fmt.Errorf("marshal error %v", err)
-	}
-
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return nil, fmt.Errorf("NewRequest error %v", err)
-	}
-
-	request.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	request.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(request)
-	if err != nil {
-		return nil, fmt.Errorf("http do error %v", err)
-	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("http status code %d, error msg %s", httpResp.StatusCode, string(data))
-	}
-
-	data, err := io.ReadAll(httpResp.Body)
+	createUserResp, err := l.svcCtx.IPPMClient.CreateUser(l.ctx, &createUserReq)
 	if err != nil {
 		return nil, err
 	}
 
-	createUserResp := &ippmclient.CreateUserResp{}
-	err = json.Unmarshal(data, createUserResp)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal error %v", err)
+	// the node of manual mode may be allocated by ippm server
+	route := req.Route
+	if createUserResp.Route != nil {
+		route = &types.Route{
+			Mode:            createUserResp.Route.Mode,
+			NodeID:          createUserResp.Route.NodeID,
+			IntervalMinutes: createUserResp.Route.IntervalMinutes,
+			UtcMinuteOfDay:  createUserResp.Route.UtcMinuteOfDay,
+		}
 	}
 
 	subUser := &types.SubUser{
@@ -175,11 +236,22 @@ func (l *CreateSubUserLogic) createSubUser(req *types.CreateSubUserReq) (resp *t
 		Status:            "active",
 		StartTime:         createUserResp.TrafficLimit.StartTime,
 		EndTime:           createUserResp.TrafficLimit.EndTime,
+		PeriodType:        req.PeriodType,
+		PeriodDays:        req.PeriodDays,
+		RenewMode:         req.RenewMode,
+		Route:             route,
 	}
 
 	return subUser, nil
 }
 
+// rollback undo the creation, the retrier will do it again if failed
+func (l *CreateSubUserLogic) rollback(op *model.PendingOp) {
+	if err := saga.RollbackCreate(context.WithoutCancel(l.ctx), l.svcCtx, op); err != nil {
+		logx.Errorf("rollback create sub user %s failed:%v", op.SubUsername, err)
+	}
+}
+
 func (l *CreateSubUserLogic) getSocks5Addrss(popID string) string {
 	pop, err := l.svcCtx.PopManager.Get(popID)
 	if err == nil {
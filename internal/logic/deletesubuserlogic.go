@@ -1,14 +1,13 @@
 package logic
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/saga"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
 	"titan-ipweb/ippmclient"
@@ -49,78 +48,73 @@ func (l *DeleteSubUserLogic) DeleteSubUser(req *types.DeleteSubUserReq) error {
 		return fmt.Errorf("user %s not exist", req.Username)
 	}
 
-	if subUser.UserID != autCtxValue.UserId {
+	if subUser.UserID != autCtxValue.AccountId {
 		return fmt.Errorf("user %s not exist", req.Username)
 	}
 
 	if subUser.Status == subUserStatusDeprecated {
-		return model.RemoveSubUser(l.svcCtx.Redis, autCtxValue.UserId, req.Username)
+		if err := model.RemoveSubUser(l.svcCtx.Redis, autCtxValue.AccountId, req.Username); err != nil {
+			return err
+		}
+
+		// already deleted from the IPPM server when deprecated
+		audit.Record(l.ctx, l.svcCtx, &audit.Entry{
+			UserID:      autCtxValue.AccountId,
+			Action:      audit.ActionDeleteSubUser,
+			SubUsername: req.Username,
+			Before:      subUser,
+		})
+
+		publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserDeleted, autCtxValue.AccountId, req.Username, eventReasonUser)
+		return nil
+	}
+
+	op := &model.PendingOp{
+		Kind:              model.PendingOpDelete,
+		UserID:            autCtxValue.AccountId,
+		SubUsername:       req.Username,
+		MaxBandwidthLimit: subUser.MaxBandwidthLimit,
+		TotalTrafficLimit: subUser.TotalTrafficLimit,
+		QuotaReserved:     true,
+	}
+	if err := model.BeginPendingOp(l.svcCtx.Redis, op); err != nil {
+		return err
 	}
 
-	if err := l.deleteSubUser(req); err != nil {
+	// the edits are refused from now on, release the limits saved at last
+	if err := model.RefreshPendingOpLimits(l.svcCtx.Redis, op); err != nil {
+		if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+			logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+		}
 		return err
 	}
+	subUser.MaxBandwidthLimit = op.MaxBandwidthLimit
+	subUser.TotalTrafficLimit = op.TotalTrafficLimit
 
-	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.UserId)
-	if err != nil {
+	if err := l.deleteSubUser(req); err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionDeleteSubUser, autCtxValue.AccountId, req.Username, subUser, subUser, err)
+		// nothing changed if the ippm server refused, otherwise let the retrier finish it
+		if saga.IsRejected(err) {
+			if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+				logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+			}
+		}
 		return err
 	}
 
-	user.MaxBandwidthAllocated -= subUser.MaxBandwidthLimit
-	user.TotalTrafficAllocated -= subUser.TotalTrafficLimit
-
-	if err := model.SaveUser(l.svcCtx.Redis, user); err != nil {
+	if err := saga.FinishDelete(context.WithoutCancel(l.ctx), l.svcCtx, op); err != nil {
 		return err
 	}
 
-	return model.RemoveSubUser(l.svcCtx.Redis, autCtxValue.UserId, req.Username)
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionDeleteSubUser, autCtxValue.AccountId, req.Username, subUser, nil, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserDeleted, autCtxValue.AccountId, req.Username, eventReasonUser)
+	return nil
 }
 
 func (l *DeleteSubUserLogic) deleteSubUser(req *types.DeleteSubUserReq) error {
-	url := fmt.Sprintf("%s/user/delete", l.svcCtx.Config.IPPMServer.URL)
 	deleteUserReq := ippmclient.DeleteUserReq{
 		UserName: req.Username,
 	}
 
-	buf, err := json.Marshal(deleteUserReq)
-	if err != nil {
-		return err
-	}
-
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	request.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		return fmt.Errorf("http status code %d, error msg %s", httpResp.StatusCode, string(data))
-	}
-
-	data, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return err
-	}
-
-	userOperationResp := &ippmclient.UserOperationResp{}
-	err = json.Unmarshal(data, userOperationResp)
-	if err != nil {
-		return err
-	}
-
-	if !userOperationResp.Success {
-		return fmt.Errorf(userOperationResp.ErrMsg)
-	}
-
-	return nil
+	return l.svcCtx.IPPMClient.DeleteUser(l.ctx, &deleteUserReq)
 }
@@ -1,15 +1,14 @@
 package logic
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"time"
 
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/saga"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
 	"titan-ipweb/ippmclient"
@@ -50,7 +49,7 @@ func (l *DeprecatedSubUserLogic) DeprecatedSubUser(req *types.DeprecatedSubUserR
 		return fmt.Errorf("sub user %s not exist", req.Username)
 	}
 
-	if subUser.UserID != autCtxValue.UserId {
+	if subUser.UserID != autCtxValue.AccountId {
 		return fmt.Errorf("sub user %s not exist", req.Username)
 	}
 
@@ -58,76 +57,55 @@ func (l *DeprecatedSubUserLogic) DeprecatedSubUser(req *types.DeprecatedSubUserR
 		return fmt.Errorf("sub user already deprecated")
 	}
 
-	if err := l.deprecatedSubUser(req); err != nil {
+	op := &model.PendingOp{
+		Kind:              model.PendingOpDeprecate,
+		UserID:            autCtxValue.AccountId,
+		SubUsername:       req.Username,
+		MaxBandwidthLimit: subUser.MaxBandwidthLimit,
+		TotalTrafficLimit: subUser.TotalTrafficLimit,
+		QuotaReserved:     true,
+	}
+	if err := model.BeginPendingOp(l.svcCtx.Redis, op); err != nil {
 		return err
 	}
 
-	if err := model.AddSubUserToDeprecatedList(l.svcCtx.Redis, autCtxValue.UserId, req.Username); err != nil {
+	// the edits are refused from now on, release the limits saved at last
+	if err := model.RefreshPendingOpLimits(l.svcCtx.Redis, op); err != nil {
+		if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+			logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+		}
 		return err
 	}
+	subUser.MaxBandwidthLimit = op.MaxBandwidthLimit
+	subUser.TotalTrafficLimit = op.TotalTrafficLimit
 
-	subUser.Status = subUserStatusDeprecated
-	subUser.DeprecatedTime = time.Now().Unix()
-	if err := model.SaveSubUser(l.svcCtx.Redis, subUser); err != nil {
+	if err := l.deprecatedSubUser(req); err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionDeprecateSubUser, autCtxValue.AccountId, req.Username, subUser, subUser, err)
+		// nothing changed if the ippm server refused, otherwise let the retrier finish it
+		if saga.IsRejected(err) {
+			if e := model.RemovePendingOp(l.svcCtx.Redis, op.SubUsername); e != nil {
+				logx.Errorf("remove pending op %s failed:%v", op.SubUsername, e)
+			}
+		}
 		return err
 	}
 
-	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.UserId)
-	if err != nil {
+	if err := saga.FinishDeprecate(context.WithoutCancel(l.ctx), l.svcCtx, op); err != nil {
 		return err
 	}
 
-	user.MaxBandwidthAllocated -= subUser.MaxBandwidthLimit
-	user.TotalTrafficAllocated -= subUser.TotalTrafficLimit
-
-	return model.SaveUser(l.svcCtx.Redis, user)
+	after := *subUser
+	after.Status = subUserStatusDeprecated
+	after.DeprecatedTime = time.Now().Unix()
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionDeprecateSubUser, autCtxValue.AccountId, req.Username, subUser, &after, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserDeprecated, autCtxValue.AccountId, req.Username, eventReasonUser)
+	return nil
 }
 
 func (l *DeprecatedSubUserLogic) deprecatedSubUser(req *types.DeprecatedSubUserReq) error {
-	url := fmt.Sprintf("%s/user/delete", l.svcCtx.Config.IPPMServer.URL)
 	deleteUserReq := ippmclient.DeleteUserReq{
 		UserName: req.Username,
 	}
 
-	buf, err := json.Marshal(deleteUserReq)
-	if err != nil {
-		return err
-	}
-
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	request.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		return fmt.Errorf("http status code %d, error msg %s", httpResp.StatusCode, string(data))
-	}
-
-	data, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return err
-	}
-
-	userOperationResp := &ippmclient.UserOperationResp{}
-	err = json.Unmarshal(data, userOperationResp)
-	if err != nil {
-		return err
-	}
-
-	if !userOperationResp.Success {
-		return fmt.Errorf(userOperationResp.ErrMsg)
-	}
-
-	return nil
+	return l.svcCtx.IPPMClient.DeleteUser(l.ctx, &deleteUserReq)
 }
@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type EditRenewalPolicyLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 修改子账户流量周期与续期策略
+func NewEditRenewalPolicyLogic(ctx context.Context, svcCtx *svc.ServiceContext) *EditRenewalPolicyLogic {
+	return &EditRenewalPolicyLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *EditRenewalPolicyLogic) EditRenewalPolicy(req *types.EditRenewalPolicyReq) error {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return fmt.Errorf("auth failed")
+	}
+
+	if err := model.CheckPeriod(req.PeriodType, req.PeriodDays, req.RenewMode); err != nil {
+		return err
+	}
+
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
+	if err != nil {
+		return err
+	}
+
+	if subUser == nil || subUser.UserID != autCtxValue.AccountId {
+		return fmt.Errorf("sub user %s not exist", req.Username)
+	}
+
+	if subUser.Status == subUserStatusDeprecated {
+		return fmt.Errorf("sub user %s already deprecated", req.Username)
+	}
+
+	before := *subUser
+
+	fields := []string{"end_time", "period_type", "period_days", "renew_mode", "period_anchor"}
+
+	// the current period restart from its begin with the new period type
+	if subUser.StartTime == 0 {
+		subUser.StartTime = time.Now().Unix()
+		fields = append(fields, "start_time")
+	}
+	endTime := model.PeriodEnd(subUser.StartTime, subUser.StartTime, req.PeriodType, req.PeriodDays)
+
+	ippmCalled := endTime != subUser.EndTime
+	if ippmCalled {
+		modifyUserReq := &ippmclient.ModifyUserReq{
+			UserName: subUser.Username,
+			TrafficLimit: &ippmclient.TrafficLimit{
+				StartTime:    subUser.StartTime,
+				EndTime:      endTime,
+				TotalTraffic: subUser.TotalTrafficLimit,
+			},
+		}
+		if err := l.svcCtx.IPPMClient.ModifyUser(l.ctx, modifyUserReq); err != nil {
+			auditSubUser(l.ctx, l.svcCtx, audit.ActionEditRenewalPolicy, autCtxValue.AccountId, req.Username, &before, &before, err)
+			return err
+		}
+	}
+
+	subUser.EndTime = endTime
+	subUser.PeriodAnchor = subUser.StartTime
+	subUser.PeriodType = req.PeriodType
+	subUser.PeriodDays = req.PeriodDays
+	subUser.RenewMode = req.RenewMode
+
+	if err := model.UpdateSubUserFields(l.svcCtx.Redis, subUser, fields...); err != nil {
+		return err
+	}
+
+	audit.Record(l.ctx, l.svcCtx, &audit.Entry{
+		UserID:      autCtxValue.AccountId,
+		Action:      audit.ActionEditRenewalPolicy,
+		SubUsername: req.Username,
+		Before:      &before,
+		After:       subUser,
+		IPPMCalled:  ippmCalled,
+	})
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserUpdated, autCtxValue.AccountId, req.Username, eventReasonRenewalPolicy)
+	return nil
+}
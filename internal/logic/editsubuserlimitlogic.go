@@ -1,13 +1,11 @@
 package logic
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
@@ -40,15 +38,21 @@ func (l *EditSubUserLimitLogic) EditSubUserLimit(req *types.EditSubUserLimitReq)
 		return fmt.Errorf("auth failed")
 	}
 
-	if req.MaxBandwidthLimit == nil && req.TotalTrafficLimit == nil {
-		return fmt.Errorf("bandwidth and traffic can not empty")
+	if req.MaxBandwidthLimit == nil && req.TotalTrafficLimit == nil && req.Route == nil &&
+		req.UploadRateLimit == nil && req.DownloadRateLimit == nil {
+		return fmt.Errorf("nothing to edit")
 	}
 
-	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.UserId)
-	if err != nil {
+	if err := checkEditQuotaLimit(req.MaxBandwidthLimit, req.TotalTrafficLimit); err != nil {
 		return err
 	}
 
+	if req.Route != nil {
+		if err := checkRoute(req.Route); err != nil {
+			return err
+		}
+	}
+
 	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
 	if err != nil {
 		return err
@@ -57,41 +61,106 @@ func (l *EditSubUserLimitLogic) EditSubUserLimit(req *types.EditSubUserLimitReq)
 		return fmt.Errorf("user %s not exist", req.Username)
 	}
 
-	if subUser.UserID != autCtxValue.UserId {
+	if subUser.UserID != autCtxValue.AccountId {
 		return fmt.Errorf("sub user %s not exist", req.Username)
 	}
 
+	before := *subUser
+	// only save the edited fields, the limits are saved with the quota
+	fields := make([]string, 0)
 	if req.MaxBandwidthLimit != nil {
-		user.MaxBandwidthAllocated = user.MaxBandwidthAllocated + (*req.MaxBandwidthLimit - subUser.MaxBandwidthLimit)
 		subUser.MaxBandwidthLimit = *req.MaxBandwidthLimit
 	}
 
 	if req.TotalTrafficLimit != nil {
-		user.TotalTrafficAllocated = user.TotalTrafficAllocated + (*req.TotalTrafficLimit - subUser.TotalTrafficLimit)
 		subUser.TotalTrafficLimit = *req.TotalTrafficLimit
 	}
 
-	if user.MaxBandwidthAllocated > user.MaxBandwidthLimit {
-		return fmt.Errorf("cannot allocate more than the maximum bandwidth")
+	if req.Route != nil {
+		setSubUserRoute(subUser, req.Route)
+		fields = append(fields, "route_mode", "route_node_id", "route_interval_minutes", "route_utc_minute_of_day")
 	}
 
-	if user.TotalTrafficAllocated > user.TotalTrafficLimit {
-		return fmt.Errorf("cannot allocate more than the maximum traffic")
+	if req.UploadRateLimit != nil || req.DownloadRateLimit != nil {
+		if req.UploadRateLimit != nil {
+			subUser.UploadRateLimit = *req.UploadRateLimit
+			fields = append(fields, "upload_rate_limit")
+		}
+		if req.DownloadRateLimit != nil {
+			subUser.DownloadRateLimit = *req.DownloadRateLimit
+			fields = append(fields, "download_rate_limit")
+		}
+
+		user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("user not exist, please login again")
+		}
+
+		if err := checkRateLimit(l.svcCtx, user, subUser.UploadRateLimit, subUser.DownloadRateLimit); err != nil {
+			return err
+		}
 	}
 
-	if err := l.editSubUserLimit(req, subUser); err != nil {
-		return err
+	// the edited limits replace the throttled rate limit, the bandwidth checker throttle again if still exceed
+	if subUser.Throttled && (req.MaxBandwidthLimit != nil || req.UploadRateLimit != nil || req.DownloadRateLimit != nil) {
+		subUser.Throttled = false
+		subUser.ThrottledUploadRateLimit = 0
+		subUser.ThrottledDownloadRateLimit = 0
+		fields = append(fields, "throttled", "throttled_upload_rate_limit", "throttled_download_rate_limit")
+	}
+
+	// the delta is counted from the limits in redis, not the ones read above
+	limit := model.QuotaLimit{Bandwidth: req.MaxBandwidthLimit, Traffic: req.TotalTrafficLimit}
+	if limit.Bandwidth != nil || limit.Traffic != nil {
+		bandwidth, traffic, err := model.SetSubUserQuota(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, req.Username, limit, model.QuotaLimit{})
+		if err != nil {
+			return err
+		}
+		before.MaxBandwidthLimit = bandwidth
+		before.TotalTrafficLimit = traffic
 	}
 
-	if err := model.SaveSubUser(l.svcCtx.Redis, subUser); err != nil {
+	if err := l.editSubUserLimit(req, subUser, before.Throttled && !subUser.Throttled); err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionEditLimit, autCtxValue.AccountId, req.Username, &before, &before, err)
+		l.revertQuota(autCtxValue.AccountId, &before, limit)
 		return err
 	}
 
-	return model.SaveUser(l.svcCtx.Redis, user)
+	if len(fields) > 0 {
+		if err := model.UpdateSubUserFields(l.svcCtx.Redis, subUser, fields...); err != nil {
+			return err
+		}
+	}
+
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionEditLimit, autCtxValue.AccountId, req.Username, &before, subUser, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserUpdated, autCtxValue.AccountId, req.Username, eventReasonLimit)
+	return nil
 }
 
-func (l *EditSubUserLimitLogic) editSubUserLimit(req *types.EditSubUserLimitReq, subUser *model.SubUser) error {
-	url := fmt.Sprintf("%s/user/modify", l.svcCtx.Config.IPPMServer.URL)
+// revertQuota give back the limits if the IPPM server not take them, unless another edit changed them meanwhile
+func (l *EditSubUserLimitLogic) revertQuota(uuid string, before *model.SubUser, limit model.QuotaLimit) {
+	if limit.Bandwidth == nil && limit.Traffic == nil {
+		return
+	}
+
+	old := model.QuotaLimit{}
+	if limit.Bandwidth != nil {
+		old.Bandwidth = &before.MaxBandwidthLimit
+	}
+	if limit.Traffic != nil {
+		old.Traffic = &before.TotalTrafficLimit
+	}
+
+	if _, _, err := model.SetSubUserQuota(l.ctx, l.svcCtx.Redis, uuid, before.Username, old, limit); err != nil {
+		logx.Errorf("revert quota of sub user %s failed:%v", before.Username, err)
+	}
+}
+
+// editSubUserLimit modify the sub user on IPPM server, unthrottle send the configured rate limit to replace the throttled
+func (l *EditSubUserLimitLogic) editSubUserLimit(req *types.EditSubUserLimitReq, subUser *model.SubUser, unthrottle bool) error {
 	modifyUserReq := ippmclient.ModifyUserReq{
 		UserName: req.Username,
 	}
@@ -104,33 +173,17 @@ func (l *EditSubUserLimitLogic) editSubUserLimit(req *types.EditSubUserLimitReq,
 		modifyUserReq.TrafficLimit = &trafficLimit
 	}
 
-	buf, err := json.Marshal(modifyUserReq)
-	if err != nil {
-		return fmt.Errorf("marshal error %v", err)
-	}
-
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return fmt.Errorf("NewRequest error %v", err)
+	if req.Route != nil {
+		modifyUserReq.Route = toIPPMRoute(req.Route)
 	}
 
-	request.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	request.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(request)
-	if err != nil {
-		return fmt.Errorf("http do error %v", err)
+	modifyUserReq.UploadRateLimit = req.UploadRateLimit
+	modifyUserReq.DownloadRateLimit = req.DownloadRateLimit
+	if unthrottle {
+		modifyUserReq.UploadRateLimit = &subUser.UploadRateLimit
+		modifyUserReq.DownloadRateLimit = &subUser.DownloadRateLimit
 	}
-	defer httpResp.Body.Close()
+	modifyUserReq.MaxBandwidthLimit = req.MaxBandwidthLimit
 
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		if len(data) != 0 {
-			return fmt.Errorf("%s", string(data))
-		}
-		return fmt.Errorf("ip manager server response status code %d", httpResp.StatusCode)
-	}
-
-	return nil
+	return l.svcCtx.IPPMClient.ModifyUser(l.ctx, &modifyUserReq)
 }
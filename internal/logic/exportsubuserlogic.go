@@ -0,0 +1,192 @@
+package logic
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+	// sub users read from redis each time
+	exportPageSize = 500
+)
+
+type ExportSubUserLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+	w      http.ResponseWriter
+}
+
+// proxyCredential is a line of the proxy list
+type proxyCredential struct {
+	Proxy    string `json:"proxy"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Status   string `json:"status"`
+}
+
+// 导出所有子账户的代理列表，格式为host:port:user:pass，包含密码，api key需要manage权限
+func NewExportSubUserLogic(ctx context.Context, svcCtx *svc.ServiceContext, w http.ResponseWriter) *ExportSubUserLogic {
+	return &ExportSubUserLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+		w:      w,
+	}
+}
+
+func (l *ExportSubUserLogic) ExportSubUser(req *types.ExportSubUserReq) error {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return fmt.Errorf("auth failed")
+	}
+
+	if req.Format != exportFormatCSV && req.Format != exportFormatJSON {
+		return fmt.Errorf("unsupported format %s", req.Format)
+	}
+
+	// read the first page before writing, so the error can still return as json
+	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, 0, exportPageSize-1)
+	if err != nil {
+		return err
+	}
+
+	l.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=subusers.%s", req.Format))
+	if req.Format == exportFormatCSV {
+		l.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		l.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	l.w.WriteHeader(http.StatusOK)
+
+	writer := newExportWriter(l.w, req.Format)
+	if err := writer.begin(); err != nil {
+		logx.Errorf("write export of user %s failed:%v", autCtxValue.AccountId, err)
+		return nil
+	}
+
+	for start := 0; ; start += exportPageSize {
+		if start > 0 {
+			subUsers, err = model.GetSubUsers(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, start, start+exportPageSize-1)
+			if err != nil {
+				// the response is started, can only cut it off
+				logx.Errorf("export sub users of user %s failed:%v", autCtxValue.AccountId, err)
+				return nil
+			}
+		}
+
+		for _, subUser := range subUsers {
+			// the deprecated credential can not be used anymore
+			if subUser.Status == constant.SubUserStatusDeprecated {
+				continue
+			}
+			if err := writer.write(toProxyCredential(subUser)); err != nil {
+				logx.Errorf("write export of user %s failed:%v", autCtxValue.AccountId, err)
+				return nil
+			}
+		}
+
+		if len(subUsers) < exportPageSize {
+			break
+		}
+	}
+
+	if err := writer.end(); err != nil {
+		logx.Errorf("write export of user %s failed:%v", autCtxValue.AccountId, err)
+	}
+	return nil
+}
+
+func toProxyCredential(subUser *model.SubUser) *proxyCredential {
+	host, port, err := net.SplitHostPort(subUser.ServerAddress)
+	if err != nil {
+		host = subUser.ServerAddress
+	}
+
+	return &proxyCredential{
+		Proxy:    fmt.Sprintf("%s:%s:%s:%s", host, port, subUser.Username, subUser.Password),
+		Host:     host,
+		Port:     port,
+		Username: subUser.Username,
+		Password: subUser.Password,
+		Status:   subUser.Status,
+	}
+}
+
+// exportWriter write the credentials one by one, so the whole list is never in memory
+type exportWriter struct {
+	w      http.ResponseWriter
+	format string
+	csv    *csv.Writer
+	count  int
+}
+
+func newExportWriter(w http.ResponseWriter, format string) *exportWriter {
+	writer := &exportWriter{w: w, format: format}
+	if format == exportFormatCSV {
+		writer.csv = csv.NewWriter(w)
+	}
+	return writer
+}
+
+// begin write the csv header or the start of json array
+func (e *exportWriter) begin() error {
+	if e.format == exportFormatCSV {
+		return e.csv.Write([]string{"proxy", "host", "port", "username", "password", "status"})
+	}
+
+	_, err := fmt.Fprint(e.w, "[")
+	return err
+}
+
+func (e *exportWriter) write(c *proxyCredential) error {
+	defer func() { e.count++ }()
+
+	if e.format == exportFormatCSV {
+		if err := e.csv.Write([]string{c.Proxy, c.Host, c.Port, c.Username, c.Password, c.Status}); err != nil {
+			return err
+		}
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		if _, err := fmt.Fprint(e.w, ","); err != nil {
+			return err
+		}
+	}
+	_, err = e.w.Write(buf)
+	return err
+}
+
+func (e *exportWriter) end() error {
+	if e.format == exportFormatCSV {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+
+	_, err := fmt.Fprint(e.w, "]")
+	return err
+}
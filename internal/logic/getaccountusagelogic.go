@@ -0,0 +1,57 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetAccountUsageLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取账户流量消耗
+func NewGetAccountUsageLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetAccountUsageLogic {
+	return &GetAccountUsageLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *GetAccountUsageLogic) GetAccountUsage() (resp *types.AccountUsageResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not exist, please login again")
+	}
+
+	return toAccountUsage(user), nil
+}
+
+func toAccountUsage(user *model.User) *types.AccountUsageResponse {
+	return &types.AccountUsageResponse{
+		TrafficConsumed:   user.TrafficConsumed,
+		TotalTrafficLimit: user.TotalTrafficLimit,
+		BillingStart:      user.BillingStart,
+		BillingEnd:        user.BillingEnd,
+		Suspended:         user.Suspended,
+	}
+}
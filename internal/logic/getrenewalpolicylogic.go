@@ -0,0 +1,54 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetRenewalPolicyLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取子账户流量周期与续期策略
+func NewGetRenewalPolicyLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetRenewalPolicyLogic {
+	return &GetRenewalPolicyLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *GetRenewalPolicyLogic) GetRenewalPolicy(req *types.GetRenewalPolicyReq) (resp *types.RenewalPolicy, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if subUser == nil || subUser.UserID != autCtxValue.AccountId {
+		return nil, fmt.Errorf("sub user %s not exist", req.Username)
+	}
+
+	return &types.RenewalPolicy{
+		Username:   subUser.Username,
+		PeriodType: subUser.GetPeriodType(),
+		PeriodDays: subUser.PeriodDays,
+		RenewMode:  subUser.GetRenewMode(),
+		StartTime:  subUser.StartTime,
+		EndTime:    subUser.EndTime,
+	}, nil
+}
@@ -2,16 +2,11 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"sync"
 
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
-	"titan-ipweb/ippmclient"
 	"titan-ipweb/model"
 
 	"github.com/zeromicro/go-zero/core/logx"
@@ -45,145 +40,86 @@ func NewGetStatChartLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetS
 }
 
 func (l *GetStatChartLogic) GetStatChart(req *types.StatChartReq) (resp *types.StatChartResponse, err error) {
-	logx.Debugf("GetAllStatsPer5Min %#v", req)
+	logx.Debugf("GetStatChart %#v", req)
 	v := l.ctx.Value(middleware.AuthKey)
 	autCtxValue, ok := v.(middleware.AuthCtxValue)
 	if !ok {
 		return nil, fmt.Errorf("auth failed")
 	}
 
+	if req.EndTime < req.StartTime {
+		return nil, fmt.Errorf("end_time %d is before start_time %d", req.EndTime, req.StartTime)
+	}
+
+	// the buckets of the whole range, also check the type
+	resp, err = l.emptyReply(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var usernames []string
 	if req.Username != "" {
-		subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
-		if err != nil {
+		if err := l.checkSubUser(autCtxValue, req.Username); err != nil {
 			return nil, err
 		}
-
-		if subUser == nil {
-			return nil, fmt.Errorf("username %s not exist", req.Username)
+		usernames = []string{req.Username}
+	} else {
+		// include the deprecated and deleted sub users
+		usernames, err = model.GetHistorySubUsers(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		if subUser.UserID != autCtxValue.UserId {
-			return nil, fmt.Errorf("subuser username %s not exist for user %s", req.Username, autCtxValue.Email)
-		}
-		return l.getStatChartForSingleUser(req, req.Username)
+	if len(usernames) == 0 {
+		return resp, nil
 	}
 
-	usernames, err := model.GetAllSubUsername(l.svcCtx.Redis, autCtxValue.UserId)
+	step := model.HistoryStep(req.Type)
+	history, err := model.GetHistoryPoints(l.ctx, l.svcCtx.Redis, req.Type, usernames, req.StartTime/step*step, req.EndTime)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(usernames) == 0 {
-		return l.emptyReply(req)
-	}
-
-	var (
-		wg         sync.WaitGroup
-		mu         sync.Mutex
-		firstError error
-		count      int
-	)
-
-	statsMap := make(map[string]*types.StatChartResponse)
-
-	wg.Add(len(usernames))
-	for _, username := range usernames {
-		uname := username // 避免 goroutine 捕获错误变量
-		go func() {
-			defer wg.Done()
-
-			statsResp, err := l.getStatChartForSingleUser(req, username)
-			if err != nil {
-				// logx.Error("getAllStatsPer5Min failed:%v", err.Error())
-				// 只记录第一个错误
-				mu.Lock()
-				if firstError == nil {
-					firstError = fmt.Errorf("get user %s stats per 5min: %w", uname, err)
-				}
-				mu.Unlock()
-				return
-			}
-
-			mu.Lock()
-			statsMap[uname] = statsResp
-			count = len(statsResp.Stats)
-			mu.Unlock()
-		}()
+	buckets := make(map[int64]*types.StatPoint, len(resp.Stats))
+	for _, stat := range resp.Stats {
+		buckets[stat.Timestamp] = stat
 	}
 
-	// 等待全部 goroutine 结束
-	wg.Wait()
-
-	if firstError != nil {
-		return nil, firstError
-	}
-
-	stats := make([]*types.StatPoint, 0, count)
-	for i := 0; i < int(count); i++ {
-		stat := &types.StatPoint{}
-		for _, statsResp := range statsMap {
-			s := statsResp.Stats[i]
-
-			stat.Bandwidth += s.Bandwidth
-			stat.Traffic += s.Traffic
-
-			if s.Timestamp != 0 {
-				stat.Timestamp = s.Timestamp
+	for _, points := range history {
+		for _, point := range points {
+			stat, ok := buckets[point.Timestamp]
+			if !ok {
+				continue
 			}
+			stat.Bandwidth += point.Bandwidth
+			stat.Traffic += point.Traffic
 		}
-
-		stats = append(stats, stat)
-
 	}
 
-	return &types.StatChartResponse{Stats: stats}, nil
-
+	return resp, nil
 }
 
-func (l *GetStatChartLogic) getStatChartForSingleUser(req *types.StatChartReq, username string) (resp *types.StatChartResponse, err error) {
-	url := fmt.Sprintf("%s/user/stats/chart?type=%s&username=%s&start_time=%d&end_time=%d", l.svcCtx.Config.IPPMServer.URL, req.Type, username, req.StartTime, req.EndTime)
-
-	client := &http.Client{}
-	httpReq, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(httpReq)
+// checkSubUser check the sub user belong to the account, the deleted one is checked by its history
+func (l *GetStatChartLogic) checkSubUser(autCtxValue middleware.AuthCtxValue, username string) error {
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, username)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer httpResp.Body.Close()
 
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		if len(data) > 0 {
-			return nil, fmt.Errorf("%s", string(data))
-		}
-		return nil, fmt.Errorf("http status code %d", httpResp.StatusCode)
+	if subUser != nil && subUser.UserID == autCtxValue.AccountId {
+		return nil
 	}
 
-	data, err := io.ReadAll(httpResp.Body)
+	ok, err := model.IsHistorySubUser(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, username)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	statsResp := &ippmclient.StatsResp{}
-	err = json.Unmarshal(data, statsResp)
-	if err != nil {
-		return nil, err
-	}
-
-	stats := make([]*types.StatPoint, 0, len(statsResp.Stats))
-	for _, statPonint := range statsResp.Stats {
-		stat := &types.StatPoint{Timestamp: statPonint.Timestamp, Bandwidth: statPonint.Bandwidth, Traffic: statPonint.Traffic}
-		stats = append(stats, stat)
+	if !ok {
+		return fmt.Errorf("subuser username %s not exist for user %s", username, autCtxValue.Email)
 	}
-
-	return &types.StatChartResponse{Stats: stats}, nil
+	return nil
 }
 
 func (l *GetStatChartLogic) emptyReply(req *types.StatChartReq) (resp *types.StatChartResponse, err error) {
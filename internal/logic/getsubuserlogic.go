@@ -0,0 +1,78 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetSubUserLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取子账户详情
+func NewGetSubUserLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetSubUserLogic {
+	return &GetSubUserLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *GetSubUserLogic) GetSubUser(req *types.GetSubUserReq) (resp *types.SubUserDetail, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if subUser == nil || subUser.UserID != autCtxValue.AccountId {
+		return nil, fmt.Errorf("sub user %s not exist", req.Username)
+	}
+
+	resp = &types.SubUserDetail{SubUser: toSubUser(l.svcCtx, subUser)}
+
+	// deprecated sub user already delete from ippm server
+	if subUser.Status == subUserStatusDeprecated {
+		return resp, nil
+	}
+
+	getUserResp, err := l.svcCtx.IPPMClient.GetUser(l.ctx, &ippmclient.GetUserReq{UserName: req.Username})
+	if err != nil {
+		return nil, err
+	}
+
+	resp.NodeIP = getUserResp.NodeIP
+	resp.NodeOnline = getUserResp.NodeOnline
+	resp.Off = getUserResp.Off
+	resp.LastRouteSwitchTime = getUserResp.LastRouteSwitchTime
+	resp.SubUser.CurrentTraffic = getUserResp.CurrentTraffic
+
+	baseStats, err := l.svcCtx.IPPMClient.GetUserBaseStats(l.ctx, &ippmclient.UserBaseStatsReq{Username: req.Username})
+	if err != nil {
+		// the detail is still useful without stats
+		logx.Errorf("get base stats of sub user %s failed:%v", req.Username, err)
+		return resp, nil
+	}
+
+	resp.CurrentBandwidth = baseStats.CurrentBandwidth
+	resp.TopBandwidth = baseStats.TopBandwidth
+	resp.CurrentConns = baseStats.CurrentConns
+	resp.SubUser.CurrentTraffic = baseStats.TotalTraffic
+
+	return resp, nil
+}
@@ -2,16 +2,11 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"sync"
 
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
-	"titan-ipweb/ippmclient"
 	"titan-ipweb/model"
 
 	"github.com/zeromicro/go-zero/core/logx"
@@ -39,13 +34,13 @@ func (l *GetSubUserUsageLogic) GetSubUserUsage() (resp *types.GetSubUserUsageRes
 		return nil, fmt.Errorf("auth failed")
 	}
 
-	deprecatedCount, err := model.DeprecatedSubUserCount(l.svcCtx.Redis, autCtxValue.UserId)
+	deprecatedCount, err := model.DeprecatedSubUserCount(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
 
 	// TODO: need to limit subuser number
-	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, autCtxValue.UserId, 0, -1)
+	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId, 0, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -72,16 +67,13 @@ func (l *GetSubUserUsageLogic) GetSubUserUsage() (resp *types.GetSubUserUsageRes
 	}
 
 	// 获取所有用户当前的流量
-	baseStatsRespMap, err := l.getBaseStatsForUsers(usernames)
-	if err != nil {
-		return nil, err
-	}
+	baseStats := l.svcCtx.Stats.BaseStats(l.ctx, usernames)
 
 	totalTraffic := int64(0)
 	totalCurrentBandwidth := int64(0)
 
 	for _, user := range sUsers {
-		baseStatsResp, ok := baseStatsRespMap[user.Username]
+		baseStatsResp, ok := baseStats.Stats[user.Username]
 		if ok {
 			user.CurrentBandwidth = baseStatsResp.CurrentBandwidth
 			user.TrafficUsed = baseStatsResp.TotalTraffic
@@ -97,71 +89,6 @@ func (l *GetSubUserUsageLogic) GetSubUserUsage() (resp *types.GetSubUserUsageRes
 		Count:                 subUserCount,
 		TotalTrafficUsed:      totalTraffic,
 		TotalCurrentBandwidth: totalCurrentBandwidth,
+		StatsFailed:           baseStats.FailedUsernames(),
 	}, nil
 }
-
-func (l *GetSubUserUsageLogic) getBaseStatsForUsers(usernames []string) (map[string]*ippmclient.UserBaseStatsResp, error) {
-	// 用waitgroup 拉取所有用户的基础统计
-	statsMap := make(map[string]*ippmclient.UserBaseStatsResp)
-	mu := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	wg.Add(len(usernames))
-	for _, username := range usernames {
-		uname := username // 避免 goroutine 捕获错误变量
-		go func() {
-			defer wg.Done()
-
-			statsResp, err := l.getUserBaseStats(uname)
-			if err != nil {
-				return
-			}
-
-			mu.Lock()
-			statsMap[uname] = statsResp
-			mu.Unlock()
-		}()
-	}
-
-	wg.Wait()
-	return statsMap, nil
-}
-
-func (l *GetSubUserUsageLogic) getUserBaseStats(username string) (resp *ippmclient.UserBaseStatsResp, err error) {
-	url := fmt.Sprintf("%s/user/stats/base?username=%s", l.svcCtx.Config.IPPMServer.URL, username)
-
-	client := &http.Client{}
-	httpReq, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(httpReq)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		if len(data) > 0 {
-			return nil, fmt.Errorf("%s", string(data))
-		}
-		return nil, fmt.Errorf("http status code %d", httpResp.StatusCode)
-	}
-
-	data, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	baseStatsResp := &ippmclient.UserBaseStatsResp{}
-	err = json.Unmarshal(data, baseStatsResp)
-	if err != nil {
-		return nil, err
-	}
-
-	return baseStatsResp, nil
-}
@@ -34,7 +34,7 @@ func (l *GetTotalQuotaLogic) GetTotalQuota() (resp *types.GetTotalQuotaResponse,
 		return nil, fmt.Errorf("auth failed")
 	}
 
-	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.UserId)
+	user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
@@ -43,17 +43,22 @@ func (l *GetTotalQuotaLogic) GetTotalQuota() (resp *types.GetTotalQuotaResponse,
 		return nil, fmt.Errorf("user not exist, please login again")
 	}
 
-	subUserCount, err := model.SubUserCount(l.svcCtx.Redis, autCtxValue.UserId)
+	subUserCount, err := model.SubUserCount(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
 
+	return toTotalQuota(l.svcCtx, user, subUserCount), nil
+}
+
+func toTotalQuota(svcCtx *svc.ServiceContext, user *model.User, subUserCount int) *types.GetTotalQuotaResponse {
 	return &types.GetTotalQuotaResponse{
-			TotalBandwidthLimit:     user.MaxBandwidthLimit,
-			TotalBandwidthAllocated: user.MaxBandwidthAllocated,
-			TotalTrafficLimit:       user.TotalTrafficLimit,
-			TotalTrafficAllocated:   user.TotalTrafficAllocated,
-			SubUserCount:            int64(subUserCount),
-		},
-		nil
+		TotalBandwidthLimit:     user.MaxBandwidthLimit,
+		TotalBandwidthAllocated: user.MaxBandwidthAllocated,
+		TotalTrafficLimit:       user.TotalTrafficLimit,
+		TotalTrafficAllocated:   user.TotalTrafficAllocated,
+		SubUserCount:            int64(subUserCount),
+		MaxUploadRateLimit:      rateLimitCeiling(user.MaxUploadRateLimit, svcCtx.Config.Quota.MaxUploadRateLimit),
+		MaxDownloadRateLimit:    rateLimitCeiling(user.MaxDownloadRateLimit, svcCtx.Config.Quota.MaxDownloadRateLimit),
+	}
 }
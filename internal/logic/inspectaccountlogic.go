@@ -0,0 +1,65 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type InspectAccountLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 查看任意账户，只读
+func NewInspectAccountLogic(ctx context.Context, svcCtx *svc.ServiceContext) *InspectAccountLogic {
+	return &InspectAccountLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *InspectAccountLogic) InspectAccount(req *types.InspectAccountReq) (resp *types.InspectAccountResponse, err error) {
+	user, err := model.GetUser(l.svcCtx.Redis, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user %s not exist", req.UserId)
+	}
+
+	total, err := model.SubUserCount(l.svcCtx.Redis, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	subUsers, err := model.GetSubUsers(l.ctx, l.svcCtx.Redis, req.UserId, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*types.SubUser, 0, len(subUsers))
+	for _, subUser := range subUsers {
+		user := toSubUser(l.svcCtx, subUser)
+		// support staff should not see the password
+		user.Password = ""
+		users = append(users, user)
+	}
+
+	return &types.InspectAccountResponse{
+		UserId:   user.UUID,
+		Email:    user.Email,
+		Quota:    toTotalQuota(l.svcCtx, user, total),
+		Usage:    toAccountUsage(user),
+		SubUsers: users,
+		Total:    total,
+	}, nil
+}
@@ -34,12 +34,12 @@ func (l *ListDeprecatedSubUserLogic) ListDeprecatedSubUser(req *types.ListDeprec
 		return nil, fmt.Errorf("auth failed")
 	}
 
-	total, err := model.DeprecatedSubUserCount(l.svcCtx.Redis, autCtxValue.UserId)
+	total, err := model.DeprecatedSubUserCount(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
 
-	subUsers, err := model.GetDeprecatedSubUsers(context.Background(), l.svcCtx.Redis, autCtxValue.UserId, req.Start, req.End)
+	subUsers, err := model.GetDeprecatedSubUsers(context.Background(), l.svcCtx.Redis, autCtxValue.AccountId, req.Start, req.End)
 	if err != nil {
 		return nil, err
 	}
@@ -2,14 +2,9 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
 
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
-	"titan-ipweb/ippmclient"
 
 	"github.com/zeromicro/go-zero/core/logx"
 )
@@ -34,35 +29,7 @@ func (l *ListPopsLogic) ListPops() (resp *types.ListPopsResponse, err error) {
 }
 
 func (l *ListPopsLogic) listPops() (resp *types.ListPopsResponse, err error) {
-	url := fmt.Sprintf("%s/pops", l.svcCtx.Config.IPPMServer.URL)
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("http status code %d, error msg %s", httpResp.StatusCode, string(data))
-	}
-
-	data, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	popsResp := &ippmclient.GetPopsResp{}
-	err = json.Unmarshal(data, popsResp)
+	popsResp, err := l.svcCtx.IPPMClient.GetPops(l.ctx)
 	if err != nil {
 		return nil, err
 	}
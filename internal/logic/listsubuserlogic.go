@@ -2,21 +2,23 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"sync"
 
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
-	"titan-ipweb/ippmclient"
 	"titan-ipweb/model"
 
 	"github.com/zeromicro/go-zero/core/logx"
 )
 
+const (
+	listOrderDesc = "desc"
+	// page size of the cursor pagination
+	defaultListSize = 20
+	maxListSize     = 100
+)
+
 type ListSubUserLogic struct {
 	logx.Logger
 	ctx    context.Context
@@ -39,119 +41,96 @@ func (l *ListSubUserLogic) ListSubUser(req *types.ListSubUserReq) (resp *types.L
 		return nil, fmt.Errorf("auth failed")
 	}
 
-	total, err := model.SubUserCount(l.svcCtx.Redis, autCtxValue.UserId)
+	if l.isQuery(req) {
+		return l.query(autCtxValue.AccountId, req)
+	}
+
+	total, err := model.SubUserCount(l.svcCtx.Redis, autCtxValue.AccountId)
 	if err != nil {
 		return nil, err
 	}
 
-	subUsers, err := model.GetSubUsers(context.Background(), l.svcCtx.Redis, autCtxValue.UserId, req.Start, req.End)
+	subUsers, err := model.GetSubUsers(context.Background(), l.svcCtx.Redis, autCtxValue.AccountId, req.Start, req.End)
 	if err != nil {
 		return nil, err
 	}
 
-	usernames := make([]string, 0, len(subUsers))
-	users := make([]*types.SubUser, 0, len(subUsers))
-	for _, subUser := range subUsers {
-		user := &types.SubUser{
-			Username:          subUser.Username,
-			Password:          subUser.Password,
-			ServerAddress:     subUser.ServerAddress,
-			TotalTrafficLimit: subUser.TotalTrafficLimit,
-			MaxBandwidthLimit: subUser.MaxBandwidthLimit,
-			UploadRateLimit:   subUser.UploadRateLimit,
-			DownloadRateLimit: subUser.DownloadRateLimit,
-			CreateTime:        subUser.CreateTime,
-			Status:            subUser.Status,
-		}
+	users, failed := l.toSubUsers(subUsers)
+	return &types.ListSubUserResponse{Users: users, Total: total, StatsFailed: failed}, nil
+}
 
-		pop, err := l.svcCtx.PopManager.Get(subUser.PopID)
-		if err == nil {
-			user.AreaName = pop.Name
-		} else {
-			logx.Debugf("get pop %v", err.Error())
-		}
+// isQuery return true if the list need the filter, sort or cursor, otherwise the old Start and End are used
+func (l *ListSubUserLogic) isQuery(req *types.ListSubUserReq) bool {
+	return req.Status != "" || req.PopId != "" || req.Search != "" || req.Sort != "" ||
+		req.Order == listOrderDesc || req.Cursor != "" || req.Size > 0
+}
 
-		users = append(users, user)
-		usernames = append(usernames, subUser.Username)
+func (l *ListSubUserLogic) query(accountID string, req *types.ListSubUserReq) (*types.ListSubUserResponse, error) {
+	if req.Status != "" && req.Status != subUserStatusActive && req.Status != subUserStatusStop {
+		return nil, fmt.Errorf("status %s is not %s or %s", req.Status, subUserStatusActive, subUserStatusStop)
 	}
 
-	baseStatsMap, err := l.getBaseStatsForUsers(usernames)
-	if err != nil {
-		return nil, err
+	size := req.Size
+	if size <= 0 {
+		size = defaultListSize
 	}
-
-	for _, subUser := range users {
-		baseStats, ok := baseStatsMap[subUser.Username]
-		if ok {
-			subUser.CurrentTraffic = baseStats.TotalTraffic
-		}
+	if size > maxListSize {
+		return nil, fmt.Errorf("size can not be more than %d", maxListSize)
 	}
 
-	return &types.ListSubUserResponse{Users: users, Total: total}, nil
-}
-
-func (l *ListSubUserLogic) getBaseStatsForUsers(usernames []string) (map[string]*ippmclient.UserBaseStatsResp, error) {
-	// 用waitgroup 拉取所有用户的基础统计
-	statsMap := make(map[string]*ippmclient.UserBaseStatsResp)
-	mu := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	wg.Add(len(usernames))
-	for _, username := range usernames {
-		uname := username // 避免 goroutine 捕获错误变量
-		go func() {
-			defer wg.Done()
-
-			statsResp, err := l.getUserBaseStats(uname)
-			if err != nil {
-				return
-			}
-
-			mu.Lock()
-			statsMap[uname] = statsResp
-			mu.Unlock()
-		}()
+	query := &model.SubUserQuery{
+		Status: req.Status,
+		PopID:  req.PopId,
+		Sort:   req.Sort,
+		Desc:   req.Order == listOrderDesc,
+		Cursor: req.Cursor,
+		Limit:  size,
 	}
 
-	wg.Wait()
-	return statsMap, nil
-}
+	// the username is prefixed with the index of user
+	if req.Search != "" {
+		user, err := model.GetUser(l.svcCtx.Redis, accountID)
+		if err != nil {
+			return nil, err
+		}
 
-func (l *ListSubUserLogic) getUserBaseStats(username string) (resp *ippmclient.UserBaseStatsResp, err error) {
-	url := fmt.Sprintf("%s/user/stats/base?username=%s", l.svcCtx.Config.IPPMServer.URL, username)
+		if user == nil {
+			return nil, fmt.Errorf("user not exist, please login again")
+		}
+		query.Prefix = genSubUserName(l.svcCtx.Config.RunMode, user.Index, req.Search)
+	}
 
-	client := &http.Client{}
-	httpReq, err := http.NewRequest("GET", url, nil)
+	page, err := model.QuerySubUsers(l.ctx, l.svcCtx.Redis, accountID, query)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	httpResp, err := client.Do(httpReq)
+	subUsers, err := model.GetSubUsersByName(l.ctx, l.svcCtx.Redis, page.Usernames)
 	if err != nil {
 		return nil, err
 	}
-	defer httpResp.Body.Close()
 
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		if len(data) > 0 {
-			return nil, fmt.Errorf("%s", string(data))
-		}
-		return nil, fmt.Errorf("http status code %d", httpResp.StatusCode)
-	}
+	users, failed := l.toSubUsers(subUsers)
+	return &types.ListSubUserResponse{Users: users, Total: int(page.Total), NextCursor: page.NextCursor, StatsFailed: failed}, nil
+}
 
-	data, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, err
+// toSubUsers convert the records with the traffic used from ippm server, also return the sub users failed to get the traffic
+func (l *ListSubUserLogic) toSubUsers(subUsers []*model.SubUser) ([]*types.SubUser, []string) {
+	usernames := make([]string, 0, len(subUsers))
+	users := make([]*types.SubUser, 0, len(subUsers))
+	for _, subUser := range subUsers {
+		user := toSubUser(l.svcCtx, subUser)
+		users = append(users, user)
+		usernames = append(usernames, subUser.Username)
 	}
 
-	baseStatsResp := &ippmclient.UserBaseStatsResp{}
-	err = json.Unmarshal(data, baseStatsResp)
-	if err != nil {
-		return nil, err
+	result := l.svcCtx.Stats.BaseStats(l.ctx, usernames)
+	for _, subUser := range users {
+		baseStats, ok := result.Stats[subUser.Username]
+		if ok {
+			subUser.CurrentTraffic = baseStats.TotalTraffic
+		}
 	}
 
-	return baseStatsResp, nil
+	return users, result.FailedUsernames()
 }
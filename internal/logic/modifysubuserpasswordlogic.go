@@ -0,0 +1,82 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ModifySubUserPasswordLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 修改子账户密码，密码为空时随机生成
+func NewModifySubUserPasswordLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ModifySubUserPasswordLogic {
+	return &ModifySubUserPasswordLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ModifySubUserPasswordLogic) ModifySubUserPassword(req *types.ModifySubUserPasswordReq) (resp *types.ModifySubUserPasswordResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if subUser == nil || subUser.UserID != autCtxValue.AccountId {
+		return nil, fmt.Errorf("sub user %s not exist", req.Username)
+	}
+
+	if subUser.Status == subUserStatusDeprecated {
+		return nil, fmt.Errorf("sub user %s already deprecated", req.Username)
+	}
+
+	password := req.Password
+	if password == "" {
+		if password, err = genPassword(l.svcCtx.Config.Password.Length); err != nil {
+			return nil, err
+		}
+	} else if err := checkPassword(password); err != nil {
+		return nil, err
+	}
+
+	before := *subUser
+	err = l.svcCtx.IPPMClient.ModifyUserPassword(l.ctx, &ippmclient.ModifyUserPasswordReq{UserName: req.Username, NewPassword: password})
+	if err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionModifyPassword, autCtxValue.AccountId, req.Username, &before, &before, err)
+		return nil, err
+	}
+
+	// clear the old password too if not store
+	subUser.Password = ""
+	if l.svcCtx.Config.Password.Store {
+		subUser.Password = password
+	}
+
+	if err := model.UpdateSubUserFields(l.svcCtx.Redis, subUser, "password"); err != nil {
+		return nil, err
+	}
+
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionModifyPassword, autCtxValue.AccountId, req.Username, &before, subUser, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserUpdated, autCtxValue.AccountId, req.Username, eventReasonPassword)
+	return &types.ModifySubUserPasswordResponse{Username: req.Username, Password: password}, nil
+}
@@ -0,0 +1,63 @@
+package logic
+
+import (
+	"fmt"
+
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+)
+
+const minutesOfDay = 24 * 60
+
+func checkRoute(route *types.Route) error {
+	switch route.Mode {
+	case constant.RouteModeAuto, constant.RouteModeManual, constant.RouteModeCustom:
+	case constant.RouteModeTimed:
+		if route.IntervalMinutes < 0 {
+			return fmt.Errorf("interval minutes can not be negative")
+		}
+		if route.IntervalMinutes == 0 && (route.UtcMinuteOfDay < 0 || route.UtcMinuteOfDay >= minutesOfDay) {
+			return fmt.Errorf("utc minute of day must between 0 and %d", minutesOfDay-1)
+		}
+	default:
+		return fmt.Errorf("invalid route mode %d", route.Mode)
+	}
+
+	// the node of auto and timed mode is switched by ippm server
+	if route.NodeID != "" && (route.Mode == constant.RouteModeAuto || route.Mode == constant.RouteModeTimed) {
+		return fmt.Errorf("can not specify node for route mode %d", route.Mode)
+	}
+	return nil
+}
+
+func toIPPMRoute(route *types.Route) *ippmclient.Route {
+	return &ippmclient.Route{
+		Mode:            route.Mode,
+		NodeID:          route.NodeID,
+		IntervalMinutes: route.IntervalMinutes,
+		UtcMinuteOfDay:  route.UtcMinuteOfDay,
+	}
+}
+
+func setSubUserRoute(subUser *model.SubUser, route *types.Route) {
+	subUser.RouteMode = route.Mode
+	subUser.RouteNodeID = route.NodeID
+	subUser.RouteIntervalMinutes = route.IntervalMinutes
+	subUser.RouteUtcMinuteOfDay = route.UtcMinuteOfDay
+}
+
+// subUserRoute return custom mode for the sub user created before route support
+func subUserRoute(subUser *model.SubUser) *types.Route {
+	if subUser.RouteMode == 0 {
+		return &types.Route{Mode: constant.RouteModeCustom}
+	}
+
+	return &types.Route{
+		Mode:            subUser.RouteMode,
+		NodeID:          subUser.RouteNodeID,
+		IntervalMinutes: subUser.RouteIntervalMinutes,
+		UtcMinuteOfDay:  subUser.RouteUtcMinuteOfDay,
+	}
+}
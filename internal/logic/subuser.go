@@ -0,0 +1,162 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// toSubUser convert the sub user record to api type, with the area name of its pop
+func toSubUser(svcCtx *svc.ServiceContext, subUser *model.SubUser) *types.SubUser {
+	user := &types.SubUser{
+		Username:          subUser.Username,
+		Password:          subUser.Password,
+		ServerAddress:     subUser.ServerAddress,
+		TotalTrafficLimit: subUser.TotalTrafficLimit,
+		MaxBandwidthLimit: subUser.MaxBandwidthLimit,
+		UploadRateLimit:   subUser.UploadRateLimit,
+		DownloadRateLimit: subUser.DownloadRateLimit,
+		CreateTime:        subUser.CreateTime,
+		DeprecatedTime:    subUser.DeprecatedTime,
+		Status:            subUser.Status,
+		StatusReason:      subUser.StatusReason,
+		StartTime:         subUser.StartTime,
+		EndTime:           subUser.EndTime,
+		PeriodType:        subUser.GetPeriodType(),
+		PeriodDays:        subUser.PeriodDays,
+		RenewMode:         subUser.GetRenewMode(),
+		Route:             subUserRoute(subUser),
+	}
+
+	pop, err := svcCtx.PopManager.Get(subUser.PopID)
+	if err == nil {
+		user.AreaName = pop.Name
+	} else {
+		logx.Debugf("get pop %v", err.Error())
+	}
+
+	return user
+}
+
+// reason of the sub user events published by logic
+const (
+	eventReasonUser          = "user"
+	eventReasonLimit         = "limit"
+	eventReasonRenewalPolicy = "renewal_policy"
+	eventReasonPassword      = "password"
+	eventReasonNodeSwitched  = "node_switched"
+)
+
+// publishSubUserEvent notify the subscribers such as webhooks that the sub user changed
+func publishSubUserEvent(ctx context.Context, svcCtx *svc.ServiceContext, eventType, userID, subUsername, reason string) {
+	svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:        eventType,
+		UserID:      userID,
+		SubUsername: subUsername,
+		Reason:      reason,
+	})
+}
+
+// auditSubUser record the mutation of the sub user done by the IPPM call, ippmErr is the result of the call
+func auditSubUser(ctx context.Context, svcCtx *svc.ServiceContext, action, userID, subUsername string, before, after *model.SubUser, ippmErr error) {
+	audit.Record(ctx, svcCtx, &audit.Entry{
+		UserID:      userID,
+		Action:      action,
+		SubUsername: subUsername,
+		Before:      before,
+		After:       after,
+		IPPMCalled:  true,
+		IPPMErr:     ippmErr,
+	})
+}
+
+var ErrAccountSuspended = errors.New("account traffic exhausted, please buy more traffic")
+
+var ErrAccountFrozen = errors.New("account is frozen, please contact the admin")
+
+// rateLimitCeiling return the default ceiling for the user created before rate limit ceiling support
+func rateLimitCeiling(ceiling, defaultCeiling int64) int64 {
+	if ceiling == 0 {
+		return defaultCeiling
+	}
+	return ceiling
+}
+
+// checkQuotaLimit check the bandwidth and traffic limit of sub user, the negative one lower the allocated of user
+func checkQuotaLimit(maxBandwidthLimit, totalTrafficLimit int64) error {
+	if maxBandwidthLimit < 0 || totalTrafficLimit < 0 {
+		return fmt.Errorf("bandwidth and traffic limit can not be negative")
+	}
+	return nil
+}
+
+// checkEditQuotaLimit check the edited limits, nil means not change
+func checkEditQuotaLimit(maxBandwidthLimit, totalTrafficLimit *int64) error {
+	var bandwidth, traffic int64
+	if maxBandwidthLimit != nil {
+		bandwidth = *maxBandwidthLimit
+	}
+	if totalTrafficLimit != nil {
+		traffic = *totalTrafficLimit
+	}
+	return checkQuotaLimit(bandwidth, traffic)
+}
+
+// checkRateLimit check the rate limit of sub user under the ceiling of user, 0 rate limit means unlimit
+func checkRateLimit(svcCtx *svc.ServiceContext, user *model.User, uploadRateLimit, downloadRateLimit int64) error {
+	if uploadRateLimit < 0 || downloadRateLimit < 0 {
+		return fmt.Errorf("rate limit can not be negative")
+	}
+
+	uploadCeiling := rateLimitCeiling(user.MaxUploadRateLimit, svcCtx.Config.Quota.MaxUploadRateLimit)
+	if uploadCeiling > 0 && (uploadRateLimit == 0 || uploadRateLimit > uploadCeiling) {
+		return fmt.Errorf("upload rate limit can not exceed %d", uploadCeiling)
+	}
+
+	downloadCeiling := rateLimitCeiling(user.MaxDownloadRateLimit, svcCtx.Config.Quota.MaxDownloadRateLimit)
+	if downloadCeiling > 0 && (downloadRateLimit == 0 || downloadRateLimit > downloadCeiling) {
+		return fmt.Errorf("download rate limit can not exceed %d", downloadCeiling)
+	}
+	return nil
+}
+
+const (
+	passwordChars     = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	minPasswordLength = 6
+	maxPasswordLength = 64
+)
+
+func checkPassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password length must between %d and %d", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// genPassword generate a random password, without the chars easy to confuse
+func genPassword(length int) (string, error) {
+	if length < minPasswordLength {
+		length = minPasswordLength
+	}
+
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/limit"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type SwitchNodeLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 切换子账户出口节点
+func NewSwitchNodeLogic(ctx context.Context, svcCtx *svc.ServiceContext) *SwitchNodeLogic {
+	return &SwitchNodeLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *SwitchNodeLogic) SwitchNode(req *types.SwitchNodeReq) (resp *types.SwitchNodeResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	subUser, err := model.GetSubUser(l.svcCtx.Redis, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if subUser == nil || subUser.UserID != autCtxValue.AccountId {
+		return nil, fmt.Errorf("sub user %s not exist", req.Username)
+	}
+
+	if subUser.Status != subUserStatusActive {
+		return nil, fmt.Errorf("sub user %s is %s", req.Username, subUser.Status)
+	}
+
+	code, err := l.svcCtx.SwitchNodeLimit.TakeCtx(l.ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if code == limit.OverQuota {
+		return nil, fmt.Errorf("switch node too frequently, please try again later")
+	}
+
+	before := *subUser
+	err = l.svcCtx.IPPMClient.SwitchUserRouteNode(l.ctx, &ippmclient.SwitchUserRouteNodeReq{UserName: req.Username, NodeId: req.NodeId})
+	if err != nil {
+		auditSubUser(l.ctx, l.svcCtx, audit.ActionSwitchNode, autCtxValue.AccountId, req.Username, &before, &before, err)
+		return nil, err
+	}
+
+	getUserResp, err := l.svcCtx.IPPMClient.GetUser(l.ctx, &ippmclient.GetUserReq{UserName: req.Username})
+	if err != nil {
+		return nil, err
+	}
+
+	// manual mode stick on the new node
+	if subUser.RouteMode == constant.RouteModeManual && getUserResp.Route != nil && getUserResp.Route.NodeID != subUser.RouteNodeID {
+		subUser.RouteNodeID = getUserResp.Route.NodeID
+		if err := model.UpdateSubUserFields(l.svcCtx.Redis, subUser, "route_node_id"); err != nil {
+			logx.Errorf("save route node of sub user %s failed:%v", req.Username, err)
+		}
+	}
+
+	auditSubUser(l.ctx, l.svcCtx, audit.ActionSwitchNode, autCtxValue.AccountId, req.Username, &before, subUser, nil)
+	publishSubUserEvent(l.ctx, l.svcCtx, event.TypeSubUserUpdated, autCtxValue.AccountId, req.Username, eventReasonNodeSwitched)
+	return &types.SwitchNodeResponse{
+		NodeIP:              getUserResp.NodeIP,
+		LastRouteSwitchTime: getUserResp.LastRouteSwitchTime,
+	}, nil
+}
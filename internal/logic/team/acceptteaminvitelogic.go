@@ -0,0 +1,109 @@
+package team
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+	"titan-ipweb/user"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type AcceptTeamInviteLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 接受团队邀请
+func NewAcceptTeamInviteLogic(ctx context.Context, svcCtx *svc.ServiceContext) *AcceptTeamInviteLogic {
+	return &AcceptTeamInviteLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *AcceptTeamInviteLogic) AcceptTeamInvite(req *types.AcceptTeamInviteReq) (resp *types.Team, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	membership, err := model.GetMembership(l.svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if membership != nil {
+		return nil, fmt.Errorf("already joined team %s", membership.TeamID)
+	}
+
+	email := normalizeEmail(autCtxValue.Email)
+	invite, err := model.GetTeamInvite(l.svcCtx.Redis, req.TeamId, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if invite == nil {
+		return nil, fmt.Errorf("invitation not exist or expired")
+	}
+
+	team, err := model.GetTeam(l.svcCtx.Redis, req.TeamId)
+	if err != nil {
+		return nil, err
+	}
+
+	if team == nil {
+		return nil, fmt.Errorf("team %s not exist", req.TeamId)
+	}
+
+	// the own sub users can not be accessed after joined
+	count, err := model.SubUserCount(l.svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		return nil, fmt.Errorf("please delete your %d sub users before joining a team", count)
+	}
+
+	res, err := l.svcCtx.UserRpc.LoginByEmail(l.ctx, &user.EmailLoginRequest{
+		Email:            email,
+		VerificationCode: req.Code,
+	})
+	if err != nil {
+		logx.Errorf("verify invitation code of %s failed:%v", email, err)
+		return nil, fmt.Errorf("invalid verification code")
+	}
+
+	if res.UserUuid != autCtxValue.UserId {
+		return nil, fmt.Errorf("invalid verification code")
+	}
+
+	member := &model.Membership{
+		TeamID:    team.ID,
+		AccountID: team.OwnerID,
+		UserID:    autCtxValue.UserId,
+		Email:     email,
+		Role:      invite.Role,
+		JoinTime:  time.Now().Unix(),
+	}
+	if err := model.AddMembership(l.svcCtx.Redis, member); err != nil {
+		return nil, err
+	}
+
+	if err := model.RemoveTeamInvite(l.svcCtx.Redis, team.ID, email); err != nil {
+		logx.Errorf("remove invitation of %s failed:%v", email, err)
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionJoinTeam, team.OwnerID, nil, member)
+	return toTeam(team), nil
+}
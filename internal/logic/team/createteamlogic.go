@@ -0,0 +1,73 @@
+package team
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/google/uuid"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type CreateTeamLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 创建团队，团队共享创建者的配额与子用户
+func NewCreateTeamLogic(ctx context.Context, svcCtx *svc.ServiceContext) *CreateTeamLogic {
+	return &CreateTeamLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *CreateTeamLogic) CreateTeam(req *types.CreateTeamReq) (resp *types.Team, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	if req.Name == "" || len(req.Name) > maxTeamNameLength {
+		return nil, fmt.Errorf("name length must be in 1-%d", maxTeamNameLength)
+	}
+
+	membership, err := model.GetMembership(l.svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if membership != nil {
+		return nil, fmt.Errorf("already joined team %s", membership.TeamID)
+	}
+
+	// the team share the account of the owner
+	team := &model.Team{
+		ID:         uuid.NewString(),
+		Name:       req.Name,
+		OwnerID:    autCtxValue.UserId,
+		CreateTime: time.Now().Unix(),
+	}
+	if err := model.AddTeam(l.svcCtx.Redis, team, autCtxValue.Email); err != nil {
+		return nil, err
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionCreateTeam, team.OwnerID, nil, &model.Membership{
+		TeamID:    team.ID,
+		AccountID: team.OwnerID,
+		UserID:    team.OwnerID,
+		Email:     autCtxValue.Email,
+		Role:      model.TeamRoleOwner,
+		JoinTime:  team.CreateTime,
+	})
+	return toTeam(team), nil
+}
@@ -0,0 +1,41 @@
+package team
+
+import (
+	"context"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type DeleteTeamLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 解散团队
+func NewDeleteTeamLogic(ctx context.Context, svcCtx *svc.ServiceContext) *DeleteTeamLogic {
+	return &DeleteTeamLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *DeleteTeamLogic) DeleteTeam() error {
+	_, membership, err := ownerMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return err
+	}
+
+	// the sub users belong to the owner's account, they are kept
+	if err := model.RemoveTeam(l.ctx, l.svcCtx.Redis, membership.TeamID); err != nil {
+		return err
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionDeleteTeam, membership.AccountID, membership, nil)
+	return nil
+}
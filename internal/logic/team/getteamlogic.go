@@ -0,0 +1,77 @@
+package team
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetTeamLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取所在团队的信息
+func NewGetTeamLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetTeamLogic {
+	return &GetTeamLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *GetTeamLogic) GetTeam() (resp *types.GetTeamResponse, err error) {
+	_, membership, err := currentMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	team, err := model.GetTeam(l.svcCtx.Redis, membership.TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if team == nil {
+		return nil, fmt.Errorf("team %s not exist", membership.TeamID)
+	}
+
+	members, err := model.GetTeamMembers(l.ctx, l.svcCtx.Redis, team.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	invites, err := model.GetTeamInvites(l.ctx, l.svcCtx.Redis, team.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &types.GetTeamResponse{
+		Team:    toTeam(team),
+		Role:    membership.Role,
+		Members: make([]*types.TeamMember, 0, len(members)),
+		Invites: make([]*types.TeamInvite, 0, len(invites)),
+	}
+	for _, member := range members {
+		resp.Members = append(resp.Members, &types.TeamMember{
+			UserId:   member.UserID,
+			Email:    member.Email,
+			Role:     member.Role,
+			JoinTime: member.JoinTime,
+		})
+	}
+	for _, invite := range invites {
+		resp.Invites = append(resp.Invites, &types.TeamInvite{
+			Email:      invite.Email,
+			Role:       invite.Role,
+			CreateTime: invite.CreateTime,
+			ExpireTime: invite.ExpireTime,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,101 @@
+package team
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+	"titan-ipweb/user"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type InviteTeamMemberLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 邀请成员，发送验证码到被邀请的邮箱
+func NewInviteTeamMemberLogic(ctx context.Context, svcCtx *svc.ServiceContext) *InviteTeamMemberLogic {
+	return &InviteTeamMemberLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *InviteTeamMemberLogic) InviteTeamMember(req *types.InviteTeamMemberReq) error {
+	autCtxValue, membership, err := ownerMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkMemberRole(req.Role); err != nil {
+		return err
+	}
+
+	email := normalizeEmail(req.Email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		return fmt.Errorf("invalid email %s", req.Email)
+	}
+
+	members, err := model.GetTeamMembers(l.ctx, l.svcCtx.Redis, membership.TeamID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if normalizeEmail(member.Email) == email {
+			return fmt.Errorf("%s already in the team", email)
+		}
+	}
+
+	invites, err := model.GetTeamInvites(l.ctx, l.svcCtx.Redis, membership.TeamID)
+	if err != nil {
+		return err
+	}
+
+	if len(members)+len(invites) >= l.svcCtx.Config.Team.MaxMembers {
+		return fmt.Errorf("can not have more than %d members", l.svcCtx.Config.Team.MaxMembers)
+	}
+
+	now := time.Now().Unix()
+	invite := &model.TeamInvite{
+		TeamID:     membership.TeamID,
+		Email:      email,
+		Role:       req.Role,
+		InviterID:  autCtxValue.UserId,
+		CreateTime: now,
+		ExpireTime: now + l.svcCtx.Config.Team.InviteExpire,
+	}
+	if err := model.SaveTeamInvite(l.svcCtx.Redis, invite); err != nil {
+		return err
+	}
+
+	// the invitee accept with the code, it prove the email is owned by the invitee
+	_, err = l.svcCtx.UserRpc.SendEmailVerificationCode(l.ctx, &user.SendEmailCodeRequest{
+		Email:   email,
+		Purpose: user.CodeType_LOGIN,
+	})
+	if err != nil {
+		logx.Errorf("send invitation code to %s failed:%v", email, err)
+		if e := model.RemoveTeamInvite(l.svcCtx.Redis, membership.TeamID, email); e != nil {
+			logx.Errorf("remove invitation of %s failed:%v", email, e)
+		}
+		return err
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionInviteMember, membership.AccountID, nil, &model.Membership{
+		TeamID:    membership.TeamID,
+		AccountID: membership.AccountID,
+		Email:     email,
+		Role:      req.Role,
+	})
+	return nil
+}
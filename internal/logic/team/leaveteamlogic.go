@@ -0,0 +1,45 @@
+package team
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type LeaveTeamLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 退出团队
+func NewLeaveTeamLogic(ctx context.Context, svcCtx *svc.ServiceContext) *LeaveTeamLogic {
+	return &LeaveTeamLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *LeaveTeamLogic) LeaveTeam() error {
+	_, membership, err := currentMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return err
+	}
+
+	if membership.Role == model.TeamRoleOwner {
+		return fmt.Errorf("owner can not leave, delete the team instead")
+	}
+
+	if err := model.RemoveMembership(l.svcCtx.Redis, membership.TeamID, membership.UserID); err != nil {
+		return err
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionLeaveTeam, membership.AccountID, membership, nil)
+	return nil
+}
@@ -0,0 +1,55 @@
+package team
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type RemoveTeamMemberLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 移除团队成员
+func NewRemoveTeamMemberLogic(ctx context.Context, svcCtx *svc.ServiceContext) *RemoveTeamMemberLogic {
+	return &RemoveTeamMemberLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *RemoveTeamMemberLogic) RemoveTeamMember(req *types.RemoveTeamMemberReq) error {
+	autCtxValue, membership, err := ownerMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return err
+	}
+
+	if req.UserId == autCtxValue.UserId {
+		return fmt.Errorf("owner can not remove itself, delete the team instead")
+	}
+
+	member, err := model.GetMembership(l.svcCtx.Redis, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	if member == nil || member.TeamID != membership.TeamID {
+		return fmt.Errorf("member %s not exist", req.UserId)
+	}
+
+	if err := model.RemoveMembership(l.svcCtx.Redis, membership.TeamID, req.UserId); err != nil {
+		return err
+	}
+
+	auditMember(l.ctx, l.svcCtx, audit.ActionRemoveMember, membership.AccountID, member, nil)
+	return nil
+}
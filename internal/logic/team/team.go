@@ -0,0 +1,77 @@
+package team
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+)
+
+const maxTeamNameLength = 64
+
+// currentMembership return the membership of the caller, error if not joined any team
+func currentMembership(ctx context.Context, svcCtx *svc.ServiceContext) (*middleware.AuthCtxValue, *model.Membership, error) {
+	autCtxValue, ok := ctx.Value(middleware.AuthKey).(middleware.AuthCtxValue)
+	if !ok {
+		return nil, nil, fmt.Errorf("auth failed")
+	}
+
+	membership, err := model.GetMembership(svcCtx.Redis, autCtxValue.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if membership == nil {
+		return nil, nil, fmt.Errorf("not joined any team")
+	}
+	return &autCtxValue, membership, nil
+}
+
+// ownerMembership return the membership of the caller, error if not the team owner
+func ownerMembership(ctx context.Context, svcCtx *svc.ServiceContext) (*middleware.AuthCtxValue, *model.Membership, error) {
+	autCtxValue, membership, err := currentMembership(ctx, svcCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if membership.Role != model.TeamRoleOwner {
+		return nil, nil, fmt.Errorf("only the team owner can do this")
+	}
+	return autCtxValue, membership, nil
+}
+
+// checkMemberRole the team has only one owner
+func checkMemberRole(role string) error {
+	if role != model.TeamRoleMember && role != model.TeamRoleViewer {
+		return fmt.Errorf("role %s is not %s or %s", role, model.TeamRoleMember, model.TeamRoleViewer)
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// auditMember record the membership change to the audit log of the team account
+func auditMember(ctx context.Context, svcCtx *svc.ServiceContext, action, accountID string, before, after *model.Membership) {
+	audit.Record(ctx, svcCtx, &audit.Entry{
+		UserID: accountID,
+		Action: action,
+		Before: before,
+		After:  after,
+	})
+}
+
+func toTeam(team *model.Team) *types.Team {
+	return &types.Team{
+		Id:         team.ID,
+		Name:       team.Name,
+		OwnerId:    team.OwnerID,
+		CreateTime: team.CreateTime,
+	}
+}
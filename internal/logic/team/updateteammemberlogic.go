@@ -0,0 +1,61 @@
+package team
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type UpdateTeamMemberLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 修改团队成员的角色
+func NewUpdateTeamMemberLogic(ctx context.Context, svcCtx *svc.ServiceContext) *UpdateTeamMemberLogic {
+	return &UpdateTeamMemberLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *UpdateTeamMemberLogic) UpdateTeamMember(req *types.UpdateTeamMemberReq) error {
+	_, membership, err := ownerMembership(l.ctx, l.svcCtx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkMemberRole(req.Role); err != nil {
+		return err
+	}
+
+	member, err := model.GetMembership(l.svcCtx.Redis, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	if member == nil || member.TeamID != membership.TeamID {
+		return fmt.Errorf("member %s not exist", req.UserId)
+	}
+
+	if member.Role == model.TeamRoleOwner {
+		return fmt.Errorf("can not change the role of owner")
+	}
+
+	if err := model.SetMembershipRole(l.svcCtx.Redis, req.UserId, req.Role); err != nil {
+		return err
+	}
+
+	after := *member
+	after.Role = req.Role
+	auditMember(l.ctx, l.svcCtx, audit.ActionUpdateMemberRole, membership.AccountID, member, &after)
+	return nil
+}
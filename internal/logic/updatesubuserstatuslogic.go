@@ -1,13 +1,12 @@
 package logic
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"time"
 
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/svc"
 	"titan-ipweb/internal/types"
@@ -48,7 +47,7 @@ func (l *UpdateSubUserStatusLogic) UpdateSubUserStatus(req *types.UpdateSubUserS
 		return fmt.Errorf("user %s not exist", req.Username)
 	}
 
-	if subUser.UserID != autCtxValue.UserId {
+	if subUser.UserID != autCtxValue.AccountId {
 		return fmt.Errorf("sub user %s not exist", req.Username)
 	}
 
@@ -56,17 +55,59 @@ func (l *UpdateSubUserStatusLogic) UpdateSubUserStatus(req *types.UpdateSubUserS
 		return fmt.Errorf("user status %s is not %s or %s", req.Status, subUserStatusActive, subUserStatusStop)
 	}
 
+	if req.Status == subUserStatusActive {
+		user, err := model.GetUser(l.svcCtx.Redis, autCtxValue.AccountId)
+		if err != nil {
+			return err
+		}
+		if user != nil && user.Frozen {
+			return ErrAccountFrozen
+		}
+		if user != nil && user.Suspended {
+			return ErrAccountSuspended
+		}
+	}
+
+	action := audit.ActionStopSubUser
+	if req.Status == subUserStatusActive {
+		action = audit.ActionStartSubUser
+	}
+	before := *subUser
+
+	// the period of stop mode sub user is end, start a new one
+	fields := []string{"status", "status_reason"}
+	now := time.Now().Unix()
+	if req.Status == subUserStatusActive && subUser.EndTime != 0 && subUser.EndTime <= now {
+		if err := l.renewPeriod(subUser, now); err != nil {
+			auditSubUser(l.ctx, l.svcCtx, action, autCtxValue.AccountId, req.Username, &before, &before, err)
+			return err
+		}
+		fields = append(fields, "start_time", "end_time", "period_anchor", "notified_threshold")
+	}
+
 	if err := l.updateSubUserStatus(req); err != nil {
+		auditSubUser(l.ctx, l.svcCtx, action, autCtxValue.AccountId, req.Username, &before, &before, err)
 		return err
 	}
 
 	subUser.Status = req.Status
+	subUser.StatusReason = ""
+
+	if err := model.UpdateSubUserFields(l.svcCtx.Redis, subUser, fields...); err != nil {
+		return err
+	}
+
+	auditSubUser(l.ctx, l.svcCtx, action, autCtxValue.AccountId, req.Username, &before, subUser, nil)
 
-	return model.SaveSubUser(l.svcCtx.Redis, subUser)
+	eventType := event.TypeSubUserStopped
+	if req.Status == subUserStatusActive {
+		eventType = event.TypeSubUserStarted
+	}
+	publishSubUserEvent(l.ctx, l.svcCtx, eventType, autCtxValue.AccountId, req.Username, eventReasonUser)
+	return nil
 }
 
 func (l *UpdateSubUserStatusLogic) updateSubUserStatus(req *types.UpdateSubUserStatusReq) error {
-	url := fmt.Sprintf("%s/user/startorstop", l.svcCtx.Config.IPPMServer.URL)
 	startOrStopReq := ippmclient.StartOrStopUserReq{
 		UserName: req.Username,
 	}
@@ -76,33 +117,26 @@ func (l *UpdateSubUserStatusLogic) updateSubUserStatus(req *types.UpdateSubUserS
 		startOrStopReq.Action = "start"
 	}
 
-	buf, err := json.Marshal(startOrStopReq)
-	if err != nil {
-		return fmt.Errorf("marshal error %v", err)
-	}
-
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return fmt.Errorf("NewRequest error %v", err)
-	}
-
-	request.Header.Set("Authorization", "Bearer "+l.svcCtx.IPPMAcessToken)
-	request.Header.Set("Content-Type", "application/json")
+	return l.svcCtx.IPPMClient.StartOrStopUser(l.ctx, &startOrStopReq)
+}
 
-	httpResp, err := client.Do(request)
-	if err != nil {
-		return fmt.Errorf("http do error %v", err)
+func (l *UpdateSubUserStatusLogic) renewPeriod(subUser *model.SubUser, now int64) error {
+	endTime := model.PeriodEnd(now, now, subUser.GetPeriodType(), subUser.PeriodDays)
+	modifyUserReq := &ippmclient.ModifyUserReq{
+		UserName: subUser.Username,
+		TrafficLimit: &ippmclient.TrafficLimit{
+			StartTime:    now,
+			EndTime:      endTime,
+			TotalTraffic: subUser.TotalTrafficLimit,
+		},
 	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(httpResp.Body)
-		if len(data) != 0 {
-			return fmt.Errorf(string(data))
-		}
-		return fmt.Errorf("ip manager server response status code %d", httpResp.StatusCode)
+	if err := l.svcCtx.IPPMClient.ModifyUser(l.ctx, modifyUserReq); err != nil {
+		return err
 	}
 
+	subUser.StartTime = now
+	subUser.EndTime = endTime
+	subUser.PeriodAnchor = now
+	subUser.NotifiedThreshold = 0
 	return nil
 }
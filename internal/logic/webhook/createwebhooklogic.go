@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	hook "titan-ipweb/internal/webhook"
+	"titan-ipweb/model"
+
+	"github.com/google/uuid"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type CreateWebhookLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 注册webhook
+func NewCreateWebhookLogic(ctx context.Context, svcCtx *svc.ServiceContext) *CreateWebhookLogic {
+	return &CreateWebhookLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *CreateWebhookLogic) CreateWebhook(req *types.CreateWebhookReq) (resp *types.Webhook, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	if err := hook.ValidateURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	for _, e := range req.Events {
+		if !event.IsValidType(e) {
+			return nil, fmt.Errorf("invalid event type %s", e)
+		}
+	}
+
+	count, err := model.WebhookCount(l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= l.svcCtx.Config.Webhook.MaxPerUser {
+		return nil, fmt.Errorf("can not create more than %d webhooks", l.svcCtx.Config.Webhook.MaxPerUser)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	webhook := &model.Webhook{
+		ID:         uuid.NewString(),
+		UserID:     autCtxValue.AccountId,
+		URL:        req.URL,
+		Secret:     hex.EncodeToString(secret),
+		Events:     strings.Join(req.Events, ","),
+		CreateTime: time.Now().Unix(),
+	}
+
+	if err := model.AddWebhook(l.svcCtx.Redis, webhook); err != nil {
+		return nil, err
+	}
+
+	resp = toWebhook(webhook)
+	resp.Secret = webhook.Secret
+	return resp, nil
+}
+
+// toWebhook convert the webhook to api type, without the secret
+func toWebhook(webhook *model.Webhook) *types.Webhook {
+	events := make([]string, 0)
+	if webhook.Events != "" {
+		events = strings.Split(webhook.Events, ",")
+	}
+
+	return &types.Webhook{
+		Id:         webhook.ID,
+		URL:        webhook.URL,
+		Events:     events,
+		CreateTime: webhook.CreateTime,
+	}
+}
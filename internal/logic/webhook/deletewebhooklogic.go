@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type DeleteWebhookLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 删除webhook
+func NewDeleteWebhookLogic(ctx context.Context, svcCtx *svc.ServiceContext) *DeleteWebhookLogic {
+	return &DeleteWebhookLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *DeleteWebhookLogic) DeleteWebhook(req *types.DeleteWebhookReq) error {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return fmt.Errorf("auth failed")
+	}
+
+	webhook, err := model.GetWebhook(l.svcCtx.Redis, req.Id)
+	if err != nil {
+		return err
+	}
+
+	if webhook == nil || webhook.UserID != autCtxValue.AccountId {
+		return fmt.Errorf("webhook %s not exist", req.Id)
+	}
+
+	return model.RemoveWebhook(l.svcCtx.Redis, autCtxValue.AccountId, req.Id)
+}
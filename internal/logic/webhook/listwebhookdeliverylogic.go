@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ListWebhookDeliveryLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取webhook投递记录
+func NewListWebhookDeliveryLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ListWebhookDeliveryLogic {
+	return &ListWebhookDeliveryLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ListWebhookDeliveryLogic) ListWebhookDelivery(req *types.ListWebhookDeliveryReq) (resp *types.ListWebhookDeliveryResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	webhook, err := model.GetWebhook(l.svcCtx.Redis, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if webhook == nil || webhook.UserID != autCtxValue.AccountId {
+		return nil, fmt.Errorf("webhook %s not exist", req.Id)
+	}
+
+	deliveries, err := model.GetWebhookDeliveries(l.ctx, l.svcCtx.Redis, req.Id, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &types.ListWebhookDeliveryResponse{Deliveries: make([]*types.WebhookDelivery, 0, len(deliveries))}
+	for _, delivery := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, &types.WebhookDelivery{
+			Id:           delivery.ID,
+			EventType:    delivery.EventType,
+			Payload:      delivery.Payload,
+			Status:       delivery.Status,
+			Attempts:     delivery.Attempts,
+			ResponseCode: delivery.ResponseCode,
+			LastError:    delivery.LastError,
+			CreateTime:   delivery.CreateTime,
+			NextTime:     delivery.NextTime,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"titan-ipweb/internal/middleware"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ListWebhookLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+// 获取webhook列表
+func NewListWebhookLogic(ctx context.Context, svcCtx *svc.ServiceContext) *ListWebhookLogic {
+	return &ListWebhookLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+func (l *ListWebhookLogic) ListWebhook() (resp *types.ListWebhookResponse, err error) {
+	v := l.ctx.Value(middleware.AuthKey)
+	autCtxValue, ok := v.(middleware.AuthCtxValue)
+	if !ok {
+		return nil, fmt.Errorf("auth failed")
+	}
+
+	webhooks, err := model.GetUserWebhooks(l.ctx, l.svcCtx.Redis, autCtxValue.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &types.ListWebhookResponse{Webhooks: make([]*types.Webhook, 0, len(webhooks))}
+	for _, webhook := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, toWebhook(webhook))
+	}
+	return resp, nil
+}
@@ -7,7 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"titan-ipweb/model"
+
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/zeromicro/go-zero/core/stores/redis"
 )
 
 type AuthCtxValue struct {
@@ -15,6 +18,39 @@ type AuthCtxValue struct {
 	Email     string
 	Role      string
 	ExpiresAt int64
+	// set if authenticated by api key
+	APIKeyID string
+	Scopes   []string
+	// the account to operate, the team account if the user joined a team, otherwise UserId
+	AccountId string
+	// role in the team, empty if not joined
+	TeamRole string
+}
+
+const (
+	// the GET requests, such as stats and list
+	ScopeRead = "read"
+	// all requests, such as create, edit and delete sub users
+	ScopeManage = "manage"
+)
+
+var Scopes = []string{ScopeRead, ScopeManage}
+
+// Allow return true if the api key has scope for the http method, jwt allow all
+func (v AuthCtxValue) Allow(method string) bool {
+	if v.APIKeyID == "" || len(v.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range v.Scopes {
+		if scope == ScopeManage {
+			return true
+		}
+		if scope == ScopeRead && (method == http.MethodGet || method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
 }
 
 type AuthCtxKey string
@@ -29,17 +65,24 @@ type Claims struct {
 	SessionKey int64     `json:"sskey"`
 	Email      string    `json:"email"`
 	Type       TokenType `json:"token_type"`
+	Role       string    `json:"role"`
 
 	jwt.RegisteredClaims
 }
 
 type AuthMiddleware struct {
 	AccessSecretKey string
+	// to verify the api keys
+	rdb *redis.Redis
+	// the emails always get the admin role
+	adminEmails []string
 }
 
-func NewAuthMiddleware(secretKey string) *AuthMiddleware {
+func NewAuthMiddleware(secretKey string, rdb *redis.Redis, adminEmails []string) *AuthMiddleware {
 	return &AuthMiddleware{
 		AccessSecretKey: secretKey,
+		rdb:             rdb,
+		adminEmails:     adminEmails,
 	}
 }
 
@@ -63,7 +106,55 @@ func (m *AuthMiddleware) parseToken(tokenString string) (AuthCtxValue, error) {
 		return AuthCtxValue{}, fmt.Errorf("token expired")
 	}
 
-	return AuthCtxValue{UserId: claims.UserId, Email: claims.Email}, nil
+	return AuthCtxValue{UserId: claims.UserId, Email: claims.Email, Role: ResolveRole(claims.Role)}, nil
+}
+
+// 验证 API key, 与 JWT 一样填充 AuthCtxValue
+func (m *AuthMiddleware) parseAPIKey(ctx context.Context, key string) (AuthCtxValue, error) {
+	apiKey, err := model.VerifyAPIKey(ctx, m.rdb, key)
+	if err != nil {
+		return AuthCtxValue{}, err
+	}
+
+	// the key only keep the owner, take the current email and role of the owner
+	user, err := model.GetUser(m.rdb, apiKey.UserID)
+	if err != nil {
+		return AuthCtxValue{}, err
+	}
+	if user == nil {
+		return AuthCtxValue{}, fmt.Errorf("owner of api key not exist")
+	}
+
+	// not logged in since the role recorded, only allow the least role until next login
+	role := RoleViewer
+	if user.Role != "" {
+		role = user.Role
+	}
+
+	return AuthCtxValue{
+		UserId:    apiKey.UserID,
+		Email:     user.Email,
+		Role:      UserRole(m.adminEmails, role, user.Email),
+		ExpiresAt: apiKey.ExpireTime,
+		APIKeyID:  apiKey.ID,
+		Scopes:    apiKey.ScopeList(),
+	}, nil
+}
+
+// 团队成员操作团队的账户
+func (m *AuthMiddleware) resolveAccount(authValue *AuthCtxValue) error {
+	authValue.AccountId = authValue.UserId
+
+	membership, err := model.GetMembership(m.rdb, authValue.UserId)
+	if err != nil {
+		return err
+	}
+
+	if membership != nil {
+		authValue.AccountId = membership.AccountID
+		authValue.TeamRole = membership.Role
+	}
+	return nil
 }
 
 func (m *AuthMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
@@ -86,13 +177,29 @@ func (m *AuthMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
 		// 提取 token 部分
 		tokenString := parts[1]
 
-		// 解析并验证 token
-		authValue, err := m.parseToken(tokenString)
+		// API key 或 JWT
+		var authValue AuthCtxValue
+		var err error
+		if strings.HasPrefix(tokenString, model.APIKeyPrefix) {
+			authValue, err = m.parseAPIKey(ctx, tokenString)
+		} else {
+			authValue, err = m.parseToken(tokenString)
+		}
 		if err != nil {
 			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		if !authValue.Allow(r.Method) {
+			http.Error(w, "api key scope not allowed", http.StatusForbidden)
+			return
+		}
+
+		if err := m.resolveAccount(&authValue); err != nil {
+			http.Error(w, "resolve account failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		ctx = context.WithValue(ctx, AuthKey, authValue)
 		r = r.WithContext(ctx)
 		next(w, r)
@@ -1,6 +1,15 @@
 package middleware
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+type ClientIPCtxKey string
+
+const ClientIPKey ClientIPCtxKey = "client_ip"
 
 type HeaderMiddleware struct {
 }
@@ -11,9 +20,14 @@ func NewHeaderMiddleware() *HeaderMiddleware {
 
 func (m *HeaderMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// TODO generate middleware implement function, delete after code implementation
-
-		// Passthrough to next handler if need
-		next(w, r)
+		// X-Forwarded-For first, then the remote address
+		ctx := context.WithValue(r.Context(), ClientIPKey, httpx.GetRemoteAddr(r))
+		next(w, r.WithContext(ctx))
 	}
 }
+
+// ClientIP return the ip of the client set by HeaderMiddleware
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
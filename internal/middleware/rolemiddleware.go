@@ -0,0 +1,81 @@
+package middleware
+
+import "net/http"
+
+const (
+	// all permissions, include the admin routes
+	RoleAdmin = "admin"
+	// the account holder, manage its own sub users
+	RoleOwner = "owner"
+	// support staff, inspect the accounts but can not mutate them
+	RoleViewer = "viewer"
+)
+
+// ResolveRole return the role of ipweb, the users without role are owners.
+// the token signed before role support has no role too
+func ResolveRole(role string) string {
+	switch role {
+	case RoleAdmin, RoleViewer:
+		return role
+	}
+	return RoleOwner
+}
+
+// UserRole return the role of the user, the emails in the admin list are always admin
+func UserRole(adminEmails []string, role, email string) string {
+	for _, e := range adminEmails {
+		if e == email {
+			return RoleAdmin
+		}
+	}
+	return ResolveRole(role)
+}
+
+type RoleMiddleware struct {
+	roles map[string]struct{}
+	// the team roles allowed if the user joined a team, nil means all
+	teamRoles map[string]struct{}
+}
+
+// only the user has one of the roles can pass
+func NewRoleMiddleware(roles ...string) *RoleMiddleware {
+	m := make(map[string]struct{}, len(roles))
+	for _, role := range roles {
+		m[role] = struct{}{}
+	}
+
+	return &RoleMiddleware{roles: m}
+}
+
+// WithTeamRoles also require one of the team roles if the user joined a team
+func (m *RoleMiddleware) WithTeamRoles(roles ...string) *RoleMiddleware {
+	m.teamRoles = make(map[string]struct{}, len(roles))
+	for _, role := range roles {
+		m.teamRoles[role] = struct{}{}
+	}
+	return m
+}
+
+func (m *RoleMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authValue, ok := r.Context().Value(AuthKey).(AuthCtxValue)
+		if !ok {
+			http.Error(w, "auth failed", http.StatusUnauthorized)
+			return
+		}
+
+		if _, ok := m.roles[authValue.Role]; !ok {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		if m.teamRoles != nil && authValue.TeamRole != "" {
+			if _, ok := m.teamRoles[authValue.TeamRole]; !ok {
+				http.Error(w, "team permission denied", http.StatusForbidden)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
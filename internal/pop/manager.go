@@ -1,10 +1,8 @@
 package pop
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"sync"
 	"titan-ipweb/internal/types"
 	"titan-ipweb/ippmclient"
@@ -14,22 +12,20 @@ import (
 
 // Resolve the pop update
 type Manager struct {
-	ippmServerURL string
-	accessToken   string
-	mu            sync.RWMutex
-	pops          map[string]*types.Pop
-	group         singleflight.Group
+	client *ippmclient.Client
+	mu     sync.RWMutex
+	pops   map[string]*types.Pop
+	group  singleflight.Group
 }
 
-func NewPopManager(ippmServerURL, accessToken string) (*Manager, error) {
+func NewPopManager(client *ippmclient.Client) (*Manager, error) {
 	m := &Manager{
-		ippmServerURL: ippmServerURL,
-		accessToken:   accessToken,
-		mu:            sync.RWMutex{},
-		pops:          make(map[string]*types.Pop),
-		group:         singleflight.Group{},
+		client: client,
+		mu:     sync.RWMutex{},
+		pops:   make(map[string]*types.Pop),
+		group:  singleflight.Group{},
 	}
-	pops, err := m.fetch(ippmServerURL, accessToken)
+	pops, err := m.fetch()
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +42,7 @@ func (m *Manager) Get(popID string) (*types.Pop, error) {
 	m.mu.RUnlock()
 
 	v, err, _ := m.group.Do("fetch_pops", func() (interface{}, error) {
-		pops, err := m.fetch(m.ippmServerURL, m.accessToken)
+		pops, err := m.fetch()
 		if err != nil {
 			return nil, err
 		}
@@ -68,36 +64,8 @@ func (m *Manager) Get(popID string) (*types.Pop, error) {
 	return nil, fmt.Errorf("pop %s not exist", popID)
 }
 
-func (m *Manager) fetch(ippmServer, accessToken string) (map[string]*types.Pop, error) {
-	url := fmt.Sprintf("%s/pops", ippmServer)
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("http status code %d, error msg %s", resp.StatusCode, string(data))
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	popsResp := &ippmclient.GetPopsResp{}
-	err = json.Unmarshal(data, popsResp)
+func (m *Manager) fetch() (map[string]*types.Pop, error) {
+	popsResp, err := m.client.GetPops(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,555 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/internal/types"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	lockKey  = "titan:ipweb:lock:reconcile"
+	lockTime = 600
+	pageSize = 100
+
+	IssueRemoteMissing        = "remote_missing"
+	IssueLocalMissing         = "local_missing"
+	IssueDeprecatedRemote     = "deprecated_remote_exist"
+	IssueStatusMismatch       = "status_mismatch"
+	IssueTrafficLimitMismatch = "traffic_limit_mismatch"
+	IssueRateLimitMismatch    = "rate_limit_mismatch"
+	IssueAllocationMismatch   = "allocation_mismatch"
+	IssueBrokenRecord         = "broken_record"
+)
+
+type remoteUser struct {
+	*ippmclient.User
+	popID string
+}
+
+type allocation struct {
+	bandwidth int64
+	traffic   int64
+}
+
+// Reconciler compare the local sub users with the users on the IPPM server
+type Reconciler struct {
+	svcCtx   *svc.ServiceContext
+	interval time.Duration
+	repair   bool
+	done     chan struct{}
+}
+
+func NewReconciler(svcCtx *svc.ServiceContext) *Reconciler {
+	return &Reconciler{
+		svcCtx:   svcCtx,
+		interval: time.Duration(svcCtx.Config.Reconcile.Interval) * time.Second,
+		repair:   svcCtx.Config.Reconcile.Repair,
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Reconciler) Start() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			resp, err := r.Run(context.Background(), r.repair)
+			if err != nil {
+				logx.Errorf("reconcile failed:%v", err)
+				continue
+			}
+			logx.Infof("reconcile checked %d sub users, found %d issues", resp.Checked, len(resp.Issues))
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Reconciler) Stop() {
+	close(r.done)
+}
+
+// Run compare all the sub users, and repair the drift if repair is true
+func (r *Reconciler) Run(ctx context.Context, repair bool) (*types.ReconcileResponse, error) {
+	lock := redis.NewRedisLock(r.svcCtx.Redis, lockKey)
+	lock.SetExpire(lockTime)
+
+	ok, err := lock.AcquireCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("reconcile is running")
+	}
+	defer lock.ReleaseCtx(ctx)
+
+	// the snapshots below are read one by one, the sub users changed during the run are skipped
+	start := time.Now().Unix()
+
+	remoteUsers, err := r.listRemoteUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subUsers, broken, err := model.ScanSubUsers(ctx, r.svcCtx.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip the sub users in the middle of an operation, the saga retrier will resolve them
+	ops, err := model.GetPendingOpsBefore(ctx, r.svcCtx.Redis, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[string]struct{}, len(ops))
+	busyUsers := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		pending[op.SubUsername] = struct{}{}
+		busyUsers[op.UserID] = struct{}{}
+		delete(remoteUsers, op.SubUsername)
+	}
+
+	resp := &types.ReconcileResponse{Issues: make([]*types.ReconcileIssue, 0)}
+	allocations := make(map[string]*allocation)
+
+	// the broken records are reported only, the remote users of them are not local missing,
+	// and the allocation of the user can not be summed
+	allocationKnown := true
+	for _, b := range broken {
+		resp.Issues = append(resp.Issues, &types.ReconcileIssue{
+			Username: b.Username,
+			UserId:   b.UserID,
+			Kind:     IssueBrokenRecord,
+			Detail:   b.Err.Error(),
+		})
+		delete(remoteUsers, b.Username)
+		if b.UserID == "" {
+			allocationKnown = false
+			continue
+		}
+		busyUsers[b.UserID] = struct{}{}
+	}
+
+	for _, subUser := range subUsers {
+		if _, ok := pending[subUser.Username]; ok {
+			continue
+		}
+
+		// created after the remote users listed, the allocation of user is not known either
+		if subUser.CreateTime >= start {
+			delete(remoteUsers, subUser.Username)
+			busyUsers[subUser.UserID] = struct{}{}
+			continue
+		}
+
+		resp.Checked++
+		remote, exist := remoteUsers[subUser.Username]
+		delete(remoteUsers, subUser.Username)
+
+		if subUser.Status == constant.SubUserStatusDeprecated {
+			if exist {
+				issue := r.newIssue(IssueDeprecatedRemote, subUser, "deprecated sub user still exist on ippm server")
+				if repair {
+					confirmed, err := r.confirmDeprecated(subUser.Username)
+					if r.skipRepair(confirmed, err, issue) {
+						continue
+					}
+					if confirmed {
+						issue.Repaired = r.repairAction(r.svcCtx.IPPMClient.DeleteUser(ctx, &ippmclient.DeleteUserReq{UserName: subUser.Username}), issue)
+					}
+				}
+				resp.Issues = append(resp.Issues, issue)
+			}
+			continue
+		}
+
+		if !exist {
+			issue := r.newIssue(IssueRemoteMissing, subUser, "sub user not exist on ippm server")
+			if repair {
+				confirmed, err := r.confirmRemoteMissing(ctx, subUser.Username)
+				if r.skipRepair(confirmed, err, issue) {
+					// the allocation of user is not known either
+					busyUsers[subUser.UserID] = struct{}{}
+					continue
+				}
+				if confirmed {
+					issue.Repaired = r.repairAction(r.deprecate(subUser), issue)
+				}
+			}
+			resp.Issues = append(resp.Issues, issue)
+
+			if issue.Repaired {
+				continue
+			}
+		}
+
+		alloc, ok := allocations[subUser.UserID]
+		if !ok {
+			alloc = &allocation{}
+			allocations[subUser.UserID] = alloc
+		}
+		alloc.bandwidth += subUser.MaxBandwidthLimit
+		alloc.traffic += subUser.TotalTrafficLimit
+
+		if exist {
+			resp.Issues = append(resp.Issues, r.compare(ctx, subUser, remote, repair)...)
+		}
+	}
+
+	for _, remote := range remoteUsers {
+		issue := &types.ReconcileIssue{
+			Username: remote.UserName,
+			PopId:    remote.popID,
+			Kind:     IssueLocalMissing,
+			Detail:   "user on ippm server has no local record",
+		}
+		if repair {
+			confirmed, err := r.confirmLocalMissing(ctx, remote.UserName)
+			if r.skipRepair(confirmed, err, issue) {
+				continue
+			}
+			if confirmed {
+				issue.Repaired = r.repairAction(r.svcCtx.IPPMClient.DeleteUser(ctx, &ippmclient.DeleteUserReq{UserName: remote.UserName}), issue)
+			}
+		}
+		resp.Issues = append(resp.Issues, issue)
+	}
+
+	if !allocationKnown {
+		logx.Errorf("skip the allocation check, the owner of some broken sub users unknown")
+		return resp, nil
+	}
+
+	issues, err := r.checkAllocations(ctx, allocations, busyUsers, repair)
+	if err != nil {
+		return nil, err
+	}
+	resp.Issues = append(resp.Issues, issues...)
+
+	return resp, nil
+}
+
+// compare the status, traffic limit and rate limit, the local record is the truth
+func (r *Reconciler) compare(ctx context.Context, subUser *model.SubUser, remote *remoteUser, repair bool) []*types.ReconcileIssue {
+	issues := make([]*types.ReconcileIssue, 0)
+
+	localOff := subUser.Status == constant.SubUserStatusStop
+	if localOff != remote.Off {
+		issue := r.newIssue(IssueStatusMismatch, subUser, fmt.Sprintf("local status %s, remote off %t", subUser.Status, remote.Off))
+		if repair {
+			action := "start"
+			if localOff {
+				action = "stop"
+			}
+			err := r.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: action})
+			issue.Repaired = r.repairAction(err, issue)
+		}
+		issues = append(issues, issue)
+	}
+
+	remoteTraffic := int64(0)
+	if remote.TrafficLimit != nil {
+		remoteTraffic = remote.TrafficLimit.TotalTraffic
+	}
+
+	if remoteTraffic != subUser.TotalTrafficLimit {
+		issue := r.newIssue(IssueTrafficLimitMismatch, subUser, fmt.Sprintf("local traffic limit %d, remote %d", subUser.TotalTrafficLimit, remoteTraffic))
+		if repair {
+			trafficLimit := &ippmclient.TrafficLimit{
+				StartTime:    subUser.StartTime,
+				EndTime:      subUser.EndTime,
+				TotalTraffic: subUser.TotalTrafficLimit,
+			}
+			if trafficLimit.StartTime == 0 && remote.TrafficLimit != nil {
+				trafficLimit.StartTime = remote.TrafficLimit.StartTime
+				trafficLimit.EndTime = remote.TrafficLimit.EndTime
+			}
+			err := r.svcCtx.IPPMClient.ModifyUser(ctx, &ippmclient.ModifyUserReq{UserName: subUser.Username, TrafficLimit: trafficLimit})
+			issue.Repaired = r.repairAction(err, issue)
+		}
+		issues = append(issues, issue)
+	}
+
+	// the throttled sub user run with the throttled rate limit
+	upload, download := subUser.EffectiveRateLimit()
+	if remote.UploadRateLimit != upload || remote.DownloadRateLimit != download {
+		detail := fmt.Sprintf("local upload/download rate limit %d/%d, remote %d/%d",
+			upload, download, remote.UploadRateLimit, remote.DownloadRateLimit)
+		issue := r.newIssue(IssueRateLimitMismatch, subUser, detail)
+		if repair {
+			err := r.svcCtx.IPPMClient.ModifyUser(ctx, &ippmclient.ModifyUserReq{
+				UserName:          subUser.Username,
+				UploadRateLimit:   &upload,
+				DownloadRateLimit: &download,
+			})
+			issue.Repaired = r.repairAction(err, issue)
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// checkAllocations recompute the allocated quota of users from their sub users
+func (r *Reconciler) checkAllocations(ctx context.Context, allocations map[string]*allocation, busyUsers map[string]struct{}, repair bool) ([]*types.ReconcileIssue, error) {
+	users, err := model.GetAllUsers(ctx, r.svcCtx.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]*types.ReconcileIssue, 0)
+	for _, user := range users {
+		if _, ok := busyUsers[user.UUID]; ok {
+			continue
+		}
+
+		alloc, ok := allocations[user.UUID]
+		if !ok {
+			alloc = &allocation{}
+		}
+
+		if alloc.bandwidth == user.MaxBandwidthAllocated && alloc.traffic == user.TotalTrafficAllocated {
+			continue
+		}
+
+		issue := &types.ReconcileIssue{
+			UserId: user.UUID,
+			Kind:   IssueAllocationMismatch,
+			Detail: fmt.Sprintf("allocated bandwidth/traffic %d/%d, sub users sum %d/%d",
+				user.MaxBandwidthAllocated, user.TotalTrafficAllocated, alloc.bandwidth, alloc.traffic),
+		}
+		if repair {
+			busy, err := r.hasPendingOp(ctx, user.UUID)
+			if err != nil {
+				logx.Errorf("recheck pending ops of %s failed:%v", user.UUID, err)
+				issue.Detail = fmt.Sprintf("%s, recheck failed: %v", issue.Detail, err)
+				issues = append(issues, issue)
+				continue
+			}
+			if busy {
+				continue
+			}
+
+			// the limits edited after the snapshots change the allocated or the sum, the write is refused then
+			err = model.SetAllocatedQuota(ctx, r.svcCtx.Redis, user, alloc.bandwidth, alloc.traffic)
+			if errors.Is(err, model.ErrAllocationChanged) {
+				logx.Infof("allocation of %s changed during reconcile, skip it", user.UUID)
+				continue
+			}
+			issue.Repaired = r.repairAction(err, issue)
+			if err == nil {
+				after := *user
+				after.MaxBandwidthAllocated = alloc.bandwidth
+				after.TotalTrafficAllocated = alloc.traffic
+				audit.Record(ctx, r.svcCtx, &audit.Entry{
+					UserID: user.UUID,
+					Action: audit.ActionReconcileQuota,
+					Before: user,
+					After:  &after,
+				})
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+// skipRepair return true if the issue is gone in the re-check, the failed re-check is reported without repair
+func (r *Reconciler) skipRepair(confirmed bool, err error, issue *types.ReconcileIssue) bool {
+	if err != nil {
+		logx.Errorf("recheck %s of %s failed:%v", issue.Kind, issue.Username, err)
+		issue.Detail = fmt.Sprintf("%s, recheck failed: %v", issue.Detail, err)
+		return false
+	}
+
+	if !confirmed {
+		logx.Infof("%s of %s changed during reconcile, skip it", issue.Kind, issue.Username)
+		return true
+	}
+	return false
+}
+
+// confirmRemoteMissing re-check the sub user right before deprecating it, the snapshots may be stale
+func (r *Reconciler) confirmRemoteMissing(ctx context.Context, username string) (bool, error) {
+	subUser, err := model.GetSubUser(r.svcCtx.Redis, username)
+	if err != nil {
+		return false, err
+	}
+	if subUser == nil || subUser.Status == constant.SubUserStatusDeprecated {
+		return false, nil
+	}
+
+	if busy, err := r.isPending(username); err != nil || busy {
+		return false, err
+	}
+
+	_, err = r.svcCtx.IPPMClient.GetUser(ctx, &ippmclient.GetUserReq{UserName: username})
+	if err == nil {
+		return false, nil
+	}
+	if ippmclient.IsStatus(err, http.StatusNotFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+// confirmLocalMissing re-check the user right before deleting it from the IPPM server
+func (r *Reconciler) confirmLocalMissing(ctx context.Context, username string) (bool, error) {
+	subUser, err := model.GetSubUser(r.svcCtx.Redis, username)
+	if err != nil {
+		return false, err
+	}
+	if subUser != nil {
+		return false, nil
+	}
+
+	if busy, err := r.isPending(username); err != nil || busy {
+		return false, err
+	}
+
+	_, err = r.svcCtx.IPPMClient.GetUser(ctx, &ippmclient.GetUserReq{UserName: username})
+	if err == nil {
+		return true, nil
+	}
+	if ippmclient.IsStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// confirmDeprecated re-check the sub user is still deprecated before deleting it from the IPPM server
+func (r *Reconciler) confirmDeprecated(username string) (bool, error) {
+	subUser, err := model.GetSubUser(r.svcCtx.Redis, username)
+	if err != nil {
+		return false, err
+	}
+	return subUser != nil && subUser.Status == constant.SubUserStatusDeprecated, nil
+}
+
+// hasPendingOp re-check the operations of the user, the quota reserved by them is not in the sub users yet
+func (r *Reconciler) hasPendingOp(ctx context.Context, uuid string) (bool, error) {
+	ops, err := model.GetPendingOpsBefore(ctx, r.svcCtx.Redis, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+
+	for _, op := range ops {
+		if op.UserID == uuid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reconciler) isPending(username string) (bool, error) {
+	op, err := model.GetPendingOp(r.svcCtx.Redis, username)
+	if err != nil {
+		return false, err
+	}
+	return op != nil, nil
+}
+
+// deprecate the sub user which not exist on IPPM server any more
+func (r *Reconciler) deprecate(subUser *model.SubUser) error {
+	if err := model.AddSubUserToDeprecatedList(r.svcCtx.Redis, subUser.UserID, subUser.Username); err != nil {
+		return err
+	}
+
+	before := *subUser
+	subUser.Status = constant.SubUserStatusDeprecated
+	subUser.DeprecatedTime = time.Now().Unix()
+	if err := model.UpdateSubUserFields(r.svcCtx.Redis, subUser, "status", "deprecated_time"); err != nil {
+		return err
+	}
+
+	audit.Record(context.Background(), r.svcCtx, &audit.Entry{
+		UserID:      subUser.UserID,
+		Action:      audit.ActionDeprecateSubUser,
+		SubUsername: subUser.Username,
+		Before:      &before,
+		After:       subUser,
+	})
+
+	r.svcCtx.EventBus.Publish(context.Background(), &event.Event{
+		Type:        event.TypeSubUserDeprecated,
+		UserID:      subUser.UserID,
+		SubUsername: subUser.Username,
+		Reason:      "reconcile",
+	})
+	return nil
+}
+
+func (r *Reconciler) listRemoteUsers(ctx context.Context) (map[string]*remoteUser, error) {
+	popsResp, err := r.svcCtx.IPPMClient.GetPops(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*remoteUser)
+	for _, pop := range popsResp.Pops {
+		start := 0
+		for {
+			listResp, err := r.svcCtx.IPPMClient.ListUser(ctx, &ippmclient.ListUserReq{PopID: pop.ID, Start: start, End: start + pageSize})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, user := range listResp.Users {
+				if !r.isOwnUser(user.UserName) {
+					continue
+				}
+				users[user.UserName] = &remoteUser{User: user, popID: pop.ID}
+			}
+
+			start += len(listResp.Users)
+			if len(listResp.Users) == 0 || start >= listResp.Total {
+				break
+			}
+		}
+	}
+
+	return users, nil
+}
+
+// the IPPM server may be shared by the prod and test environment
+func (r *Reconciler) isOwnUser(username string) bool {
+	isTest := strings.HasPrefix(username, constant.TestSubUserPrefix)
+	return isTest == (r.svcCtx.Config.RunMode != constant.RunModeProd)
+}
+
+func (r *Reconciler) newIssue(kind string, subUser *model.SubUser, detail string) *types.ReconcileIssue {
+	return &types.ReconcileIssue{
+		Username: subUser.Username,
+		UserId:   subUser.UserID,
+		PopId:    subUser.PopID,
+		Kind:     kind,
+		Detail:   detail,
+	}
+}
+
+func (r *Reconciler) repairAction(err error, issue *types.ReconcileIssue) bool {
+	if err != nil {
+		logx.Errorf("repair %s of %s %s failed:%v", issue.Kind, issue.UserId, issue.Username, err)
+		issue.Detail = fmt.Sprintf("%s, repair failed: %v", issue.Detail, err)
+		return false
+	}
+	return true
+}
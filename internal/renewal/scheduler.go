@@ -0,0 +1,206 @@
+package renewal
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const lockKey = "titan:ipweb:lock:renewal"
+
+// Scheduler renew or stop the sub users whose traffic period is end
+type Scheduler struct {
+	svcCtx   *svc.ServiceContext
+	interval time.Duration
+	done     chan struct{}
+}
+
+func NewScheduler(svcCtx *svc.ServiceContext) *Scheduler {
+	return &Scheduler{
+		svcCtx:   svcCtx,
+		interval: time.Duration(svcCtx.Config.Renewal.Interval) * time.Second,
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.run()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) Stop() {
+	close(s.done)
+}
+
+func (s *Scheduler) run() {
+	lock := redis.NewRedisLock(s.svcCtx.Redis, lockKey)
+	lock.SetExpire(int(s.interval.Seconds()))
+
+	ok, err := lock.Acquire()
+	if err != nil {
+		logx.Errorf("acquire renewal lock failed:%v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	ctx := context.Background()
+	subUsers, err := model.GetAllSubUsers(ctx, s.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all sub users failed:%v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, subUser := range subUsers {
+		if subUser.Status == constant.SubUserStatusDeprecated {
+			continue
+		}
+
+		if err := s.check(ctx, subUser, now); err != nil {
+			logx.Errorf("renewal check sub user %s failed:%v", subUser.Username, err)
+		}
+	}
+}
+
+func (s *Scheduler) check(ctx context.Context, subUser *model.SubUser, now int64) error {
+	// sub users created before period support did not save the period
+	if subUser.EndTime == 0 {
+		return s.backfill(ctx, subUser)
+	}
+
+	if subUser.EndTime > now {
+		return nil
+	}
+
+	if subUser.GetRenewMode() == model.RenewModeStop {
+		if subUser.Status != constant.SubUserStatusActive {
+			return nil
+		}
+
+		err := s.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "stop"})
+		if err != nil {
+			return err
+		}
+
+		logx.Infof("sub user %s period end, stop it", subUser.Username)
+		if err := model.SetSubUserStatus(s.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonPeriodEnd); err != nil {
+			return err
+		}
+		audit.RecordStatus(ctx, s.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonPeriodEnd)
+
+		s.svcCtx.EventBus.Publish(ctx, &event.Event{
+			Type:        event.TypeSubUserStopped,
+			UserID:      subUser.UserID,
+			SubUsername: subUser.Username,
+			Reason:      constant.StatusReasonPeriodEnd,
+		})
+		return nil
+	}
+
+	anchor := subUser.GetPeriodAnchor()
+	start, end := model.NextPeriod(anchor, subUser.EndTime, subUser.GetPeriodType(), subUser.PeriodDays, now)
+	modifyUserReq := &ippmclient.ModifyUserReq{
+		UserName: subUser.Username,
+		TrafficLimit: &ippmclient.TrafficLimit{
+			StartTime:    start,
+			EndTime:      end,
+			TotalTraffic: subUser.TotalTrafficLimit,
+		},
+	}
+	if err := s.svcCtx.IPPMClient.ModifyUser(ctx, modifyUserReq); err != nil {
+		return err
+	}
+
+	logx.Infof("renew sub user %s period %d - %d", subUser.Username, start, end)
+	if err := model.SetSubUserPeriod(s.svcCtx.Redis, subUser.Username, anchor, start, end); err != nil {
+		return err
+	}
+
+	after := *subUser
+	after.PeriodAnchor = anchor
+	after.StartTime = start
+	after.EndTime = end
+	after.NotifiedThreshold = 0
+	audit.Record(ctx, s.svcCtx, &audit.Entry{
+		UserID:      subUser.UserID,
+		Action:      audit.ActionRenewSubUser,
+		SubUsername: subUser.Username,
+		Before:      subUser,
+		After:       &after,
+		IPPMCalled:  true,
+	})
+
+	// the traffic is renewed, restart the sub user stopped by traffic exhausted
+	if subUser.Status == constant.SubUserStatusStop && subUser.StatusReason == constant.StatusReasonTrafficExhausted {
+		return s.restart(ctx, subUser)
+	}
+	return nil
+}
+
+func (s *Scheduler) restart(ctx context.Context, subUser *model.SubUser) error {
+	user, err := model.GetUser(s.svcCtx.Redis, subUser.UserID)
+	if err != nil {
+		return err
+	}
+
+	// keep it stop, the unfreeze will start it
+	if user != nil && user.Frozen {
+		if err := model.SetSubUserStatus(s.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonAccountFrozen); err != nil {
+			return err
+		}
+		audit.RecordStatus(ctx, s.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonAccountFrozen)
+		return nil
+	}
+
+	err = s.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "start"})
+	if err != nil {
+		return err
+	}
+
+	if err := model.SetSubUserStatus(s.svcCtx.Redis, subUser.Username, constant.SubUserStatusActive, ""); err != nil {
+		return err
+	}
+	audit.RecordStatus(ctx, s.svcCtx, subUser, constant.SubUserStatusActive, "")
+
+	s.svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:        event.TypeSubUserStarted,
+		UserID:      subUser.UserID,
+		SubUsername: subUser.Username,
+		Reason:      constant.StatusReasonPeriodRenewed,
+	})
+	return nil
+}
+
+func (s *Scheduler) backfill(ctx context.Context, subUser *model.SubUser) error {
+	resp, err := s.svcCtx.IPPMClient.GetUser(ctx, &ippmclient.GetUserReq{UserName: subUser.Username})
+	if err != nil {
+		return err
+	}
+
+	if resp.TrafficLimit == nil || resp.TrafficLimit.EndTime == 0 {
+		return nil
+	}
+
+	return model.SetSubUserPeriod(s.svcCtx.Redis, subUser.Username, resp.TrafficLimit.StartTime, resp.TrafficLimit.StartTime, resp.TrafficLimit.EndTime)
+}
@@ -0,0 +1,84 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const retrierLockKey = "titan:ipweb:lock:saga"
+
+// Retrier resolve the pending operations left by crash or failed compensation
+type Retrier struct {
+	svcCtx   *svc.ServiceContext
+	interval time.Duration
+	timeout  time.Duration
+	done     chan struct{}
+}
+
+func NewRetrier(svcCtx *svc.ServiceContext) *Retrier {
+	return &Retrier{
+		svcCtx:   svcCtx,
+		interval: time.Duration(svcCtx.Config.Saga.RetryInterval) * time.Second,
+		timeout:  time.Duration(svcCtx.Config.Saga.Timeout) * time.Second,
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Retrier) Start() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.retry()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Retrier) Stop() {
+	close(r.done)
+}
+
+func (r *Retrier) retry() {
+	// only one instance retry at the same time
+	lock := redis.NewRedisLock(r.svcCtx.Redis, retrierLockKey)
+	lock.SetExpire(int(r.interval.Seconds()))
+
+	ok, err := lock.Acquire()
+	if err != nil {
+		logx.Errorf("acquire saga lock failed:%v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	ctx := context.Background()
+	before := time.Now().Add(-r.timeout).Unix()
+	ops, err := model.GetPendingOpsBefore(ctx, r.svcCtx.Redis, before)
+	if err != nil {
+		logx.Errorf("get pending ops failed:%v", err)
+		return
+	}
+
+	for _, op := range ops {
+		if err := Resolve(ctx, r.svcCtx, op); err != nil {
+			logx.Errorf("resolve pending op %s of sub user %s failed, retries %d:%v", op.Kind, op.SubUsername, op.Retries, err)
+			if err := model.IncrPendingOpRetries(r.svcCtx.Redis, op.SubUsername); err != nil {
+				logx.Errorf("increase pending op retries failed:%v", err)
+			}
+			continue
+		}
+		logx.Infof("resolve pending op %s of sub user %s", op.Kind, op.SubUsername)
+	}
+}
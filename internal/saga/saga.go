@@ -0,0 +1,184 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Resolve finish or undo a pending operation, it is safe to call more than once
+func Resolve(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	switch op.Kind {
+	case model.PendingOpCreate:
+		return resolveCreate(ctx, svcCtx, op)
+	case model.PendingOpDelete:
+		return FinishDelete(ctx, svcCtx, op)
+	case model.PendingOpDeprecate:
+		return FinishDeprecate(ctx, svcCtx, op)
+	}
+
+	logx.Errorf("unknown pending op kind %s for sub user %s", op.Kind, op.SubUsername)
+	return model.RemovePendingOp(svcCtx.Redis, op.SubUsername)
+}
+
+// IsRejected reports whether the IPPM server refused the operation,
+// the journal of a rejected operation can be dropped. only the failure response and
+// the 4xx are refused, the 5xx and timeout may be applied, the retrier resolve them.
+// the not found is not a refusal either, the user is gone already
+func IsRejected(err error) bool {
+	var e *ippmclient.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	switch {
+	case e.StatusCode == http.StatusOK:
+		// success is false
+		return true
+	case e.StatusCode == http.StatusNotFound, e.StatusCode == http.StatusRequestTimeout:
+		return false
+	}
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError
+}
+
+// RollbackCreate undo a sub user creation: delete the user on the IPPM server,
+// remove the local record and give back the reserved quota
+func RollbackCreate(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	logx.Infof("rollback create sub user %s", op.SubUsername)
+	if err := deleteRemoteUser(ctx, svcCtx, op.SubUsername); err != nil {
+		return err
+	}
+
+	if err := model.RemoveSubUser(svcCtx.Redis, op.UserID, op.SubUsername); err != nil {
+		return err
+	}
+
+	if err := releaseQuota(ctx, svcCtx, op); err != nil {
+		return err
+	}
+
+	return model.RemovePendingOp(svcCtx.Redis, op.SubUsername)
+}
+
+// FinishDelete complete a sub user deletion after the user was removed from the IPPM server
+func FinishDelete(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	if err := deleteRemoteUser(ctx, svcCtx, op.SubUsername); err != nil {
+		return err
+	}
+
+	if err := releaseQuota(ctx, svcCtx, op); err != nil {
+		return err
+	}
+
+	if err := model.RemoveSubUser(svcCtx.Redis, op.UserID, op.SubUsername); err != nil {
+		return err
+	}
+
+	return model.RemovePendingOp(svcCtx.Redis, op.SubUsername)
+}
+
+// FinishDeprecate complete a sub user deprecation after the user was removed from the IPPM server
+func FinishDeprecate(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	if err := deleteRemoteUser(ctx, svcCtx, op.SubUsername); err != nil {
+		return err
+	}
+
+	subUser, err := model.GetSubUser(svcCtx.Redis, op.SubUsername)
+	if err != nil {
+		return err
+	}
+
+	if subUser != nil && subUser.Status != constant.SubUserStatusDeprecated {
+		if err := model.AddSubUserToDeprecatedList(svcCtx.Redis, op.UserID, op.SubUsername); err != nil {
+			return err
+		}
+
+		subUser.Status = constant.SubUserStatusDeprecated
+		subUser.DeprecatedTime = time.Now().Unix()
+		if err := model.UpdateSubUserFields(svcCtx.Redis, subUser, "status", "deprecated_time"); err != nil {
+			return err
+		}
+	}
+
+	if err := releaseQuota(ctx, svcCtx, op); err != nil {
+		return err
+	}
+
+	return model.RemovePendingOp(svcCtx.Redis, op.SubUsername)
+}
+
+// resolveCreate keep the sub user if all the steps were done before crash, otherwise rollback
+func resolveCreate(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	subUser, err := model.GetSubUser(svcCtx.Redis, op.SubUsername)
+	if err != nil {
+		return err
+	}
+
+	inList, err := model.IsSubUserInList(svcCtx.Redis, op.UserID, op.SubUsername)
+	if err != nil {
+		return err
+	}
+
+	if subUser != nil && inList && op.QuotaReserved {
+		exist, err := remoteUserExists(ctx, svcCtx, op.SubUsername)
+		if err != nil {
+			return err
+		}
+
+		if exist {
+			return model.RemovePendingOp(svcCtx.Redis, op.SubUsername)
+		}
+	}
+
+	return RollbackCreate(ctx, svcCtx, op)
+}
+
+func releaseQuota(ctx context.Context, svcCtx *svc.ServiceContext, op *model.PendingOp) error {
+	if !op.QuotaReserved || op.QuotaReleased {
+		return nil
+	}
+
+	if err := model.ReleaseQuota(ctx, svcCtx.Redis, op.UserID, op.MaxBandwidthLimit, op.TotalTrafficLimit); err != nil {
+		return err
+	}
+
+	op.QuotaReleased = true
+	return model.SetPendingOpQuotaReleased(svcCtx.Redis, op.SubUsername)
+}
+
+func deleteRemoteUser(ctx context.Context, svcCtx *svc.ServiceContext, username string) error {
+	exist, err := remoteUserExists(ctx, svcCtx, username)
+	if err != nil {
+		return err
+	}
+
+	if !exist {
+		return nil
+	}
+
+	return svcCtx.IPPMClient.DeleteUser(ctx, &ippmclient.DeleteUserReq{UserName: username})
+}
+
+// remoteUserExists treat only the not found of IPPM server as user not exist,
+// the other errors such as auth failure are returned to retry later
+func remoteUserExists(ctx context.Context, svcCtx *svc.ServiceContext, username string) (bool, error) {
+	_, err := svcCtx.IPPMClient.GetUser(ctx, &ippmclient.GetUserReq{UserName: username})
+	if err == nil {
+		return true, nil
+	}
+
+	if ippmclient.IsStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("check user %s on ippm server: %w", username, err)
+}
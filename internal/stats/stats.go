@@ -0,0 +1,239 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"titan-ipweb/internal/config"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// Service fetch the base stats of sub users from the IPPM server in batches, and cache them for a short while
+type Service struct {
+	client *ippmclient.Client
+	rdb    *redis.Redis
+	config config.Stats
+}
+
+// Result is the base stats of the sub users, the ones can not fetch are in Failed with the reason
+type Result struct {
+	Stats  map[string]*ippmclient.UserBaseStatsResp
+	Failed map[string]string
+}
+
+func NewService(client *ippmclient.Client, rdb *redis.Redis, c config.Stats) *Service {
+	return &Service{client: client, rdb: rdb, config: c}
+}
+
+// FailedUsernames return the usernames failed to fetch
+func (r *Result) FailedUsernames() []string {
+	usernames := make([]string, 0, len(r.Failed))
+	for username := range r.Failed {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// BaseStats return the base stats of the sub users, read the cache first and fetch the rest
+func (s *Service) BaseStats(ctx context.Context, usernames []string) *Result {
+	result := &Result{
+		Stats:  make(map[string]*ippmclient.UserBaseStatsResp, len(usernames)),
+		Failed: make(map[string]string),
+	}
+
+	usernames = dedupe(usernames)
+	if len(usernames) == 0 {
+		return result
+	}
+
+	cached, err := model.GetBaseStatsCache(ctx, s.rdb, usernames)
+	if err != nil {
+		// fetch all from the IPPM server
+		logx.Errorf("get base stats cache failed:%v", err)
+		cached = map[string]string{}
+	}
+
+	missing := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		value, ok := cached[username]
+		if !ok {
+			missing = append(missing, username)
+			continue
+		}
+
+		stats := &ippmclient.UserBaseStatsResp{}
+		if err := json.Unmarshal([]byte(value), stats); err != nil {
+			missing = append(missing, username)
+			continue
+		}
+		result.Stats[username] = stats
+	}
+
+	if len(missing) == 0 {
+		return result
+	}
+
+	fetched := s.fetch(ctx, missing)
+	values := make(map[string]string, len(fetched.Stats))
+	for username, stats := range fetched.Stats {
+		result.Stats[username] = stats
+
+		buf, err := json.Marshal(stats)
+		if err != nil {
+			continue
+		}
+		values[username] = string(buf)
+	}
+
+	for username, reason := range fetched.Failed {
+		result.Failed[username] = reason
+	}
+
+	if err := model.SetBaseStatsCache(ctx, s.rdb, values, s.config.CacheTTL); err != nil {
+		logx.Errorf("set base stats cache failed:%v", err)
+	}
+
+	if len(result.Failed) > 0 {
+		logx.Errorf("fetch base stats of %d sub users failed", len(result.Failed))
+	}
+	return result
+}
+
+// fetch the base stats from the IPPM server, split into batches run by the workers
+func (s *Service) fetch(ctx context.Context, usernames []string) *Result {
+	result := &Result{
+		Stats:  make(map[string]*ippmclient.UserBaseStatsResp, len(usernames)),
+		Failed: make(map[string]string),
+	}
+	mu := sync.Mutex{}
+	// the IPPM server not support the batch request yet, fetch them one by one after the batches
+	unbatched := make([]string, 0)
+
+	batches := split(usernames, s.config.BatchSize)
+	mr.ForEach(func(source chan<- []string) {
+		for _, batch := range batches {
+			source <- batch
+		}
+	}, func(batch []string) {
+		batchResult, ok := s.fetchBatch(ctx, batch)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !ok {
+			unbatched = append(unbatched, batch...)
+			return
+		}
+		result.merge(batchResult)
+	}, mr.WithWorkers(s.config.Workers))
+
+	if len(unbatched) > 0 {
+		result.merge(s.fetchOneByOne(ctx, unbatched))
+	}
+	return result
+}
+
+func (r *Result) merge(other *Result) {
+	for username, stats := range other.Stats {
+		r.Stats[username] = stats
+	}
+	for username, reason := range other.Failed {
+		r.Failed[username] = reason
+	}
+}
+
+// fetchBatch return false if the IPPM server not support the batch request
+func (s *Service) fetchBatch(ctx context.Context, usernames []string) (*Result, bool) {
+	result := &Result{
+		Stats:  make(map[string]*ippmclient.UserBaseStatsResp, len(usernames)),
+		Failed: make(map[string]string),
+	}
+
+	resp, err := s.client.GetUsersBaseStats(ctx, &ippmclient.UsersBaseStatsReq{Usernames: usernames})
+	if ippmclient.IsStatus(err, http.StatusNotFound) {
+		return nil, false
+	}
+
+	if err != nil {
+		for _, username := range usernames {
+			result.Failed[username] = err.Error()
+		}
+		return result, true
+	}
+
+	for _, username := range usernames {
+		if stats, ok := resp.Stats[username]; ok && stats != nil {
+			result.Stats[username] = stats
+			continue
+		}
+
+		reason, ok := resp.Errors[username]
+		if !ok {
+			reason = "stats not returned"
+		}
+		result.Failed[username] = reason
+	}
+	return result, true
+}
+
+// fetchOneByOne request the sub users one by one, run by the workers
+func (s *Service) fetchOneByOne(ctx context.Context, usernames []string) *Result {
+	result := &Result{
+		Stats:  make(map[string]*ippmclient.UserBaseStatsResp, len(usernames)),
+		Failed: make(map[string]string),
+	}
+	mu := sync.Mutex{}
+
+	mr.ForEach(func(source chan<- string) {
+		for _, username := range usernames {
+			source <- username
+		}
+	}, func(username string) {
+		stats, err := s.client.GetUserBaseStats(ctx, &ippmclient.UserBaseStatsReq{Username: username})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Failed[username] = err.Error()
+			return
+		}
+		result.Stats[username] = stats
+	}, mr.WithWorkers(s.config.Workers))
+
+	return result
+}
+
+func dedupe(usernames []string) []string {
+	seen := make(map[string]bool, len(usernames))
+	unique := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		unique = append(unique, username)
+	}
+	return unique
+}
+
+func split(usernames []string, size int) [][]string {
+	if size <= 0 {
+		size = len(usernames)
+	}
+
+	batches := make([][]string, 0, (len(usernames)+size-1)/size)
+	for start := 0; start < len(usernames); start += size {
+		end := start + size
+		if end > len(usernames) {
+			end = len(usernames)
+		}
+		batches = append(batches, usernames[start:end])
+	}
+	return batches
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"titan-ipweb/internal/config"
+	"titan-ipweb/ippmclient"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func TestBaseStats(t *testing.T) {
+	var batchCalls, singleCalls int32
+	batchSupported := true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/stats/base/batch", func(w http.ResponseWriter, r *http.Request) {
+		if !batchSupported {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&batchCalls, 1)
+
+		req := &ippmclient.UsersBaseStatsReq{}
+		json.NewDecoder(r.Body).Decode(req)
+
+		resp := &ippmclient.UsersBaseStatsResp{Stats: map[string]*ippmclient.UserBaseStatsResp{}, Errors: map[string]string{}}
+		for _, username := range req.Usernames {
+			if username == "bad" {
+				resp.Errors[username] = "user not exist"
+				continue
+			}
+			resp.Stats[username] = &ippmclient.UserBaseStatsResp{TotalTraffic: int64(len(username))}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/user/stats/base", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&singleCalls, 1)
+		json.NewEncoder(w).Encode(&ippmclient.UserBaseStatsResp{TotalTraffic: 1})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := miniredis.RunT(t)
+	client := ippmclient.NewClient(server.URL, "token", time.Second)
+	s := NewService(client, redis.New(m.Addr()), config.Stats{CacheTTL: 10, BatchSize: 2, Workers: 2})
+	ctx := context.Background()
+
+	result := s.BaseStats(ctx, []string{"a", "bb", "ccc", "bad", "a"})
+	if len(result.Stats) != 3 || result.Stats["ccc"].TotalTraffic != 3 {
+		t.Fatalf("unexpected stats %#v", result.Stats)
+	}
+	if result.Failed["bad"] == "" || len(result.Failed) != 1 {
+		t.Fatalf("unexpected failed %#v", result.Failed)
+	}
+	if atomic.LoadInt32(&batchCalls) != 2 {
+		t.Fatalf("expect 2 batch calls, got %d", batchCalls)
+	}
+
+	// served from the cache, the failed one is fetched again
+	result = s.BaseStats(ctx, []string{"a", "bb", "bad"})
+	if len(result.Stats) != 2 || atomic.LoadInt32(&batchCalls) != 3 {
+		t.Fatalf("unexpected stats %#v with %d batch calls", result.Stats, batchCalls)
+	}
+
+	// the cache expired and the server not support the batch request
+	m.FastForward(11 * time.Second)
+	batchSupported = false
+	result = s.BaseStats(ctx, []string{"a", "bb"})
+	if len(result.Stats) != 2 || atomic.LoadInt32(&singleCalls) != 2 {
+		t.Fatalf("unexpected stats %#v with %d single calls", result.Stats, singleCalls)
+	}
+}
@@ -3,11 +3,16 @@ package svc
 import (
 	"time"
 	"titan-ipweb/internal/config"
+	"titan-ipweb/internal/event"
 	"titan-ipweb/internal/middleware"
 	"titan-ipweb/internal/pop"
+	"titan-ipweb/internal/stats"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
 	"titan-ipweb/user"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/zeromicro/go-zero/core/limit"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stores/redis"
 	"github.com/zeromicro/go-zero/rest"
@@ -17,17 +22,29 @@ import (
 const (
 	tokenExpire = 100 * 24 * 60 * 60
 	userIPweb   = "ipweb"
+
+	switchNodeLimitKeyPrefix = "titan:ipweb:limit:switchnode:"
 )
 
 type ServiceContext struct {
-	Config         config.Config
-	Header         rest.Middleware
-	UserAgent      rest.Middleware
-	UserRpc        user.UserServiceClient
-	Auth           rest.Middleware
-	Redis          *redis.Redis
-	IPPMAcessToken string
-	PopManager     *pop.Manager
+	Config    config.Config
+	Header    rest.Middleware
+	UserAgent rest.Middleware
+	UserRpc   user.UserServiceClient
+	Auth      rest.Middleware
+	Admin     rest.Middleware
+	// admin or owner, mutate the sub users of the account, team viewer can not
+	Owner rest.Middleware
+	// admin or viewer, inspect any account
+	Staff      rest.Middleware
+	Redis      *redis.Redis
+	IPPMClient *ippmclient.Client
+	PopManager *pop.Manager
+	// limit the frequency of switching node per sub user
+	SwitchNodeLimit *limit.PeriodLimit
+	EventBus        *event.Bus
+	// base stats of sub users, fetched in batches and cached
+	Stats *stats.Service
 }
 
 func NewServiceContext(c config.Config) *ServiceContext {
@@ -37,20 +54,34 @@ func NewServiceContext(c config.Config) *ServiceContext {
 	}
 	logx.Debugf("authToken:%s", string(authToken))
 
-	popManager, err := pop.NewPopManager(c.IPPMServer.URL, string(authToken))
+	ippmClient := ippmclient.NewClient(c.IPPMServer.URL, string(authToken), time.Duration(c.IPPMServer.Timeout)*time.Millisecond)
+
+	popManager, err := pop.NewPopManager(ippmClient)
 	if err != nil {
 		panic("get ippm access token error" + err.Error())
 	}
 
+	if err := model.SetPasswordKeys(c.Password.KeyID, c.Password.Keys); err != nil {
+		panic("set password keys error " + err.Error())
+	}
+
+	rdb := redis.MustNewRedis(c.Redis)
+
 	return &ServiceContext{
-		Config:         c,
-		Header:         middleware.NewHeaderMiddleware().Handle,
-		UserAgent:      middleware.NewUserAgentMiddleware().Handle,
-		UserRpc:        user.NewUserServiceClient(zrpc.MustNewClient(c.UserRpc).Conn()),
-		Auth:           middleware.NewAuthMiddleware(c.TokenAuth.AccessSecret).Handle,
-		Redis:          redis.MustNewRedis(c.Redis),
-		IPPMAcessToken: string(authToken),
-		PopManager:     popManager,
+		Config:          c,
+		Header:          middleware.NewHeaderMiddleware().Handle,
+		UserAgent:       middleware.NewUserAgentMiddleware().Handle,
+		UserRpc:         user.NewUserServiceClient(zrpc.MustNewClient(c.UserRpc).Conn()),
+		Auth:            middleware.NewAuthMiddleware(c.TokenAuth.AccessSecret, rdb, c.Admin.Emails).Handle,
+		Admin:           middleware.NewRoleMiddleware(middleware.RoleAdmin).Handle,
+		Owner:           middleware.NewRoleMiddleware(middleware.RoleAdmin, middleware.RoleOwner).WithTeamRoles(model.TeamRoleOwner, model.TeamRoleMember).Handle,
+		Staff:           middleware.NewRoleMiddleware(middleware.RoleAdmin, middleware.RoleViewer).Handle,
+		Redis:           rdb,
+		IPPMClient:      ippmClient,
+		PopManager:      popManager,
+		SwitchNodeLimit: limit.NewPeriodLimit(c.SwitchNode.Period, c.SwitchNode.Quota, rdb, switchNodeLimitKeyPrefix),
+		EventBus:        event.NewBus(),
+		Stats:           stats.NewService(ippmClient, rdb, c.Stats),
 		// Pops:           pops,
 	}
 }
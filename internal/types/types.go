@@ -3,6 +3,58 @@
 
 package types
 
+type APIKey struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	ExpireTime   int64    `json:"expire_time"`
+	CreateTime   int64    `json:"create_time"`
+	LastUsedTime int64    `json:"last_used_time"`
+}
+
+type AcceptTeamInviteReq struct {
+	TeamId string `json:"team_id"`
+	Code   string `json:"code"` // the verification code in the invitation email
+}
+
+type AccountUsageResponse struct {
+	TrafficConsumed   int64 `json:"traffic_consumed"`
+	TotalTrafficLimit int64 `json:"total_traffic_limit"`
+	BillingStart      int64 `json:"billing_start"`
+	BillingEnd        int64 `json:"billing_end"`
+	Suspended         bool  `json:"suspended"`
+}
+
+type AdminAccount struct {
+	UserId                string `json:"user_id"`
+	Email                 string `json:"email"`
+	Index                 int64  `json:"index"`
+	MaxBandwidthLimit     int64  `json:"max_bandwidth_limit"`
+	MaxBandwidthAllocated int64  `json:"max_bandwidth_allocated"`
+	TotalTrafficLimit     int64  `json:"total_traffic_limit"`
+	TotalTrafficAllocated int64  `json:"total_traffic_allocated"`
+	TrafficConsumed       int64  `json:"traffic_consumed"`
+	Suspended             bool   `json:"suspended"`
+	Frozen                bool   `json:"frozen"`
+}
+
+type AuditChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type AuditEntry struct {
+	Id         string                  `json:"id"`
+	Time       int64                   `json:"time"`
+	ActorId    string                  `json:"actor_id"`
+	ActorEmail string                  `json:"actor_email"`
+	ClientIP   string                  `json:"client_ip"`
+	Action     string                  `json:"action"`
+	Username   string                  `json:"username"`
+	Diff       map[string]*AuditChange `json:"diff"`        // changed fields of the sub user or the account
+	IPPMResult string                  `json:"ippm_result"` // empty if IPPM not called
+}
+
 type BaseResponse struct {
 	Code int64       `json:"code"`
 	Msg  string      `json:"msg"`
@@ -10,28 +62,158 @@ type BaseResponse struct {
 	Data interface{} `json:"data"`
 }
 
+type BatchCreateResult struct {
+	Username string   `json:"username"`
+	SubUser  *SubUser `json:"sub_user"` // nil if failed
+	Error    string   `json:"error"`
+}
+
+type BatchCreateSubUserReq struct {
+	Count             int             `json:"count,optional"` // create Count sub users named Prefix001, Prefix002... if Users is empty
+	Prefix            string          `json:"prefix,optional"`
+	StartIndex        int             `json:"start_index,default=1"` // the number of the first generated name
+	Users             []*BatchSubUser `json:"users,optional"`
+	PopId             string          `json:"pop_id"` // the options below are shared by all the sub users
+	Route             *Route          `json:"route,optional"`
+	UploadRateLimit   int64           `json:"upload_rate_limit,default=655360"`
+	DownloadRateLimit int64           `json:"download_rate_limit,default=1310720"`
+	MaxBandwidthLimit int64           `json:"max_bandwidth_limit,default=13107200"`
+	TotalTrafficLimit int64           `json:"total_traffic_limit,default=1073741824000"`
+	PeriodType        string          `json:"period_type,default=month"`
+	PeriodDays        int64           `json:"period_days,optional"`
+	RenewMode         string          `json:"renew_mode,default=auto"`
+}
+
+type BatchCreateSubUserResponse struct {
+	Results   []*BatchCreateResult `json:"results"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+}
+
+type BatchDeprecatedSubUserReq struct {
+	Usernames []string       `json:"usernames,optional"`
+	Filter    *SubUserFilter `json:"filter,optional"`
+}
+
+type BatchEditSubUserLimitReq struct {
+	Usernames         []string       `json:"usernames,optional"`
+	Filter            *SubUserFilter `json:"filter,optional"`
+	MaxBandwidthLimit *int64         `json:"max_bandwidth_limit,optional"`
+	TotalTrafficLimit *int64         `json:"total_traffic_limit,optional"`
+	Route             *Route         `json:"route,optional"`
+	UploadRateLimit   *int64         `json:"upload_rate_limit,optional"`
+	DownloadRateLimit *int64         `json:"download_rate_limit,optional"`
+}
+
+type BatchResponse struct {
+	Results   []*BatchResult `json:"results"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+}
+
+type BatchResult struct {
+	Username string `json:"username"`
+	Error    string `json:"error"` // empty if success
+}
+
+type BatchSubUser struct {
+	Username string `json:"username"`
+	Password string `json:"password,optional"` // if Password is empty, will generate a random one
+}
+
+type BatchUpdateSubUserStatusReq struct {
+	Usernames []string       `json:"usernames,optional"` // select the sub users by Usernames or Filter
+	Filter    *SubUserFilter `json:"filter,optional"`
+	Status    string         `json:"status"`
+}
+
+type CreateAPIKeyReq struct {
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes,optional"`      // read or manage, empty means all
+	ExpireDays int64    `json:"expire_days,optional"` // 0 means never expire
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"` // only return once
+}
+
 type CreateSubUserReq struct {
 	Username          string `json:"username"`
-	Password          string `json:"password"`
+	Password          string `json:"password,optional"`
 	PopId             string `json:"pop_id"`
+	Route             *Route `json:"route,optional"`
 	UploadRateLimit   int64  `json:"upload_rate_limit,default=655360"`
 	DownloadRateLimit int64  `json:"download_rate_limit,default=1310720"`
 	MaxBandwidthLimit int64  `json:"max_bandwidth_limit,default=13107200"`
 	TotalTrafficLimit int64  `json:"total_traffic_limit,default=1073741824000"`
+	PeriodType        string `json:"period_type,default=month"`
+	PeriodDays        int64  `json:"period_days,optional"`
+	RenewMode         string `json:"renew_mode,default=auto"`
+}
+
+type CreateTeamReq struct {
+	Name string `json:"name"`
+}
+
+type CreateWebhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,optional"`
 }
 
 type DeleteSubUserReq struct {
 	Username string `json:"username"`
 }
 
+type DeleteWebhookReq struct {
+	Id string `json:"id"`
+}
+
 type DeprecatedSubUserReq struct {
 	Username string `json:"username"`
 }
 
+type EditAccountQuotaReq struct {
+	UserId            string `json:"user_id"`
+	MaxBandwidthLimit *int64 `json:"max_bandwidth_limit,optional"`
+	TotalTrafficLimit *int64 `json:"total_traffic_limit,optional"`
+}
+
+type EditRenewalPolicyReq struct {
+	Username   string `json:"username"`
+	PeriodType string `json:"period_type"`
+	PeriodDays int64  `json:"period_days,optional"`
+	RenewMode  string `json:"renew_mode"`
+}
+
 type EditSubUserLimitReq struct {
 	Username          string `json:"username"`
 	MaxBandwidthLimit *int64 `json:"max_bandwidth_limit,optional"`
 	TotalTrafficLimit *int64 `json:"total_traffic_limit,optional"`
+	Route             *Route `json:"route,optional"`
+	UploadRateLimit   *int64 `json:"upload_rate_limit,optional"`
+	DownloadRateLimit *int64 `json:"download_rate_limit,optional"`
+}
+
+type ExportSubUserReq struct {
+	Format string `form:"format,default=csv,options=csv|json"` // csv or json
+}
+
+type FreezeAccountReq struct {
+	UserId string `json:"user_id"`
+	Frozen bool   `json:"frozen"` // false to unfreeze
+}
+
+type GetAccountReq struct {
+	UserId string `form:"user_id"`
+}
+
+type GetRenewalPolicyReq struct {
+	Username string `form:"username"`
+}
+
+type GetSubUserReq struct {
+	Username string `form:"username"`
 }
 
 type GetSubUserUsageResponse struct {
@@ -40,6 +222,14 @@ type GetSubUserUsageResponse struct {
 	TotalCurrentBandwidth int64           `json:"total_current_bandwidth"` // 实时带宽
 	TotalTopBandwidth     int             `json:"total_top_bandwidth"`     // 峰值带宽
 	Count                 *SubUserCount   `json:"count"`                   // 子账号数量，停止，获取，废弃的统计
+	StatsFailed           []string        `json:"stats_failed"`            // 获取流量统计失败的子账号
+}
+
+type GetTeamResponse struct {
+	Team    *Team         `json:"team"`
+	Role    string        `json:"role"` // role of the caller in the team
+	Members []*TeamMember `json:"members"`
+	Invites []*TeamInvite `json:"invites"`
 }
 
 type GetTotalQuotaResponse struct {
@@ -48,6 +238,56 @@ type GetTotalQuotaResponse struct {
 	TotalBandwidthAllocated int64 `json:"total_bandwidth_allocated"`
 	TotalTrafficAllocated   int64 `json:"total_traffic_allocated"`
 	SubUserCount            int64 `json:"sub_user_count"`
+	MaxUploadRateLimit      int64 `json:"max_upload_rate_limit"`
+	MaxDownloadRateLimit    int64 `json:"max_download_rate_limit"`
+}
+
+type InspectAccountReq struct {
+	UserId string `form:"user_id"`
+	Start  int    `form:"start"`
+	End    int    `form:"end"`
+}
+
+type InspectAccountResponse struct {
+	UserId   string                 `json:"user_id"`
+	Email    string                 `json:"email"`
+	Quota    *GetTotalQuotaResponse `json:"quota"`
+	Usage    *AccountUsageResponse  `json:"usage"`
+	SubUsers []*SubUser             `json:"sub_users"`
+	Total    int                    `json:"total"`
+}
+
+type InviteTeamMemberReq struct {
+	Email string `json:"email"`
+	Role  string `json:"role"` // member or viewer
+}
+
+type ListAPIKeyResponse struct {
+	APIKeys []*APIKey `json:"api_keys"`
+}
+
+type ListAccountsReq struct {
+	Start int `form:"start"`
+	End   int `form:"end"`
+}
+
+type ListAccountsResponse struct {
+	Accounts []*AdminAccount `json:"accounts"`
+	Total    int             `json:"total"`
+}
+
+type ListAuditReq struct {
+	Username  string `form:"username,optional"`
+	Action    string `form:"action,optional"`
+	StartTime int64  `form:"start_time,optional"` // unix second
+	EndTime   int64  `form:"end_time,optional"`
+	Cursor    string `form:"cursor,optional"` // next_cursor of the previous page, empty for the first page
+	Size      int    `form:"size,default=20"`
+}
+
+type ListAuditResponse struct {
+	Entries    []*AuditEntry `json:"entries"`
+	NextCursor string        `json:"next_cursor"` // empty if no more entries
 }
 
 type ListDeprecatedSubUserReq struct {
@@ -65,13 +305,36 @@ type ListPopsResponse struct {
 }
 
 type ListSubUserReq struct {
-	Start int `form:"start"`
-	End   int `form:"end"`
+	Start  int    `form:"start,optional"`
+	End    int    `form:"end,optional"`
+	Status string `form:"status,optional"` // active or stop
+	PopId  string `form:"pop_id,optional"`
+	Search string `form:"search,optional"` // search by the prefix of the username given at creation
+	Sort   string `form:"sort,optional"`   // create_time or traffic
+	Order  string `form:"order,default=asc,options=asc|desc"`
+	Cursor string `form:"cursor,optional"` // used instead of Start and End if any filter, sort, Cursor or Size is set
+	Size   int    `form:"size,optional"`
 }
 
 type ListSubUserResponse struct {
-	Users []*SubUser `json:"sub_users"`
-	Total int        `json:"total"`
+	Users       []*SubUser `json:"sub_users"`
+	Total       int        `json:"total"`        // count of the matched sub users
+	NextCursor  string     `json:"next_cursor"`  // empty if no more sub users
+	StatsFailed []string   `json:"stats_failed"` // 获取流量统计失败的子账号
+}
+
+type ListWebhookDeliveryReq struct {
+	Id    string `form:"id"`
+	Start int    `form:"start"`
+	End   int    `form:"end"`
+}
+
+type ListWebhookDeliveryResponse struct {
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+}
+
+type ListWebhookResponse struct {
+	Webhooks []*Webhook `json:"webhooks"`
 }
 
 type LoginByGoogleRequest struct {
@@ -107,6 +370,16 @@ type LoginResponse struct {
 	ExpiresAt    int64  `json:"expires_at"`
 }
 
+type ModifySubUserPasswordReq struct {
+	Username string `json:"username"`
+	Password string `json:"password,optional"`
+}
+
+type ModifySubUserPasswordResponse struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 type Pop struct {
 	Name         string `json:"name"`
 	ID           string `json:"id"`
@@ -115,6 +388,24 @@ type Pop struct {
 	Socks5Server string `json:"socks5_server"`
 }
 
+type ReconcileIssue struct {
+	Username string `json:"username"`
+	UserId   string `json:"user_id"`
+	PopId    string `json:"pop_id"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+type ReconcileReq struct {
+	Repair bool `json:"repair,optional"`
+}
+
+type ReconcileResponse struct {
+	Checked int               `json:"checked"`
+	Issues  []*ReconcileIssue `json:"issues"`
+}
+
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
@@ -127,6 +418,19 @@ type RefreshTokenResponse struct {
 	ExpiresAt    int64  `json:"expires_at"`
 }
 
+type RemoveTeamMemberReq struct {
+	UserId string `json:"user_id"`
+}
+
+type RenewalPolicy struct {
+	Username   string `json:"username"`
+	PeriodType string `json:"period_type"`
+	PeriodDays int64  `json:"period_days"`
+	RenewMode  string `json:"renew_mode"`
+	StartTime  int64  `json:"start_time"`
+	EndTime    int64  `json:"end_time"`
+}
+
 type ResetPasswordRequest struct {
 	Email      string `json:"email"`
 	Password   string `json:"password"`
@@ -141,6 +445,17 @@ type ResetPasswordResponse struct {
 	ExpiresAt    int64  `json:"expires_at"`
 }
 
+type RevokeAPIKeyReq struct {
+	Id string `json:"id"`
+}
+
+type Route struct {
+	Mode            int    `json:"mode"`
+	NodeID          string `json:"node_id,optional"`
+	IntervalMinutes int    `json:"interval_minutes,optional"`
+	UtcMinuteOfDay  int    `json:"utc_minute_of_day,optional"`
+}
+
 type SendEmailCodeRequest struct {
 	Email     string `json:"email"`
 	Purpose   int64  `json:"purpose"`
@@ -179,9 +494,14 @@ type SubUser struct {
 	CreateTime        int64  `json:"create_time"`
 	DeprecatedTime    int64  `json:"deprecated_time"`
 	Status            string `json:"status"`
+	StatusReason      string `json:"status_reason"`
 	StartTime         int64
 	EndTime           int64
 	AreaName          string `json:"area_name"`
+	PeriodType        string `json:"period_type"`
+	PeriodDays        int64  `json:"period_days"`
+	RenewMode         string `json:"renew_mode"`
+	Route             *Route `json:"route"`
 }
 
 type SubUserCount struct {
@@ -190,6 +510,23 @@ type SubUserCount struct {
 	Deprecated int `json:"deprecated"`
 }
 
+type SubUserDetail struct {
+	SubUser             *SubUser `json:"sub_user"`
+	NodeIP              string   `json:"node_ip"`
+	NodeOnline          bool     `json:"node_online"`
+	Off                 bool     `json:"off"`
+	LastRouteSwitchTime int64    `json:"last_route_switch_time"`
+	CurrentBandwidth    int64    `json:"current_bandwidth"`
+	TopBandwidth        int64    `json:"top_bandwidth"`
+	CurrentConns        int      `json:"current_conns"`
+}
+
+type SubUserFilter struct {
+	PopId  string `json:"pop_id,optional"`
+	Status string `json:"status,optional"` // active or stop
+	Prefix string `json:"prefix,optional"` // prefix of the username given at creation
+}
+
 type SubUserUsage struct {
 	Username          string `json:"user_name"`           // 子帐号名称
 	MaxBandwidth      int64  `json:"max_bandwidth"`       // 带宽上限
@@ -199,6 +536,37 @@ type SubUserUsage struct {
 	Status            string `json:"status"`              // 用户状态，停止或者活跃
 }
 
+type SwitchNodeReq struct {
+	Username string `json:"username"`
+	NodeId   string `json:"node_id,optional"`
+}
+
+type SwitchNodeResponse struct {
+	NodeIP              string `json:"node_ip"`
+	LastRouteSwitchTime int64  `json:"last_route_switch_time"`
+}
+
+type Team struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	OwnerId    string `json:"owner_id"`
+	CreateTime int64  `json:"create_time"`
+}
+
+type TeamInvite struct {
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	CreateTime int64  `json:"create_time"`
+	ExpireTime int64  `json:"expire_time"`
+}
+
+type TeamMember struct {
+	UserId   string `json:"user_id"`
+	Email    string `json:"email"`
+	Role     string `json:"role"` // owner, member or viewer
+	JoinTime int64  `json:"join_time"`
+}
+
 type TrafficLimit struct {
 	StartTime    int64 `json:"start_time"`
 	EndTime      int64 `json:"end_time"`
@@ -210,6 +578,11 @@ type UpdateSubUserStatusReq struct {
 	Status   string `json:"status"`
 }
 
+type UpdateTeamMemberReq struct {
+	UserId string `json:"user_id"`
+	Role   string `json:"role"` // member or viewer
+}
+
 type UserExistsReq struct {
 	Email string `json:"email"`
 }
@@ -232,3 +605,23 @@ type UserRegisterResp struct {
 	Role         string `json:"role"`
 	ExpiresAt    int64  `json:"expires_at"`
 }
+
+type Webhook struct {
+	Id         string   `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	Events     []string `json:"events"`
+	CreateTime int64    `json:"create_time"`
+}
+
+type WebhookDelivery struct {
+	Id           string `json:"id"`
+	EventType    string `json:"event_type"`
+	Payload      string `json:"payload"`
+	Status       string `json:"status"`
+	Attempts     int64  `json:"attempts"`
+	ResponseCode int64  `json:"response_code"`
+	LastError    string `json:"last_error"`
+	CreateTime   int64  `json:"create_time"`
+	NextTime     int64  `json:"next_time"`
+}
@@ -0,0 +1,154 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// renewBillingPeriods start the first billing period of new users,
+// and the next period of users whose period is end
+func (w *Watcher) renewBillingPeriods(ctx context.Context) {
+	users, err := model.GetAllUsers(ctx, w.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all users failed:%v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, user := range users {
+		if user.BillingEnd > now {
+			continue
+		}
+
+		anchor := now
+		start, end := now, model.PeriodEnd(anchor, now, model.PeriodMonth, 0)
+		if user.BillingEnd != 0 {
+			// recorded before the anchor, the begin of current period is the best guess
+			anchor = user.BillingAnchor
+			if anchor == 0 {
+				anchor = user.BillingStart
+			}
+			start, end = model.NextPeriod(anchor, user.BillingEnd, model.PeriodMonth, 0, now)
+		}
+
+		if err := model.ResetBillingPeriod(w.svcCtx.Redis, user.UUID, anchor, start, end); err != nil {
+			logx.Errorf("reset billing period of user %s failed:%v", user.UUID, err)
+		}
+	}
+}
+
+// checkAccounts suspend the users consumed all the purchased traffic,
+// and resume the suspended users have traffic again
+func (w *Watcher) checkAccounts(ctx context.Context) {
+	users, err := model.GetAllUsers(ctx, w.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all users failed:%v", err)
+		return
+	}
+
+	for _, user := range users {
+		exhausted := user.TotalTrafficLimit > 0 && user.TrafficConsumed >= user.TotalTrafficLimit
+
+		var err error
+		switch {
+		case exhausted:
+			// stop the sub users started after suspended too
+			err = w.suspend(ctx, user)
+		case user.Suspended && !user.Frozen:
+			// the frozen user resume after unfrozen
+			err = w.resume(ctx, user)
+		}
+		if err != nil {
+			logx.Errorf("check account of user %s failed:%v", user.UUID, err)
+		}
+	}
+}
+
+func (w *Watcher) suspend(ctx context.Context, user *model.User) error {
+	subUsers, err := model.GetSubUsers(ctx, w.svcCtx.Redis, user.UUID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, subUser := range subUsers {
+		if subUser.Status != constant.SubUserStatusActive {
+			continue
+		}
+
+		err := w.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "stop"})
+		if err != nil {
+			return err
+		}
+
+		if err := model.SetSubUserStatus(w.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonAccountExhausted); err != nil {
+			return err
+		}
+		audit.RecordStatus(ctx, w.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonAccountExhausted)
+	}
+
+	if user.Suspended {
+		return nil
+	}
+
+	logx.Infof("user %s consumed %d exhaust traffic %d, suspend it", user.UUID, user.TrafficConsumed, user.TotalTrafficLimit)
+	if err := model.SetUserSuspended(w.svcCtx.Redis, user.UUID, true); err != nil {
+		return err
+	}
+	audit.RecordSuspended(ctx, w.svcCtx, user, true)
+
+	w.svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:   event.TypeAccountSuspended,
+		UserID: user.UUID,
+		Used:   user.TrafficConsumed,
+		Limit:  user.TotalTrafficLimit,
+		Reason: constant.StatusReasonAccountExhausted,
+	})
+	return nil
+}
+
+// resume only restart the sub users stopped by suspension
+func (w *Watcher) resume(ctx context.Context, user *model.User) error {
+	subUsers, err := model.GetSubUsers(ctx, w.svcCtx.Redis, user.UUID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, subUser := range subUsers {
+		if subUser.Status != constant.SubUserStatusStop || subUser.StatusReason != constant.StatusReasonAccountExhausted {
+			continue
+		}
+
+		err := w.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "start"})
+		if err != nil {
+			return err
+		}
+
+		if err := model.SetSubUserStatus(w.svcCtx.Redis, subUser.Username, constant.SubUserStatusActive, ""); err != nil {
+			return err
+		}
+		audit.RecordStatus(ctx, w.svcCtx, subUser, constant.SubUserStatusActive, "")
+	}
+
+	logx.Infof("user %s has traffic again, resume it", user.UUID)
+	if err := model.SetUserSuspended(w.svcCtx.Redis, user.UUID, false); err != nil {
+		return err
+	}
+	audit.RecordSuspended(ctx, w.svcCtx, user, false)
+
+	w.svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:   event.TypeAccountResumed,
+		UserID: user.UUID,
+		Used:   user.TrafficConsumed,
+		Limit:  user.TotalTrafficLimit,
+		Reason: constant.StatusReasonAccountResumed,
+	})
+	return nil
+}
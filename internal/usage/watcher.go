@@ -0,0 +1,221 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"titan-ipweb/internal/audit"
+	"titan-ipweb/internal/constant"
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/ippmclient"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	lockKey = "titan:ipweb:lock:usage"
+	workers = 16
+)
+
+var defaultThresholds = []int64{80, 100}
+
+// Watcher poll the traffic used of sub users, notify the thresholds,
+// stop the sub users exhaust their traffic and suspend the accounts exhaust the purchased traffic
+type Watcher struct {
+	svcCtx     *svc.ServiceContext
+	interval   time.Duration
+	thresholds []int64
+	done       chan struct{}
+}
+
+func NewWatcher(svcCtx *svc.ServiceContext) *Watcher {
+	thresholds := append([]int64{}, svcCtx.Config.Usage.Thresholds...)
+	if len(thresholds) == 0 {
+		thresholds = defaultThresholds
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+
+	return &Watcher{
+		svcCtx:     svcCtx,
+		interval:   time.Duration(svcCtx.Config.Usage.Interval) * time.Second,
+		thresholds: thresholds,
+		done:       make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Start() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.watch()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) Stop() {
+	close(w.done)
+}
+
+func (w *Watcher) watch() {
+	lock := redis.NewRedisLock(w.svcCtx.Redis, lockKey)
+	lock.SetExpire(int(w.interval.Seconds()))
+
+	ok, err := lock.Acquire()
+	if err != nil {
+		logx.Errorf("acquire usage lock failed:%v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.keepLock(ctx, cancel, lock)
+		close(stopped)
+	}()
+	// stop extending before the release, or the lock would be taken again
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// start the new billing period before counting the traffic into it
+	w.renewBillingPeriods(ctx)
+
+	subUsers, err := model.GetAllSubUsers(ctx, w.svcCtx.Redis)
+	if err != nil {
+		logx.Errorf("get all sub users failed:%v", err)
+		return
+	}
+
+	checking := make([]*model.SubUser, 0, len(subUsers))
+	usernames := make([]string, 0, len(subUsers))
+	for _, subUser := range subUsers {
+		if subUser.Status == constant.SubUserStatusDeprecated {
+			continue
+		}
+		checking = append(checking, subUser)
+		usernames = append(usernames, subUser.Username)
+	}
+
+	result := w.svcCtx.Stats.BaseStats(ctx, usernames)
+	if ctx.Err() != nil {
+		return
+	}
+
+	mr.ForEach(func(source chan<- *model.SubUser) {
+		for _, subUser := range checking {
+			source <- subUser
+		}
+	}, func(subUser *model.SubUser) {
+		stats, ok := result.Stats[subUser.Username]
+		if !ok {
+			logx.Errorf("check usage of sub user %s failed:%s", subUser.Username, result.Failed[subUser.Username])
+			return
+		}
+		if err := w.check(ctx, subUser, stats); err != nil {
+			logx.Errorf("check usage of sub user %s failed:%v", subUser.Username, err)
+		}
+	}, mr.WithWorkers(workers))
+
+	// the consumed traffic of the accounts is not complete if the lock lost
+	if ctx.Err() != nil {
+		return
+	}
+	w.checkAccounts(ctx)
+}
+
+// keepLock extend the lock before it expire, cancel the sweep if the lock lost
+func (w *Watcher) keepLock(ctx context.Context, cancel context.CancelFunc, lock *redis.RedisLock) {
+	ticker := time.NewTicker(w.interval / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// acquire again by the owner only reset the expire
+			ok, err := lock.Acquire()
+			if err != nil || !ok {
+				logx.Errorf("extend usage lock failed, stop the watch:%v", err)
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) check(ctx context.Context, subUser *model.SubUser, stats *ippmclient.UserBaseStatsResp) error {
+	used := stats.TotalTraffic
+	if _, err := model.RecordSubUserTraffic(ctx, w.svcCtx.Redis, subUser.UserID, subUser.Username, used); err != nil {
+		return err
+	}
+
+	if subUser.Status != constant.SubUserStatusActive || subUser.TotalTrafficLimit <= 0 {
+		return nil
+	}
+
+	percent := used * 100 / subUser.TotalTrafficLimit
+
+	// only notify the highest threshold reached
+	threshold := int64(0)
+	for _, t := range w.thresholds {
+		if percent >= t {
+			threshold = t
+		}
+	}
+
+	if threshold > subUser.NotifiedThreshold {
+		if err := model.SetSubUserNotifiedThreshold(w.svcCtx.Redis, subUser.Username, threshold); err != nil {
+			return err
+		}
+
+		w.svcCtx.EventBus.Publish(ctx, &event.Event{
+			Type:        event.TypeTrafficThreshold,
+			UserID:      subUser.UserID,
+			SubUsername: subUser.Username,
+			Threshold:   threshold,
+			Used:        used,
+			Limit:       subUser.TotalTrafficLimit,
+		})
+	}
+
+	if used < subUser.TotalTrafficLimit {
+		return nil
+	}
+
+	logx.Infof("sub user %s traffic used %d exhaust limit %d, stop it", subUser.Username, used, subUser.TotalTrafficLimit)
+	err := w.svcCtx.IPPMClient.StartOrStopUser(ctx, &ippmclient.StartOrStopUserReq{UserName: subUser.Username, Action: "stop"})
+	if err != nil {
+		return err
+	}
+
+	if err := model.SetSubUserStatus(w.svcCtx.Redis, subUser.Username, constant.SubUserStatusStop, constant.StatusReasonTrafficExhausted); err != nil {
+		return err
+	}
+	audit.RecordStatus(ctx, w.svcCtx, subUser, constant.SubUserStatusStop, constant.StatusReasonTrafficExhausted)
+
+	w.svcCtx.EventBus.Publish(ctx, &event.Event{
+		Type:        event.TypeSubUserStopped,
+		UserID:      subUser.UserID,
+		SubUsername: subUser.Username,
+		Used:        used,
+		Limit:       subUser.TotalTrafficLimit,
+		Reason:      constant.StatusReasonTrafficExhausted,
+	})
+	return nil
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// not tell which address the url resolved to
+	ErrAddressNotAllowed  = errors.New("webhook address is not allowed")
+	ErrRedirectNotAllowed = errors.New("webhook redirect is not allowed")
+)
+
+// the ranges not covered by net.IP methods, such as the carrier-grade NAT and the benchmark network
+var reservedNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"2001:db8::/32",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// isPublicIP return false for the loopback, private, link-local (cloud metadata) and reserved addresses
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, ipNet := range reservedNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl check the address right before connecting, so the dns rebinding can not bypass it
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrAddressNotAllowed
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+// newHTTPClient return the client can only connect to the public addresses and not follow redirects
+func newHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, the proxy address would be checked instead of the webhook
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return ErrRedirectNotAllowed
+		},
+	}
+}
+
+// ValidateURL check the webhook url when created, the address is checked again when connecting
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid webhook url %s", rawURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrAddressNotAllowed
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
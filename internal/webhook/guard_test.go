@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for addr, expect := range cases {
+		if got := isPublicIP(net.ParseIP(addr)); got != expect {
+			t.Errorf("isPublicIP(%s) = %t, expect %t", addr, got, expect)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, u := range []string{"ftp://example.com", "http://", "http://localhost/hook", "http://169.254.169.254/latest", "http://[::1]:8080/"} {
+		if err := ValidateURL(u); err == nil {
+			t.Errorf("expect %s invalid", u)
+		}
+	}
+
+	if err := ValidateURL("https://example.com/hook"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRefusePrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newHTTPClient(time.Second).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, ErrAddressNotAllowed) {
+		t.Fatalf("expect ErrAddressNotAllowed, got %v", err)
+	}
+}
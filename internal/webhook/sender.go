@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/mr"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 100
+	workers      = 16
+	maxBackoff   = 6 * time.Hour
+	// the claimed deliveries not finished in the lease are sent again, such as the process restarted
+	claimLease = 5 * 60
+)
+
+// Sender post the queued deliveries to the webhook url, retry with exponential backoff
+type Sender struct {
+	svcCtx      *svc.ServiceContext
+	client      *http.Client
+	maxAttempts int64
+	retryBase   time.Duration
+	done        chan struct{}
+}
+
+func NewSender(svcCtx *svc.ServiceContext) *Sender {
+	return &Sender{
+		svcCtx:      svcCtx,
+		client:      newHTTPClient(time.Duration(svcCtx.Config.Webhook.Timeout) * time.Millisecond),
+		maxAttempts: svcCtx.Config.Webhook.MaxAttempts,
+		retryBase:   time.Duration(svcCtx.Config.Webhook.RetryBase) * time.Second,
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *Sender) Start() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sendDue()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Sender) Stop() {
+	close(s.done)
+}
+
+func (s *Sender) sendDue() {
+	ctx := context.Background()
+	deliveries, err := model.ClaimDueDeliveries(ctx, s.svcCtx.Redis, batchSize, claimLease)
+	if err != nil {
+		logx.Errorf("claim webhook deliveries failed:%v", err)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	mr.ForEach(func(source chan<- *model.WebhookDelivery) {
+		for _, delivery := range deliveries {
+			source <- delivery
+		}
+	}, func(delivery *model.WebhookDelivery) {
+		s.deliver(ctx, delivery)
+	}, mr.WithWorkers(workers))
+}
+
+func (s *Sender) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	webhook, err := model.GetWebhook(s.svcCtx.Redis, delivery.WebhookID)
+	if err != nil {
+		// try again later
+		logx.Errorf("get webhook %s failed:%v", delivery.WebhookID, err)
+		s.retry(delivery)
+		return
+	}
+
+	if webhook == nil {
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = "webhook removed"
+		s.finish(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	code, err := s.post(ctx, webhook, delivery)
+	delivery.ResponseCode = int64(code)
+	if err == nil {
+		delivery.Status = model.DeliverySuccess
+		delivery.LastError = ""
+		s.finish(delivery)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.maxAttempts {
+		logx.Errorf("webhook delivery %s to %s failed after %d attempts:%v", delivery.ID, webhook.URL, delivery.Attempts, err)
+		delivery.Status = model.DeliveryFailed
+		s.finish(delivery)
+		return
+	}
+
+	s.retry(delivery)
+}
+
+func (s *Sender) post(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *Sender) retry(delivery *model.WebhookDelivery) {
+	shift := delivery.Attempts - 1
+	if shift < 0 {
+		shift = 0
+	}
+
+	backoff := s.retryBase << shift
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	delivery.NextTime = time.Now().Add(backoff).Unix()
+	s.save(delivery)
+
+	if err := model.ScheduleDelivery(s.svcCtx.Redis, delivery.ID, delivery.NextTime); err != nil {
+		logx.Errorf("schedule webhook delivery %s failed:%v", delivery.ID, err)
+	}
+}
+
+func (s *Sender) finish(delivery *model.WebhookDelivery) {
+	if err := model.FinishDelivery(s.svcCtx.Redis, delivery); err != nil {
+		logx.Errorf("finish webhook delivery %s failed:%v", delivery.ID, err)
+	}
+}
+
+func (s *Sender) save(delivery *model.WebhookDelivery) {
+	if err := model.SaveDelivery(s.svcCtx.Redis, delivery); err != nil {
+		logx.Errorf("save webhook delivery %s failed:%v", delivery.ID, err)
+	}
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"titan-ipweb/internal/event"
+	"titan-ipweb/internal/svc"
+	"titan-ipweb/model"
+
+	"github.com/google/uuid"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	HeaderEvent     = "X-Ipweb-Event"
+	HeaderDelivery  = "X-Ipweb-Delivery"
+	HeaderTimestamp = "X-Ipweb-Timestamp"
+	// sha256=hex(hmac_sha256(secret, timestamp + "." + body))
+	HeaderSignature = "X-Ipweb-Signature"
+)
+
+// Sign return the signature of the body, the receiver should compute it with
+// the webhook secret and compare with the X-Ipweb-Signature header
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribe queue a delivery for each webhook of the user subscribed the event
+func Subscribe(svcCtx *svc.ServiceContext) {
+	svcCtx.EventBus.Subscribe(func(ctx context.Context, e *event.Event) {
+		if err := enqueue(ctx, svcCtx, e); err != nil {
+			logx.Errorf("enqueue webhook of event %s for user %s failed:%v", e.Type, e.UserID, err)
+		}
+	})
+}
+
+func enqueue(ctx context.Context, svcCtx *svc.ServiceContext, e *event.Event) error {
+	if e.UserID == "" {
+		return nil
+	}
+
+	webhooks, err := model.GetUserWebhooks(ctx, svcCtx.Redis, e.UserID)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(e.Type) {
+			continue
+		}
+
+		delivery := &model.WebhookDelivery{
+			ID:         uuid.NewString(),
+			WebhookID:  webhook.ID,
+			EventType:  e.Type,
+			Payload:    string(payload),
+			Status:     model.DeliveryPending,
+			CreateTime: e.Time,
+			NextTime:   e.Time,
+		}
+		if err := model.EnqueueDelivery(svcCtx.Redis, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package ippmclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Error is returned when the IPPM server answers with a non 200 status code
+// or reports a failed user operation
+type Error struct {
+	StatusCode int
+	Path       string
+	Msg        string
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("ippm %s: http status code %d, error msg %s", e.Path, e.StatusCode, e.Msg)
+	}
+	return fmt.Sprintf("ippm %s: %s", e.Path, e.Msg)
+}
+
+// IsStatus reports whether err is an IPPM error with the given http status code
+func IsStatus(err error, statusCode int) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode == statusCode
+	}
+	return false
+}
+
+// Client talks to the IPPM server, one method per endpoint of ippmserver.api
+type Client struct {
+	baseURL     string
+	accessToken string
+	httpClient  *http.Client
+}
+
+func NewClient(baseURL, accessToken string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		accessToken: accessToken,
+		httpClient:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) GetNodePop(ctx context.Context, req *GetNodePopReq) (*GetNodePopResp, error) {
+	query := url.Values{}
+	query.Set("nodeid", req.NodeId)
+
+	resp := &GetNodePopResp{}
+	if err := c.get(ctx, "/node/pop", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetAuthToken(ctx context.Context) (*GetAuthTokenResp, error) {
+	resp := &GetAuthTokenResp{}
+	if err := c.get(ctx, "/auth/token", nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetPops(ctx context.Context) (*GetPopsResp, error) {
+	resp := &GetPopsResp{}
+	if err := c.get(ctx, "/pops", nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ListNode(ctx context.Context, req *ListNodeReq) (*ListNodeResp, error) {
+	query := url.Values{}
+	query.Set("popid", req.PopID)
+	query.Set("type", strconv.Itoa(req.Type))
+	query.Set("start", strconv.Itoa(req.Start))
+	query.Set("end", strconv.Itoa(req.End))
+
+	resp := &ListNodeResp{}
+	if err := c.get(ctx, "/node/list", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) CreateUser(ctx context.Context, req *CreateUserReq) (*CreateUserResp, error) {
+	resp := &CreateUserResp{}
+	if err := c.post(ctx, "/user/create", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ListUser(ctx context.Context, req *ListUserReq) (*ListUserResp, error) {
+	query := url.Values{}
+	query.Set("popid", req.PopID)
+	query.Set("start", strconv.Itoa(req.Start))
+	query.Set("end", strconv.Itoa(req.End))
+
+	resp := &ListUserResp{}
+	if err := c.get(ctx, "/user/list", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ModifyUserPassword(ctx context.Context, req *ModifyUserPasswordReq) error {
+	return c.operation(ctx, "/user/password/modify", req)
+}
+
+func (c *Client) ModifyUser(ctx context.Context, req *ModifyUserReq) error {
+	return c.operation(ctx, "/user/modify", req)
+}
+
+func (c *Client) GetUser(ctx context.Context, req *GetUserReq) (*GetUserResp, error) {
+	query := url.Values{}
+	query.Set("username", req.UserName)
+
+	resp := &GetUserResp{}
+	if err := c.get(ctx, "/user/get", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, req *DeleteUserReq) error {
+	return c.operation(ctx, "/user/delete", req)
+}
+
+func (c *Client) SwitchUserRouteNode(ctx context.Context, req *SwitchUserRouteNodeReq) error {
+	return c.operation(ctx, "/user/routenode/switch", req)
+}
+
+func (c *Client) StartOrStopUser(ctx context.Context, req *StartOrStopUserReq) error {
+	return c.operation(ctx, "/user/startorstop", req)
+}
+
+func (c *Client) AddBlackList(ctx context.Context, req *AddBlackListReq) error {
+	return c.operation(ctx, "/node/blacklist/add", req)
+}
+
+func (c *Client) RemoveBlackList(ctx context.Context, req *RemoveBlackListReq) error {
+	return c.operation(ctx, "/node/blacklist/remove", req)
+}
+
+func (c *Client) GetBlackList(ctx context.Context, req *GetBlackListReq) (*GetBlackListResp, error) {
+	query := url.Values{}
+	query.Set("popid", req.PodID)
+
+	resp := &GetBlackListResp{}
+	if err := c.get(ctx, "/node/blacklist/get", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) KickNode(ctx context.Context, req *KickNodeReq) error {
+	path := "/node/kick?" + url.Values{"nodeid": []string{req.NodeID}}.Encode()
+	return c.operation(ctx, path, nil)
+}
+
+func (c *Client) GetUserBaseStats(ctx context.Context, req *UserBaseStatsReq) (*UserBaseStatsResp, error) {
+	query := url.Values{}
+	query.Set("username", req.Username)
+
+	resp := &UserBaseStatsResp{}
+	if err := c.get(ctx, "/user/stats/base", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetUsersBaseStats get the base stats of many users in one request
+func (c *Client) GetUsersBaseStats(ctx context.Context, req *UsersBaseStatsReq) (*UsersBaseStatsResp, error) {
+	resp := &UsersBaseStatsResp{}
+	if err := c.post(ctx, "/user/stats/base/batch", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetUserStatsChart(ctx context.Context, req *UserStatsChartReq) (*UserStatsChartResp, error) {
+	query := url.Values{}
+	query.Set("type", req.Type)
+	query.Set("username", req.Username)
+	query.Set("start_time", strconv.FormatInt(req.StartTime, 10))
+	query.Set("end_time", strconv.FormatInt(req.EndTime, 10))
+
+	resp := &UserStatsChartResp{}
+	if err := c.get(ctx, "/user/stats/chart", query, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// operation post a request whose response is UserOperationResp,
+// and convert the unsuccess result to Error
+func (c *Client) operation(ctx context.Context, path string, req interface{}) error {
+	resp := &UserOperationResp{}
+	if err := c.post(ctx, path, req, resp); err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return &Error{StatusCode: http.StatusOK, Path: path, Msg: resp.ErrMsg}
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, resp interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(httpReq, path, resp)
+}
+
+func (c *Client) post(ctx context.Context, path string, req interface{}, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		buf, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("marshal error %v", err)
+		}
+		body = bytes.NewBuffer(buf)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return c.do(httpReq, path, resp)
+}
+
+func (c *Client) do(httpReq *http.Request, path string, resp interface{}) error {
+	httpReq.Header.Set("Authorization", "Bearer "+c.accessToken)
+	httpReq.Header.Set("Accept", "application/json")
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("ippm %s: %w", path, err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return &Error{StatusCode: httpResp.StatusCode, Path: path, Msg: string(data)}
+	}
+
+	if resp == nil || len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("ippm %s: unmarshal error %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package ippmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(&GetUserResp{User: User{UserName: r.URL.Query().Get("username")}, PopId: "pop1"})
+	})
+	mux.HandleFunc("/user/delete", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&UserOperationResp{Success: false, ErrMsg: "user not exist"})
+	})
+	mux.HandleFunc("/user/modify", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	mux.HandleFunc("/user/stats/base/batch", func(w http.ResponseWriter, r *http.Request) {
+		req := &UsersBaseStatsReq{}
+		json.NewDecoder(r.Body).Decode(req)
+
+		resp := &UsersBaseStatsResp{Stats: map[string]*UserBaseStatsResp{}, Errors: map[string]string{}}
+		for _, username := range req.Usernames {
+			if username == "bad" {
+				resp.Errors[username] = "user not exist"
+				continue
+			}
+			resp.Stats[username] = &UserBaseStatsResp{TotalTraffic: 100}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, "token", time.Second)
+	ctx := context.Background()
+
+	user, err := client.GetUser(ctx, &GetUserReq{UserName: "abc"})
+	if err != nil {
+		t.Fatalf("GetUser failed:%v", err)
+	}
+	if user.UserName != "abc" || user.PopId != "pop1" {
+		t.Fatalf("unexpect user %#v", user)
+	}
+
+	err = client.DeleteUser(ctx, &DeleteUserReq{UserName: "abc"})
+	if err == nil || !IsStatus(err, http.StatusOK) {
+		t.Fatalf("expect operation error, got %v", err)
+	}
+
+	err = client.ModifyUser(ctx, &ModifyUserReq{UserName: "abc"})
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("expect status 400, got %v", err)
+	}
+
+	stats, err := client.GetUsersBaseStats(ctx, &UsersBaseStatsReq{Usernames: []string{"abc", "bad"}})
+	if err != nil {
+		t.Fatalf("GetUsersBaseStats failed:%v", err)
+	}
+	if stats.Stats["abc"].TotalTraffic != 100 || stats.Errors["bad"] == "" {
+		t.Fatalf("unexpect stats %#v", stats)
+	}
+}
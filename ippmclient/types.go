@@ -30,6 +30,7 @@ type CreateUserReq struct {
 	Route             *Route        `json:"route,optional"`
 	UploadRateLimit   int64         `json:"upload_rate_limit,default=655360"`
 	DownloadRateLimit int64         `json:"download_rate_limit,default=1310720"`
+	MaxBandwidthLimit int64         `json:"max_bandwidth_limit,optional"`
 }
 
 type CreateUserResp struct {
@@ -111,9 +112,12 @@ type ModifyUserPasswordReq struct {
 }
 
 type ModifyUserReq struct {
-	UserName     string        `json:"user_name"`
-	TrafficLimit *TrafficLimit `json:"traffic_limit,optional"`
-	Route        *Route        `json:"route,optional"`
+	UserName          string        `json:"user_name"`
+	TrafficLimit      *TrafficLimit `json:"traffic_limit,optional"`
+	Route             *Route        `json:"route,optional"`
+	UploadRateLimit   *int64        `json:"upload_rate_limit,optional"`
+	DownloadRateLimit *int64        `json:"download_rate_limit,optional"`
+	MaxBandwidthLimit *int64        `json:"max_bandwidth_limit,optional"`
 }
 
 type Node struct {
@@ -153,7 +157,7 @@ type StartOrStopUserReq struct {
 type StatPoint struct {
 	Timestamp int64 `json:"timestamp"`
 	Bandwidth int64 `json:"bandwidth"`
-	Traffic   int64 `json:"traffic'`
+	Traffic   int64 `json:"traffic"`
 }
 
 type StatsResp struct {
@@ -162,7 +166,7 @@ type StatsResp struct {
 
 type SwitchUserRouteNodeReq struct {
 	UserName string `json:"user_name"`
-	NodeId   string `json:"node_id, optional"`
+	NodeId   string `json:"node_id,optional"`
 }
 
 type TrafficLimit struct {
@@ -195,6 +199,16 @@ type UserBaseStatsResp struct {
 	CurrentConns     int   `json:"current_conns"`
 }
 
+type UsersBaseStatsReq struct {
+	Usernames []string `json:"usernames"`
+}
+
+type UsersBaseStatsResp struct {
+	Stats map[string]*UserBaseStatsResp `json:"stats"`
+	// the users failed on the server, username to error message
+	Errors map[string]string `json:"errors"`
+}
+
 type UserOperationResp struct {
 	Success bool   `json:"success"`
 	ErrMsg  string `json:"err_msg"`
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	// the api key is ipk_<id>_<secret>
+	APIKeyPrefix = "ipk_"
+
+	// only update the last used time once a minute
+	apiKeyTouchInterval = 60
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+type APIKey struct {
+	ID string `redis:"id"`
+	// uuid of the owner, the email and role are looked up on every request
+	UserID string `redis:"user_id"`
+	Name   string `redis:"name"`
+	// sha256 hex of the whole key, the key itself never stored
+	Hash string `redis:"hash"`
+	// comma separated scopes, empty means all
+	Scopes string `redis:"scopes"`
+	// 0 means never expire
+	ExpireTime   int64 `redis:"expire_time"`
+	CreateTime   int64 `redis:"create_time"`
+	LastUsedTime int64 `redis:"last_used_time"`
+}
+
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+func (k *APIKey) Expired(now int64) bool {
+	return k.ExpireTime != 0 && k.ExpireTime <= now
+}
+
+func apiKeyKey(id string) string {
+	return fmt.Sprintf(redisKeyAPIKeyTable, id)
+}
+
+func userAPIKeyListKey(uuid string) string {
+	return fmt.Sprintf(redisKeyUserAPIKeyZset, uuid)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey generate the key and fill the id and hash of apiKey, the key only return here
+func NewAPIKey(apiKey *APIKey) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	apiKey.ID = hex.EncodeToString(id)
+	key := APIKeyPrefix + apiKey.ID + "_" + hex.EncodeToString(secret)
+	apiKey.Hash = hashAPIKey(key)
+	return key, nil
+}
+
+func AddAPIKey(rdb *redis.Redis, apiKey *APIKey) error {
+	if apiKey.ID == "" || apiKey.UserID == "" {
+		return fmt.Errorf("empty api key id or user id")
+	}
+
+	m, err := structToMap(apiKey)
+	if err != nil {
+		return err
+	}
+
+	if err := rdb.Hmset(apiKeyKey(apiKey.ID), m); err != nil {
+		return err
+	}
+
+	_, err = rdb.Zadd(userAPIKeyListKey(apiKey.UserID), apiKey.CreateTime, apiKey.ID)
+	return err
+}
+
+func GetAPIKey(rdb *redis.Redis, id string) (*APIKey, error) {
+	data, err := rdb.Hgetall(apiKeyKey(id))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	apiKey := &APIKey{}
+	if err := mapToStruct(data, apiKey); err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+// VerifyAPIKey return the api key record of the key, ErrInvalidAPIKey if not exist, revoked or expired
+func VerifyAPIKey(ctx context.Context, rdb *redis.Redis, key string) (*APIKey, error) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok || id == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := GetAPIKey(rdb, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey == nil || subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashAPIKey(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now().Unix()
+	if apiKey.Expired(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if now-apiKey.LastUsedTime >= apiKeyTouchInterval {
+		// the key may be revoked just now, do not create the hash again
+		if _, err := rdb.EvalCtx(ctx, touchAPIKeyScript, []string{apiKeyKey(id)}, now); err != nil {
+			logx.Errorf("update last used time of api key %s failed:%v", id, err)
+		}
+	}
+	return apiKey, nil
+}
+
+const touchAPIKeyScript = `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "last_used_time", ARGV[1])
+end
+return 0
+`
+
+func GetUserAPIKeys(ctx context.Context, rdb *redis.Redis, uuid string) ([]*APIKey, error) {
+	ids, err := rdb.ZrangeCtx(ctx, userAPIKeyListKey(uuid), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := getHashes(ctx, rdb, ids, apiKeyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := make([]*APIKey, 0, len(tables))
+	for _, table := range tables {
+		apiKey := &APIKey{}
+		if err := mapToStruct(table, apiKey); err != nil {
+			logx.Errorf("GetUserAPIKeys mapToStruct error:%s", err.Error())
+			continue
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, nil
+}
+
+func APIKeyCount(rdb *redis.Redis, uuid string) (int, error) {
+	return rdb.Zcard(userAPIKeyListKey(uuid))
+}
+
+// RemoveAPIKey revoke the api key, it can not be used any more
+func RemoveAPIKey(rdb *redis.Redis, uuid, id string) error {
+	if _, err := rdb.Del(apiKeyKey(id)); err != nil {
+		return err
+	}
+
+	_, err := rdb.Zrem(userAPIKeyListKey(uuid), id)
+	return err
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyAPIKey(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	apiKey := &APIKey{UserID: "u1", Name: "ci", Scopes: "read", CreateTime: time.Now().Unix()}
+	key, err := NewAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAPIKey(rdb, apiKey); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := VerifyAPIKey(ctx, rdb, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != "u1" || len(got.ScopeList()) != 1 {
+		t.Fatalf("unexpected api key %#v", got)
+	}
+
+	if got, _ = GetAPIKey(rdb, apiKey.ID); got.LastUsedTime == 0 {
+		t.Fatal("last used time not updated")
+	}
+
+	// wrong secret with the right id
+	if _, err := VerifyAPIKey(ctx, rdb, APIKeyPrefix+apiKey.ID+"_00"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expect invalid api key, got %v", err)
+	}
+
+	if err := RemoveAPIKey(rdb, "u1", apiKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAPIKey(ctx, rdb, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expect revoked api key invalid, got %v", err)
+	}
+}
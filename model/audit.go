@@ -0,0 +1,292 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// the fields never write to the audit log
+var auditRedactFields = map[string]struct{}{
+	"password": {},
+}
+
+const auditRedacted = "******"
+
+type AuditEntry struct {
+	// id of the stream entry, the milliseconds of the time as prefix
+	ID          string `redis:"-"`
+	Time        int64  `redis:"time"`
+	UserID      string `redis:"user_id"`
+	ActorID     string `redis:"actor_id"`
+	ActorEmail  string `redis:"actor_email"`
+	ClientIP    string `redis:"client_ip"`
+	Action      string `redis:"action"`
+	SubUsername string `redis:"sub_username"`
+	// json of the changed fields, see AuditChange
+	Diff string `redis:"diff"`
+	// empty if IPPM not called
+	IPPMResult string `redis:"ippm_result"`
+}
+
+type AuditChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type AuditFilter struct {
+	SubUsername string
+	Action      string
+	// unix second, 0 means no limit
+	StartTime int64
+	EndTime   int64
+}
+
+func (f *AuditFilter) match(entry *AuditEntry) bool {
+	if f.SubUsername != "" && f.SubUsername != entry.SubUsername {
+		return false
+	}
+	if f.Action != "" && f.Action != entry.Action {
+		return false
+	}
+	return true
+}
+
+func auditStreamKey(uuid string) string {
+	return fmt.Sprintf(redisKeyAuditStream, uuid)
+}
+
+// AuditDiff return the changed fields between before and after, nil means the record not exist.
+// before and after must be the same struct type
+func AuditDiff(before, after interface{}) (map[string]AuditChange, error) {
+	beforeMap, err := auditFields(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	afterMap, err := auditFields(after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]AuditChange)
+	for k, v := range afterMap {
+		if beforeMap[k] == v {
+			continue
+		}
+
+		change := AuditChange{Before: beforeMap[k], After: v}
+		if _, ok := auditRedactFields[k]; ok {
+			change = AuditChange{Before: auditRedacted, After: auditRedacted}
+		}
+		diff[k] = change
+	}
+	return diff, nil
+}
+
+// auditFields use the zero value of the other type if in is nil
+func auditFields(in, other interface{}) (map[string]string, error) {
+	v := reflect.ValueOf(in)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		o := reflect.ValueOf(other)
+		if !o.IsValid() || (o.Kind() == reflect.Ptr && o.IsNil()) {
+			return map[string]string{}, nil
+		}
+
+		t := o.Type()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		in = reflect.New(t).Interface()
+	}
+	return structToMap(in)
+}
+
+// AddAuditEntry append the entry to the stream of the account,
+// entries older than retention seconds or exceed maxLen are trimmed
+func AddAuditEntry(ctx context.Context, rdb *redis.Redis, entry *AuditEntry, retention, maxLen int64) (string, error) {
+	if entry.UserID == "" {
+		return "", fmt.Errorf("empty uuid")
+	}
+
+	m, err := structToMap(entry)
+	if err != nil {
+		return "", err
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return "", err
+	}
+
+	key := auditStreamKey(entry.UserID)
+	minID := strconv.FormatInt((time.Now().Unix()-retention)*1000, 10)
+	add := pipe.XAdd(ctx, &goredis.XAddArgs{
+		Stream: key,
+		MinID:  minID,
+		Approx: true,
+		Values: m,
+	})
+	pipe.XTrimMaxLenApprox(ctx, key, maxLen, 0)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return add.Val(), nil
+}
+
+// GetAuditEntries return at most limit entries match the filter from newest to oldest,
+// cursor is the id of the last entry returned by previous page, empty for the first page.
+// next cursor is empty if no more entries
+func GetAuditEntries(ctx context.Context, rdb *redis.Redis, uuid string, filter AuditFilter, cursor string, limit int) ([]*AuditEntry, string, error) {
+	if uuid == "" {
+		return nil, "", fmt.Errorf("empty uuid")
+	}
+
+	start, end := "-", "+"
+	if filter.StartTime > 0 {
+		start = strconv.FormatInt(filter.StartTime*1000, 10)
+	}
+	if filter.EndTime > 0 {
+		end = strconv.FormatInt(filter.EndTime*1000+999, 10)
+	}
+	if cursor != "" {
+		prev, err := prevStreamID(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		// the cursor may be older than the end time
+		if end == "+" || compareStreamID(prev, end) < 0 {
+			end = prev
+		}
+	}
+
+	key := auditStreamKey(uuid)
+	// scan at most 10 pages to avoid the filter scan the whole stream
+	batch := int64(limit * 2)
+	entries := make([]*AuditEntry, 0, limit)
+	var last string
+	for i := 0; i < 10; i++ {
+		pipe, err := rdb.TxPipeline()
+		if err != nil {
+			return nil, "", err
+		}
+
+		cmd := pipe.XRevRangeN(ctx, key, end, start, batch)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, "", err
+		}
+
+		msgs := cmd.Val()
+		for _, msg := range msgs {
+			entry, err := toAuditEntry(msg)
+			if err != nil {
+				return nil, "", err
+			}
+
+			if filter.match(entry) {
+				entries = append(entries, entry)
+				if len(entries) == limit {
+					return entries, entry.ID, nil
+				}
+			}
+			last = msg.ID
+		}
+
+		if int64(len(msgs)) < batch {
+			return entries, "", nil
+		}
+
+		if end, err = prevStreamID(last); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// more entries may match, continue from the last scanned
+	return entries, last, nil
+}
+
+func toAuditEntry(msg goredis.XMessage) (*AuditEntry, error) {
+	data := make(map[string]string, len(msg.Values))
+	for k, v := range msg.Values {
+		data[k] = fmt.Sprintf("%v", v)
+	}
+
+	entry := &AuditEntry{}
+	if err := mapToStruct(data, entry); err != nil {
+		return nil, err
+	}
+	entry.ID = msg.ID
+	return entry, nil
+}
+
+// prevStreamID return the id just before id, stream id is ms-seq
+func prevStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+
+	if seq > 0 {
+		return fmt.Sprintf("%d-%d", ms, seq-1), nil
+	}
+	if ms == 0 {
+		return "", fmt.Errorf("invalid cursor %s", id)
+	}
+	return fmt.Sprintf("%d-%d", ms-1, uint64(1<<64-1)), nil
+}
+
+func compareStreamID(a, b string) int {
+	ams, aseq, _ := parseStreamID(a)
+	bms, bseq, _ := parseStreamID(b)
+	switch {
+	case ams != bms:
+		if ams < bms {
+			return -1
+		}
+		return 1
+	case aseq < bseq:
+		return -1
+	case aseq > bseq:
+		return 1
+	}
+	return 0
+}
+
+// parseStreamID accept ms-seq or ms, seq of ms is the max
+func parseStreamID(id string) (uint64, uint64, error) {
+	msStr, seqStr, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor %s", id)
+	}
+	if !found {
+		return ms, 1<<64 - 1, nil
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor %s", id)
+	}
+	return ms, seq, nil
+}
+
+// MarshalAuditDiff return the json of the diff
+func MarshalAuditDiff(diff map[string]AuditChange) string {
+	if len(diff) == 0 {
+		return ""
+	}
+
+	b, err := json.Marshal(diff)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := &SubUser{Username: "sub1", Status: "active", Password: "old"}
+	after := *before
+	after.Status = "stop"
+	after.Password = "new"
+
+	diff, err := AuditDiff(before, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 2 || diff["status"] != (AuditChange{Before: "active", After: "stop"}) {
+		t.Fatalf("unexpected diff %#v", diff)
+	}
+	if diff["password"].After != auditRedacted {
+		t.Fatalf("password not redacted %#v", diff["password"])
+	}
+
+	// created
+	diff, err = AuditDiff((*SubUser)(nil), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff["username"] != (AuditChange{After: "sub1"}) {
+		t.Fatalf("unexpected diff %#v", diff)
+	}
+}
+
+func TestGetAuditEntries(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		entry := &AuditEntry{
+			UserID:      "u1",
+			Action:      "edit_limit",
+			SubUsername: fmt.Sprintf("sub%d", i%2),
+		}
+		if _, err := AddAuditEntry(ctx, rdb, entry, 3600, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cursor string
+	var total int
+	for page := 0; ; page++ {
+		entries, next, err := GetAuditEntries(ctx, rdb, "u1", AuditFilter{SubUsername: "sub1"}, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.SubUsername != "sub1" {
+				t.Fatalf("unexpected entry %#v", entry)
+			}
+		}
+		total += len(entries)
+		if next == "" {
+			break
+		}
+		if page > 5 {
+			t.Fatal("too many pages")
+		}
+		cursor = next
+	}
+
+	if total != 5 {
+		t.Fatalf("expect 5 entries, got %d", total)
+	}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func baseStatsCacheKey(username string) string {
+	return fmt.Sprintf(redisKeyBaseStatsCache, username)
+}
+
+// GetBaseStatsCache return the cached base stats of the sub users, username to the encoded stats,
+// the expired or not cached ones are missing
+func GetBaseStatsCache(ctx context.Context, rdb *redis.Redis, usernames []string) (map[string]string, error) {
+	if len(usernames) == 0 {
+		return map[string]string{}, nil
+	}
+
+	keys := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		keys = append(keys, baseStatsCacheKey(username))
+	}
+
+	values, err := rdb.MgetCtx(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make(map[string]string, len(values))
+	for i, value := range values {
+		if value != "" {
+			cached[usernames[i]] = value
+		}
+	}
+	return cached, nil
+}
+
+// SetBaseStatsCache cache the encoded base stats of the sub users for ttl seconds
+func SetBaseStatsCache(ctx context.Context, rdb *redis.Redis, stats map[string]string, ttl int64) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return err
+	}
+
+	for username, value := range stats {
+		pipe.Set(ctx, baseStatsCacheKey(username), value, time.Duration(ttl)*time.Second)
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// keyring encrypt the sub user password with the current key,
+// the old keys are kept to decrypt the records before rotation
+type keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+var (
+	passwordKeyringMu sync.RWMutex
+	passwordKeyring   *keyring
+)
+
+// SetPasswordKeys set the keys to encrypt sub user password, the key is base64 of 32 bytes.
+// if current is empty, the password will be stored in plaintext
+func SetPasswordKeys(current string, keys map[string]string) error {
+	if current == "" {
+		passwordKeyringMu.Lock()
+		passwordKeyring = nil
+		passwordKeyringMu.Unlock()
+		return nil
+	}
+
+	if _, ok := keys[current]; !ok {
+		return fmt.Errorf("password key %s not exist", current)
+	}
+
+	kr := &keyring{current: current, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("decode password key %s failed:%w", id, err)
+		}
+
+		if len(raw) != 32 {
+			return fmt.Errorf("password key %s must be 32 bytes", id)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		kr.aeads[id] = aead
+	}
+
+	passwordKeyringMu.Lock()
+	passwordKeyring = kr
+	passwordKeyringMu.Unlock()
+	return nil
+}
+
+func getPasswordKeyring() *keyring {
+	passwordKeyringMu.RLock()
+	defer passwordKeyringMu.RUnlock()
+	return passwordKeyring
+}
+
+// encryptPassword return the ciphertext and the key id, the username is bound as additional data
+func encryptPassword(username, password string) (string, string, error) {
+	kr := getPasswordKeyring()
+	if kr == nil || password == "" {
+		return password, "", nil
+	}
+
+	aead := kr.aeads[kr.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(password), []byte(username))
+	return base64.StdEncoding.EncodeToString(sealed), kr.current, nil
+}
+
+func decryptPassword(username, ciphertext, keyID string) (string, error) {
+	// stored in plaintext
+	if keyID == "" {
+		return ciphertext, nil
+	}
+
+	kr := getPasswordKeyring()
+	if kr == nil {
+		return "", fmt.Errorf("password of %s is encrypted, but no password key", username)
+	}
+
+	aead, ok := kr.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("password key %s of %s not exist", keyID, username)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid password ciphertext of %s", username)
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(username))
+	if err != nil {
+		return "", fmt.Errorf("decrypt password of %s failed:%w", username, err)
+	}
+	return string(plain), nil
+}
+
+// RotatePasswordKey re-encrypt the password of all sub users with the current key,
+// return the number of sub users re-encrypted
+func RotatePasswordKey(ctx context.Context, rdb *redis.Redis) (int, error) {
+	kr := getPasswordKeyring()
+	if kr == nil {
+		return 0, fmt.Errorf("no password key")
+	}
+
+	tables, err := scanHashes(ctx, rdb, subUserKey("*"))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, table := range tables {
+		if table["password"] == "" || table["password_key_id"] == kr.current {
+			continue
+		}
+
+		subUser, err := decodeSubUser(table)
+		if err != nil {
+			logx.Errorf("decode sub user %s failed:%v", table["username"], err)
+			continue
+		}
+
+		if err := setSubUserPassword(ctx, rdb, subUser.Username, subUser.Password); err != nil {
+			logx.Errorf("re-encrypt password of %s failed:%v", subUser.Username, err)
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// setSubUserPassword only update the password fields, avoid overwriting other fields
+func setSubUserPassword(ctx context.Context, rdb *redis.Redis, username, password string) error {
+	ciphertext, keyID, err := encryptPassword(username, password)
+	if err != nil {
+		return err
+	}
+
+	return updateSubUser(ctx, rdb, username, map[string]string{
+		"password":        ciphertext,
+		"password_key_id": keyID,
+	})
+}
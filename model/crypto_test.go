@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1 = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testKey2 = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func setTestPasswordKeys(t *testing.T, current string) {
+	if err := SetPasswordKeys(current, map[string]string{"k1": testKey1, "k2": testKey2}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetPasswordKeys("", nil) })
+}
+
+func TestSubUserPasswordEncrypt(t *testing.T) {
+	rdb := newTestRedis(t)
+	setTestPasswordKeys(t, "k1")
+
+	subUser := &SubUser{Username: "sub1", Password: "secret-password"}
+	if err := SaveSubUser(rdb, subUser); err != nil {
+		t.Fatal(err)
+	}
+	if subUser.Password != "secret-password" {
+		t.Fatalf("SaveSubUser should not change the caller's password")
+	}
+
+	raw, err := rdb.Hgetall(subUserKey("sub1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(raw["password"], "secret") || raw["password_key_id"] != "k1" {
+		t.Fatalf("password not encrypted %#v", raw)
+	}
+
+	got, err := GetSubUser(rdb, "sub1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "secret-password" {
+		t.Fatalf("unexpected password %s", got.Password)
+	}
+
+	// ciphertext is bound to the username
+	raw["username"] = "sub2"
+	if _, err := decodeSubUser(raw); err == nil {
+		t.Fatalf("expect decrypt failed with another username")
+	}
+}
+
+func TestRotatePasswordKey(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// record saved before encryption enabled
+	if err := SaveSubUser(rdb, &SubUser{Username: "plain", Password: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	setTestPasswordKeys(t, "k1")
+	if err := SaveSubUser(rdb, &SubUser{Username: "old", Password: "p2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	setTestPasswordKeys(t, "k2")
+	count, err := RotatePasswordKey(ctx, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expect 2 re-encrypted, got %d", count)
+	}
+
+	// the old key can be dropped after rotation
+	if err := SetPasswordKeys("k2", map[string]string{"k2": testKey2}); err != nil {
+		t.Fatal(err)
+	}
+
+	for username, password := range map[string]string{"plain": "p1", "old": "p2"} {
+		subUser, err := GetSubUser(rdb, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subUser.Password != password || subUser.PasswordKeyID != "k2" {
+			t.Fatalf("unexpected sub user %s password %s key %s", username, subUser.Password, subUser.PasswordKeyID)
+		}
+	}
+}
+
+func TestGetAllSubUsersWithoutKey(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	setTestPasswordKeys(t, "k1")
+	if err := SaveSubUser(rdb, &SubUser{Username: "sub1", UserID: "u1", Password: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is lost, the background jobs still see the sub user
+	if err := SetPasswordKeys("", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	subUsers, err := GetAllSubUsers(ctx, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subUsers) != 1 || subUsers[0].Username != "sub1" || subUsers[0].Password != "" {
+		t.Fatalf("unexpected sub users %#v", subUsers)
+	}
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// the resolutions of the stats history
+const (
+	HistoryMinute = "minute"
+	HistoryHour   = "hour"
+	HistoryDay    = "day"
+)
+
+// HistoryPoint is the stats of a sub user in the bucket start at Timestamp
+type HistoryPoint struct {
+	Timestamp int64
+	// peak bandwidth in the bucket, unit KB
+	Bandwidth int64
+	// traffic used in the bucket
+	Traffic int64
+}
+
+// HistoryStep return the seconds of a bucket of the resolution, 0 if the resolution is unknown
+func HistoryStep(resolution string) int64 {
+	switch resolution {
+	case HistoryMinute:
+		return 5 * 60
+	case HistoryHour:
+		return 60 * 60
+	case HistoryDay:
+		return 24 * 60 * 60
+	}
+	return 0
+}
+
+func historyKey(resolution, username string) string {
+	return fmt.Sprintf(redisKeyHistoryZset, resolution, username)
+}
+
+func historySubUserListKey(uuid string) string {
+	return fmt.Sprintf(redisKeyHistorySubUserZset, uuid)
+}
+
+// the member is unique by the timestamp, so the point can be replaced
+func encodeHistoryPoint(point *HistoryPoint) string {
+	return fmt.Sprintf("%d:%d:%d", point.Timestamp, point.Bandwidth, point.Traffic)
+}
+
+func decodeHistoryPoint(member string) (*HistoryPoint, error) {
+	fields := strings.Split(member, ":")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid history point %s", member)
+	}
+
+	values := make([]int64, 0, len(fields))
+	for _, field := range fields {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history point %s", member)
+		}
+		values = append(values, value)
+	}
+	return &HistoryPoint{Timestamp: values[0], Bandwidth: values[1], Traffic: values[2]}, nil
+}
+
+// SaveHistoryPoints replace the points of the sub user in the same buckets,
+// and drop the points older than retention seconds. the whole history expire if no points saved in retention
+func SaveHistoryPoints(ctx context.Context, rdb *redis.Redis, resolution, username string, points []*HistoryPoint, retention int64) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return err
+	}
+
+	key := historyKey(resolution, username)
+	for _, point := range points {
+		ts := strconv.FormatInt(point.Timestamp, 10)
+		pipe.ZRemRangeByScore(ctx, key, ts, ts)
+		pipe.ZAdd(ctx, key, goredis.Z{Score: float64(point.Timestamp), Member: encodeHistoryPoint(point)})
+	}
+
+	if retention > 0 {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(time.Now().Unix()-retention, 10))
+		pipe.Expire(ctx, key, time.Duration(retention)*time.Second)
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetHistoryPoints return the points of the sub users in [start, end], ordered by timestamp
+func GetHistoryPoints(ctx context.Context, rdb *redis.Redis, resolution string, usernames []string, start, end int64) (map[string][]*HistoryPoint, error) {
+	if len(usernames) == 0 {
+		return map[string][]*HistoryPoint{}, nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, username := range usernames {
+		pipe.ZRangeByScore(ctx, historyKey(resolution, username), &goredis.ZRangeBy{
+			Min: strconv.FormatInt(start, 10),
+			Max: strconv.FormatInt(end, 10),
+		})
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]*HistoryPoint, len(usernames))
+	for i, cmd := range cmds {
+		members := cmd.(*goredis.StringSliceCmd).Val()
+		points := make([]*HistoryPoint, 0, len(members))
+		for _, member := range members {
+			point, err := decodeHistoryPoint(member)
+			if err != nil {
+				logx.Errorf("GetHistoryPoints %s", err.Error())
+				continue
+			}
+			points = append(points, point)
+		}
+		history[usernames[i]] = points
+	}
+	return history, nil
+}
+
+// AddHistorySubUser remember the sub user has history, collected is the timestamp of its latest point,
+// the sub user is kept after deleted until its history expired
+func AddHistorySubUser(ctx context.Context, rdb *redis.Redis, uuid, username string, collected int64) error {
+	_, err := rdb.ZaddCtx(ctx, historySubUserListKey(uuid), collected, username)
+	return err
+}
+
+// GetHistoryCollected return the timestamp of the latest point of the sub user, 0 if never collected
+func GetHistoryCollected(ctx context.Context, rdb *redis.Redis, uuid, username string) (int64, error) {
+	collected, err := rdb.ZscoreCtx(ctx, historySubUserListKey(uuid), username)
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return collected, err
+}
+
+// GetHistorySubUsers return all the sub users have history of the account, include the deprecated and deleted
+func GetHistorySubUsers(ctx context.Context, rdb *redis.Redis, uuid string) ([]string, error) {
+	return rdb.ZrangeCtx(ctx, historySubUserListKey(uuid), 0, -1)
+}
+
+// IsHistorySubUser return true if the sub user has history in the account
+func IsHistorySubUser(ctx context.Context, rdb *redis.Redis, uuid, username string) (bool, error) {
+	_, err := rdb.ZscoreCtx(ctx, historySubUserListKey(uuid), username)
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// KEYS[1] history sub user list of the account
+// ARGV[1] the timestamp, ARGV[2..] the history key prefix of each resolution
+// the history of the sub users forgot is deleted in the same step, the ones collected meanwhile are kept
+const trimHistorySubUsersScript = `
+local usernames = redis.call('ZRANGEBYSCORE', KEYS[1], 0, '(' .. ARGV[1])
+for _, username in ipairs(usernames) do
+	for i = 2, #ARGV do
+		redis.call('DEL', ARGV[i] .. username)
+	end
+	redis.call('ZREM', KEYS[1], username)
+end
+return #usernames
+`
+
+func historyKeyPrefixes() []string {
+	resolutions := []string{HistoryMinute, HistoryHour, HistoryDay}
+	prefixes := make([]string, 0, len(resolutions))
+	for _, resolution := range resolutions {
+		prefixes = append(prefixes, historyKey(resolution, ""))
+	}
+	return prefixes
+}
+
+// TrimHistorySubUsers forget the sub users whose latest point is before the timestamp and delete their history,
+// walk the history lists of all accounts, include the accounts without live sub users
+func TrimHistorySubUsers(ctx context.Context, rdb *redis.Redis, before int64) error {
+	keys, err := scanKeys(ctx, rdb, historySubUserListKey("*"))
+	if err != nil {
+		return err
+	}
+
+	args := []any{before}
+	for _, prefix := range historyKeyPrefixes() {
+		args = append(args, prefix)
+	}
+	for _, key := range keys {
+		if _, err := rdb.EvalCtx(ctx, trimHistorySubUsersScript, []string{key}, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearHistorySubUser delete the history of the username, the sub user created again with the name start a new one
+func ClearHistorySubUser(ctx context.Context, rdb *redis.Redis, uuid, username string) error {
+	keys := make([]string, 0, 3)
+	for _, prefix := range historyKeyPrefixes() {
+		keys = append(keys, prefix+username)
+	}
+
+	if _, err := rdb.DelCtx(ctx, keys...); err != nil {
+		return err
+	}
+
+	_, err := rdb.ZremCtx(ctx, historySubUserListKey(uuid), username)
+	return err
+}
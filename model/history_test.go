@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryPoints(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	now := time.Now().Unix() / 300 * 300
+	points := []*HistoryPoint{
+		{Timestamp: now - 3600, Bandwidth: 1, Traffic: 10},
+		{Timestamp: now - 300, Bandwidth: 2, Traffic: 20},
+		{Timestamp: now, Bandwidth: 3, Traffic: 30},
+	}
+	if err := SaveHistoryPoints(ctx, rdb, HistoryMinute, "00001_a", points, 7200); err != nil {
+		t.Fatal(err)
+	}
+
+	// the partial bucket is replaced, the expired one is dropped
+	points = []*HistoryPoint{
+		{Timestamp: now - 7500, Bandwidth: 1, Traffic: 1},
+		{Timestamp: now, Bandwidth: 5, Traffic: 50},
+	}
+	if err := SaveHistoryPoints(ctx, rdb, HistoryMinute, "00001_a", points, 7200); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := GetHistoryPoints(ctx, rdb, HistoryMinute, []string{"00001_a", "00001_b"}, now-7200, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []*HistoryPoint{
+		{Timestamp: now - 3600, Bandwidth: 1, Traffic: 10},
+		{Timestamp: now - 300, Bandwidth: 2, Traffic: 20},
+		{Timestamp: now, Bandwidth: 5, Traffic: 50},
+	}
+	if !reflect.DeepEqual(history["00001_a"], expect) {
+		t.Fatalf("unexpected history %v", history["00001_a"])
+	}
+	if len(history["00001_b"]) != 0 {
+		t.Fatalf("unexpected history %v", history["00001_b"])
+	}
+}
+
+func TestHistorySubUsers(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := AddHistorySubUser(ctx, rdb, "u1", "00001_a", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddHistorySubUser(ctx, rdb, "u1", "00001_b", 300); err != nil {
+		t.Fatal(err)
+	}
+
+	collected, err := GetHistoryCollected(ctx, rdb, "u1", "00001_b")
+	if err != nil || collected != 300 {
+		t.Fatalf("unexpected collected %d %v", collected, err)
+	}
+
+	collected, err = GetHistoryCollected(ctx, rdb, "u1", "00001_c")
+	if err != nil || collected != 0 {
+		t.Fatalf("unexpected collected %d %v", collected, err)
+	}
+
+	// the account without live sub users is trimmed too
+	if err := AddHistorySubUser(ctx, rdb, "u2", "00002_a", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, username := range []string{"00001_a", "00001_b"} {
+		if err := SaveHistoryPoints(ctx, rdb, HistoryHour, username, []*HistoryPoint{{Timestamp: 3600, Traffic: 1}}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := TrimHistorySubUsers(ctx, rdb, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	// the history of the forgot sub user is deleted
+	history, err := GetHistoryPoints(ctx, rdb, HistoryHour, []string{"00001_a", "00001_b"}, 0, 7200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history["00001_a"]) != 0 || len(history["00001_b"]) != 1 {
+		t.Fatalf("unexpected history after trim %v", history)
+	}
+
+	if usernames, err := GetHistorySubUsers(ctx, rdb, "u2"); err != nil || len(usernames) != 0 {
+		t.Fatalf("unexpected history sub users of u2 %v %v", usernames, err)
+	}
+
+	usernames, err := GetHistorySubUsers(ctx, rdb, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usernames, []string{"00001_b"}) {
+		t.Fatalf("unexpected history sub users %v", usernames)
+	}
+
+	ok, err := IsHistorySubUser(ctx, rdb, "u1", "00001_a")
+	if err != nil || ok {
+		t.Fatalf("trimmed sub user still has history %v %v", ok, err)
+	}
+	// created again with the same name
+	if err := ClearHistorySubUser(ctx, rdb, "u1", "00001_b"); err != nil {
+		t.Fatal(err)
+	}
+	if collected, err := GetHistoryCollected(ctx, rdb, "u1", "00001_b"); err != nil || collected != 0 {
+		t.Fatalf("unexpected collected after clear %d %v", collected, err)
+	}
+	history, err = GetHistoryPoints(ctx, rdb, HistoryHour, []string{"00001_b"}, 0, 7200)
+	if err != nil || len(history["00001_b"]) != 0 {
+		t.Fatalf("unexpected history after clear %v %v", history, err)
+	}
+}
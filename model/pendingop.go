@@ -0,0 +1,200 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	PendingOpCreate    = "create"
+	PendingOpDelete    = "delete"
+	PendingOpDeprecate = "deprecate"
+)
+
+var ErrPendingOpExist = errors.New("another operation is in progress for this sub user")
+
+// PendingOp is a journal entry of a sub user operation which
+// touches both the IPPM server and redis, it is removed when the
+// operation finish, left entries are resolved by the saga retrier
+type PendingOp struct {
+	Kind              string `redis:"kind"`
+	UserID            string `redis:"user_id"`
+	SubUsername       string `redis:"sub_username"`
+	MaxBandwidthLimit int64  `redis:"max_bandwidth_limit"`
+	TotalTrafficLimit int64  `redis:"total_traffic_limit"`
+	QuotaReserved     bool   `redis:"quota_reserved"`
+	QuotaReleased     bool   `redis:"quota_released"`
+	CreateTime        int64  `redis:"create_time"`
+	Retries           int64  `redis:"retries"`
+}
+
+func pendingOpKey(subUsername string) string {
+	return fmt.Sprintf(redisKeyPendingOpTable, subUsername)
+}
+
+// BeginPendingOp record the operation, only one operation can be pending for a sub user
+func BeginPendingOp(rdb *redis.Redis, op *PendingOp) error {
+	if op == nil {
+		return fmt.Errorf("pending op is nil")
+	}
+
+	if op.SubUsername == "" {
+		return fmt.Errorf("empty sub username")
+	}
+
+	if op.CreateTime == 0 {
+		op.CreateTime = time.Now().Unix()
+	}
+
+	ok, err := rdb.Zaddnx(redisKeyPendingOpZset, op.CreateTime, op.SubUsername)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrPendingOpExist
+	}
+
+	return SavePendingOp(rdb, op)
+}
+
+func SavePendingOp(rdb *redis.Redis, op *PendingOp) error {
+	m, err := structToMap(op)
+	if err != nil {
+		return err
+	}
+
+	return rdb.Hmset(pendingOpKey(op.SubUsername), m)
+}
+
+// RefreshPendingOpLimits take the limits of the sub user after the operation begin,
+// the limits read before may be changed by an edit, the edits are refused once the operation begin
+func RefreshPendingOpLimits(rdb *redis.Redis, op *PendingOp) error {
+	values, err := rdb.Hmget(subUserKey(op.SubUsername), "max_bandwidth_limit", "total_traffic_limit")
+	if err != nil {
+		return err
+	}
+
+	if len(values) != 2 || values[0] == "" {
+		return ErrSubUserNotExist
+	}
+
+	bandwidth, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	traffic, err := strconv.ParseInt(values[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	op.MaxBandwidthLimit = bandwidth
+	op.TotalTrafficLimit = traffic
+	return rdb.Hmset(pendingOpKey(op.SubUsername), map[string]string{
+		"max_bandwidth_limit": values[0],
+		"total_traffic_limit": values[1],
+	})
+}
+
+func SetPendingOpQuotaReserved(rdb *redis.Redis, subUsername string) error {
+	return rdb.Hset(pendingOpKey(subUsername), "quota_reserved", "true")
+}
+
+func SetPendingOpQuotaReleased(rdb *redis.Redis, subUsername string) error {
+	return rdb.Hset(pendingOpKey(subUsername), "quota_released", "true")
+}
+
+func IncrPendingOpRetries(rdb *redis.Redis, subUsername string) error {
+	_, err := rdb.Hincrby(pendingOpKey(subUsername), "retries", 1)
+	return err
+}
+
+func RemovePendingOp(rdb *redis.Redis, subUsername string) error {
+	if _, err := rdb.Del(pendingOpKey(subUsername)); err != nil {
+		return err
+	}
+
+	_, err := rdb.Zrem(redisKeyPendingOpZset, subUsername)
+	return err
+}
+
+func GetPendingOp(rdb *redis.Redis, subUsername string) (*PendingOp, error) {
+	data, err := rdb.Hgetall(pendingOpKey(subUsername))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	op := &PendingOp{}
+	if err := mapToStruct(data, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// GetPendingOpsBefore return the operations begin before the timestamp
+func GetPendingOpsBefore(ctx context.Context, rdb *redis.Redis, timestamp int64) ([]*PendingOp, error) {
+	pairs, err := rdb.ZrangebyscoreWithScoresCtx(ctx, redisKeyPendingOpZset, 0, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pair := range pairs {
+		pipe.HGetAll(ctx, pendingOpKey(pair.Key))
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]*PendingOp, 0, len(cmds))
+	for i, cmd := range cmds {
+		result, err := cmd.(*goredis.MapStringStringCmd).Result()
+		if err != nil {
+			logx.Errorf("GetPendingOpsBefore parse result failed:%s", err.Error())
+			continue
+		}
+
+		if len(result) == 0 {
+			// the journal table lost, only the zset member left
+			logx.Errorf("pending op %s not exist", pairs[i].Key)
+			if _, err := rdb.Zrem(redisKeyPendingOpZset, pairs[i].Key); err != nil {
+				logx.Errorf("remove pending op %s failed:%v", pairs[i].Key, err)
+			}
+			continue
+		}
+
+		op := PendingOp{}
+		if err := mapToStruct(result, &op); err != nil {
+			logx.Errorf("GetPendingOpsBefore mapToStruct error:%s", err.Error())
+			continue
+		}
+
+		ops = append(ops, &op)
+	}
+
+	return ops, nil
+}
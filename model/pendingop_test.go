@@ -0,0 +1,46 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPendingOp(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	op := &PendingOp{Kind: PendingOpCreate, UserID: "u1", SubUsername: "sub1", MaxBandwidthLimit: 10, TotalTrafficLimit: 20}
+	if err := BeginPendingOp(rdb, op); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BeginPendingOp(rdb, &PendingOp{Kind: PendingOpDelete, SubUsername: "sub1"}); !errors.Is(err, ErrPendingOpExist) {
+		t.Fatalf("expect ErrPendingOpExist, got %v", err)
+	}
+
+	if err := SetPendingOpQuotaReserved(rdb, "sub1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := GetPendingOpsBefore(ctx, rdb, time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].Kind != PendingOpCreate || !ops[0].QuotaReserved || ops[0].TotalTrafficLimit != 20 {
+		t.Fatalf("unexpected pending ops %#v", ops)
+	}
+
+	if err := RemovePendingOp(rdb, "sub1"); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err = GetPendingOp(rdb, "sub1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != nil {
+		t.Fatalf("expect pending op removed")
+	}
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	PeriodDay    = "day"
+	PeriodWeek   = "week"
+	PeriodMonth  = "month"
+	PeriodCustom = "custom"
+
+	// renew the traffic limit at the end of period
+	RenewModeAuto = "auto"
+	// stop the sub user at the end of period
+	RenewModeStop = "stop"
+
+	maxCustomPeriodDays = 366
+)
+
+// CheckPeriod validate the period type and renew mode,
+// days is only used by custom period
+func CheckPeriod(periodType string, days int64, renewMode string) error {
+	switch periodType {
+	case PeriodDay, PeriodWeek, PeriodMonth:
+	case PeriodCustom:
+		if days <= 0 || days > maxCustomPeriodDays {
+			return fmt.Errorf("custom period days must between 1 and %d", maxCustomPeriodDays)
+		}
+	default:
+		return fmt.Errorf("invalid period type %s", periodType)
+	}
+
+	if renewMode != RenewModeAuto && renewMode != RenewModeStop {
+		return fmt.Errorf("invalid renew mode %s", renewMode)
+	}
+	return nil
+}
+
+// PeriodEnd return the end of the period which begin at start.
+// the month periods end at the day of anchor, the begin of the first period,
+// clamped to the last day of short months, so Jan 31 goes to Feb 29 then Mar 31. 0 anchor means start
+func PeriodEnd(anchor, start int64, periodType string, days int64) int64 {
+	t := time.Unix(start, 0).UTC()
+	switch periodType {
+	case PeriodDay:
+		return t.AddDate(0, 0, 1).Unix()
+	case PeriodWeek:
+		return t.AddDate(0, 0, 7).Unix()
+	case PeriodCustom:
+		return t.AddDate(0, 0, int(days)).Unix()
+	}
+
+	if anchor == 0 || anchor > start {
+		anchor = start
+	}
+	a := time.Unix(anchor, 0).UTC()
+	months := (t.Year()-a.Year())*12 + int(t.Month()-a.Month())
+	for {
+		end := addMonths(a, months).Unix()
+		if end > start {
+			return end
+		}
+		months++
+	}
+}
+
+// addMonths return the same day of t after the months, or the last day if the month is shorter
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// NextPeriod return the period which contains now, begin at the end of current period
+func NextPeriod(anchor, end int64, periodType string, days int64, now int64) (int64, int64) {
+	start := end
+	end = PeriodEnd(anchor, start, periodType, days)
+	for end <= now {
+		start = end
+		end = PeriodEnd(anchor, start, periodType, days)
+	}
+	return start, end
+}
+
+// GetPeriodType return month for the sub user created before period support
+func (s *SubUser) GetPeriodType() string {
+	if s.PeriodType == "" {
+		return PeriodMonth
+	}
+	return s.PeriodType
+}
+
+// GetPeriodAnchor return the start time for the sub user created before the anchor recorded
+func (s *SubUser) GetPeriodAnchor() int64 {
+	if s.PeriodAnchor == 0 {
+		return s.StartTime
+	}
+	return s.PeriodAnchor
+}
+
+// GetRenewMode return auto for the sub user created before period support
+func (s *SubUser) GetRenewMode() string {
+	if s.RenewMode == "" {
+		return RenewModeAuto
+	}
+	return s.RenewMode
+}
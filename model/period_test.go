@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodEnd(t *testing.T) {
+	start := time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC).Unix()
+
+	cases := []struct {
+		periodType string
+		days       int64
+		expect     time.Time
+	}{
+		{PeriodDay, 0, time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{PeriodWeek, 0, time.Date(2024, 2, 7, 8, 0, 0, 0, time.UTC)},
+		{PeriodMonth, 0, time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC)},
+		{PeriodCustom, 10, time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		if end := PeriodEnd(start, start, c.periodType, c.days); end != c.expect.Unix() {
+			t.Errorf("%s period end %s, expect %s", c.periodType, time.Unix(end, 0).UTC(), c.expect)
+		}
+	}
+}
+
+func TestNextPeriod(t *testing.T) {
+	end := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC).Unix()
+
+	start, next := NextPeriod(end, end, PeriodDay, 0, now)
+	if start != time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC).Unix() || next != time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Fatalf("unexpected next period %d - %d", start, next)
+	}
+}
+
+func TestMonthPeriodKeepAnchor(t *testing.T) {
+	anchor := time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC).Unix()
+
+	expects := []time.Time{
+		time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 31, 8, 0, 0, 0, time.UTC),
+	}
+
+	end := anchor
+	for _, expect := range expects {
+		end = PeriodEnd(anchor, end, PeriodMonth, 0)
+		if end != expect.Unix() {
+			t.Fatalf("period end %s, expect %s", time.Unix(end, 0).UTC(), expect)
+		}
+	}
+
+	// skip the missed periods
+	now := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC).Unix()
+	start, next := NextPeriod(anchor, expects[1].Unix(), PeriodMonth, 0, now)
+	if start != expects[3].Unix() || next != time.Date(2024, 6, 30, 8, 0, 0, 0, time.UTC).Unix() {
+		t.Fatalf("unexpected next period %s - %s", time.Unix(start, 0).UTC(), time.Unix(next, 0).UTC())
+	}
+}
+
+func TestCheckPeriod(t *testing.T) {
+	if err := CheckPeriod(PeriodMonth, 0, RenewModeAuto); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPeriod(PeriodCustom, 0, RenewModeAuto); err == nil {
+		t.Fatal("expect error for custom period without days")
+	}
+	if err := CheckPeriod("year", 0, RenewModeStop); err == nil {
+		t.Fatal("expect error for invalid period type")
+	}
+	if err := CheckPeriod(PeriodWeek, 0, "never"); err == nil {
+		t.Fatal("expect error for invalid renew mode")
+	}
+}
@@ -0,0 +1,418 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+var (
+	ErrUserNotExist       = errors.New("user not exist, please login again")
+	ErrNotEnoughBandwidth = errors.New("cannot allocate more than the maximum bandwidth")
+	ErrNotEnoughTraffic   = errors.New("cannot allocate more than the maximum traffic")
+	ErrNegativeQuota      = errors.New("bandwidth and traffic can not be negative")
+	ErrPendingOpNotExist  = errors.New("pending operation not exist")
+	ErrAllocationChanged  = errors.New("allocated quota changed")
+
+	ErrBandwidthBelowAllocated = errors.New("bandwidth limit can not be less than the allocated")
+	ErrTrafficBelowAllocated   = errors.New("traffic limit can not be less than the allocated")
+)
+
+const (
+	quotaOK                 = 0
+	quotaUserNotExist       = -1
+	quotaNotEnoughBandwidth = -2
+	quotaNotEnoughTraffic   = -3
+	quotaPendingOpNotExist  = -4
+	quotaAllocationChanged  = -5
+	quotaSubUserNotExist    = -6
+	quotaSubUserBusy        = -7
+)
+
+// KEYS[1] user table
+// ARGV[1] bandwidth delta, ARGV[2] traffic delta
+// increase of allocation is checked against the limit, decrease always success
+const adjustQuotaScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+local bandwidthDelta = tonumber(ARGV[1])
+local trafficDelta = tonumber(ARGV[2])
+
+local bandwidthLimit = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_limit') or '0')
+local bandwidthAllocated = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_allocated') or '0')
+if bandwidthDelta > 0 and bandwidthAllocated + bandwidthDelta > bandwidthLimit then
+	return -2
+end
+
+local trafficLimit = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_limit') or '0')
+local trafficAllocated = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_allocated') or '0')
+if trafficDelta > 0 and trafficAllocated + trafficDelta > trafficLimit then
+	return -3
+end
+
+redis.call('HINCRBY', KEYS[1], 'max_bandwidth_allocated', bandwidthDelta)
+redis.call('HINCRBY', KEYS[1], 'total_traffic_allocated', trafficDelta)
+return 0
+`
+
+// AdjustQuota change the allocated bandwidth and traffic of user in one step,
+// the deltas can be negative to give back quota
+func AdjustQuota(ctx context.Context, rdb *redis.Redis, uuid string, bandwidthDelta, trafficDelta int64) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	result, err := rdb.EvalCtx(ctx, adjustQuotaScript, []string{userKey(uuid)}, bandwidthDelta, trafficDelta)
+	if err != nil {
+		return err
+	}
+
+	code, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected adjust quota result %v", result)
+	}
+
+	switch code {
+	case quotaOK:
+		return nil
+	case quotaUserNotExist:
+		return ErrUserNotExist
+	case quotaNotEnoughBandwidth:
+		return ErrNotEnoughBandwidth
+	case quotaNotEnoughTraffic:
+		return ErrNotEnoughTraffic
+	}
+	return fmt.Errorf("unexpected adjust quota result %d", code)
+}
+
+// KEYS[1] user table
+// ARGV[1] bandwidth limit, ARGV[2] traffic limit, empty means not change
+// the limit can not be less than the allocated
+const setQuotaLimitScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+if ARGV[1] ~= '' then
+	local bandwidthAllocated = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_allocated') or '0')
+	if tonumber(ARGV[1]) < bandwidthAllocated then
+		return -2
+	end
+end
+
+if ARGV[2] ~= '' then
+	local trafficAllocated = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_allocated') or '0')
+	if tonumber(ARGV[2]) < trafficAllocated then
+		return -3
+	end
+end
+
+if ARGV[1] ~= '' then
+	redis.call('HSET', KEYS[1], 'max_bandwidth_limit', ARGV[1])
+end
+if ARGV[2] ~= '' then
+	redis.call('HSET', KEYS[1], 'total_traffic_limit', ARGV[2])
+end
+return 0
+`
+
+// SetQuotaLimit change the max bandwidth and total traffic of user, nil means not change
+func SetQuotaLimit(ctx context.Context, rdb *redis.Redis, uuid string, bandwidth, traffic *int64) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	var bandwidthArg, trafficArg string
+	if bandwidth != nil {
+		bandwidthArg = fmt.Sprintf("%d", *bandwidth)
+	}
+	if traffic != nil {
+		trafficArg = fmt.Sprintf("%d", *traffic)
+	}
+
+	result, err := rdb.EvalCtx(ctx, setQuotaLimitScript, []string{userKey(uuid)}, bandwidthArg, trafficArg)
+	if err != nil {
+		return err
+	}
+
+	code, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected set quota limit result %v", result)
+	}
+
+	switch code {
+	case quotaOK:
+		return nil
+	case quotaUserNotExist:
+		return ErrUserNotExist
+	case quotaNotEnoughBandwidth:
+		return ErrBandwidthBelowAllocated
+	case quotaNotEnoughTraffic:
+		return ErrTrafficBelowAllocated
+	}
+	return fmt.Errorf("unexpected set quota limit result %d", code)
+}
+
+// KEYS[1] user table, KEYS[2..] pending operations of the sub users
+// ARGV[1] bandwidth, ARGV[2] traffic
+// the pending operations are marked quota reserved in the same step,
+// so the saga retrier always know whether to give back the quota
+const reserveQuotaScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 0 then
+		return -4
+	end
+end
+
+local bandwidth = tonumber(ARGV[1])
+local traffic = tonumber(ARGV[2])
+
+local bandwidthLimit = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_limit') or '0')
+local bandwidthAllocated = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_allocated') or '0')
+if bandwidth > 0 and bandwidthAllocated + bandwidth > bandwidthLimit then
+	return -2
+end
+
+local trafficLimit = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_limit') or '0')
+local trafficAllocated = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_allocated') or '0')
+if traffic > 0 and trafficAllocated + traffic > trafficLimit then
+	return -3
+end
+
+redis.call('HINCRBY', KEYS[1], 'max_bandwidth_allocated', bandwidth)
+redis.call('HINCRBY', KEYS[1], 'total_traffic_allocated', traffic)
+for i = 2, #KEYS do
+	redis.call('HSET', KEYS[i], 'quota_reserved', 'true')
+end
+return 0
+`
+
+// ReserveQuota allocate bandwidth and traffic for the sub users,
+// and mark their pending operations quota reserved at the same time
+func ReserveQuota(ctx context.Context, rdb *redis.Redis, uuid string, bandwidth, traffic int64, subUsernames ...string) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	// negative amount lower the allocated without the check of limit
+	if bandwidth < 0 || traffic < 0 {
+		return ErrNegativeQuota
+	}
+
+	keys := make([]string, 0, len(subUsernames)+1)
+	keys = append(keys, userKey(uuid))
+	for _, subUsername := range subUsernames {
+		keys = append(keys, pendingOpKey(subUsername))
+	}
+
+	result, err := rdb.EvalCtx(ctx, reserveQuotaScript, keys, bandwidth, traffic)
+	if err != nil {
+		return err
+	}
+
+	code, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected reserve quota result %v", result)
+	}
+
+	switch code {
+	case quotaOK:
+		return nil
+	case quotaUserNotExist:
+		return ErrUserNotExist
+	case quotaNotEnoughBandwidth:
+		return ErrNotEnoughBandwidth
+	case quotaNotEnoughTraffic:
+		return ErrNotEnoughTraffic
+	case quotaPendingOpNotExist:
+		return ErrPendingOpNotExist
+	}
+	return fmt.Errorf("unexpected reserve quota result %d", code)
+}
+
+// ReleaseQuota give back the bandwidth and traffic of a sub user
+func ReleaseQuota(ctx context.Context, rdb *redis.Redis, uuid string, bandwidth, traffic int64) error {
+	return AdjustQuota(ctx, rdb, uuid, -bandwidth, -traffic)
+}
+
+// KEYS[1] user table, KEYS[2] sub user list of the user
+// ARGV[1] bandwidth allocated read before, ARGV[2] traffic allocated read before,
+// ARGV[3] bandwidth to set, ARGV[4] traffic to set, ARGV[5] sub user table key prefix
+// only set if the allocated not changed since read, and the sub users in the list sum to the new value
+const setAllocatedQuotaScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+local bandwidthAllocated = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_allocated') or '0')
+local trafficAllocated = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_allocated') or '0')
+if bandwidthAllocated ~= tonumber(ARGV[1]) or trafficAllocated ~= tonumber(ARGV[2]) then
+	return -5
+end
+
+local bandwidth = 0
+local traffic = 0
+for _, username in ipairs(redis.call('ZRANGE', KEYS[2], 0, -1)) do
+	local limits = redis.call('HMGET', ARGV[5] .. username, 'max_bandwidth_limit', 'total_traffic_limit')
+	bandwidth = bandwidth + tonumber(limits[1] or '0')
+	traffic = traffic + tonumber(limits[2] or '0')
+end
+if bandwidth ~= tonumber(ARGV[3]) or traffic ~= tonumber(ARGV[4]) then
+	return -5
+end
+
+redis.call('HSET', KEYS[1], 'max_bandwidth_allocated', ARGV[3], 'total_traffic_allocated', ARGV[4])
+return 0
+`
+
+// SetAllocatedQuota overwrite the allocated quota, only for the reconciler.
+// the allocated read before and the sum of the sub users are checked in the same step,
+// return ErrAllocationChanged if the quota or the sub users changed since the reconciler read them
+func SetAllocatedQuota(ctx context.Context, rdb *redis.Redis, user *User, bandwidth, traffic int64) error {
+	if user == nil || user.UUID == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	keys := []string{userKey(user.UUID), subUserListKey(user.UUID)}
+	result, err := rdb.EvalCtx(ctx, setAllocatedQuotaScript, keys,
+		user.MaxBandwidthAllocated, user.TotalTrafficAllocated, bandwidth, traffic, subUserKey(""))
+	if err != nil {
+		return err
+	}
+
+	code, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected set allocated quota result %v", result)
+	}
+
+	switch code {
+	case quotaOK:
+		return nil
+	case quotaUserNotExist:
+		return ErrUserNotExist
+	case quotaAllocationChanged:
+		return ErrAllocationChanged
+	}
+	return fmt.Errorf("unexpected set allocated quota result %d", code)
+}
+
+// QuotaLimit is the bandwidth and traffic limit of a sub user, nil means not set
+type QuotaLimit struct {
+	Bandwidth *int64
+	Traffic   *int64
+}
+
+func quotaLimitArg(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d", *v)
+}
+
+// KEYS[1] user table, KEYS[2] sub user table, KEYS[3] pending operation of the sub user
+// ARGV[1] bandwidth limit, ARGV[2] traffic limit, empty means not change
+// ARGV[3] bandwidth limit, ARGV[4] traffic limit the sub user must have now, empty means not check
+// the sub user limits and the allocated of user change in one step, return {code, old bandwidth, old traffic}
+const setSubUserQuotaScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {-1, 0, 0}
+end
+
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return {-6, 0, 0}
+end
+
+-- deleting or deprecating, the operation release the limits it read
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return {-7, 0, 0}
+end
+
+local oldBandwidth = tonumber(redis.call('HGET', KEYS[2], 'max_bandwidth_limit') or '0')
+local oldTraffic = tonumber(redis.call('HGET', KEYS[2], 'total_traffic_limit') or '0')
+if (ARGV[3] ~= '' and tonumber(ARGV[3]) ~= oldBandwidth) or (ARGV[4] ~= '' and tonumber(ARGV[4]) ~= oldTraffic) then
+	return {-5, oldBandwidth, oldTraffic}
+end
+
+local bandwidthDelta = 0
+if ARGV[1] ~= '' then
+	bandwidthDelta = tonumber(ARGV[1]) - oldBandwidth
+end
+
+local trafficDelta = 0
+if ARGV[2] ~= '' then
+	trafficDelta = tonumber(ARGV[2]) - oldTraffic
+end
+
+local bandwidthLimit = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_limit') or '0')
+local bandwidthAllocated = tonumber(redis.call('HGET', KEYS[1], 'max_bandwidth_allocated') or '0')
+if bandwidthDelta > 0 and bandwidthAllocated + bandwidthDelta > bandwidthLimit then
+	return {-2, oldBandwidth, oldTraffic}
+end
+
+local trafficLimit = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_limit') or '0')
+local trafficAllocated = tonumber(redis.call('HGET', KEYS[1], 'total_traffic_allocated') or '0')
+if trafficDelta > 0 and trafficAllocated + trafficDelta > trafficLimit then
+	return {-3, oldBandwidth, oldTraffic}
+end
+
+redis.call('HINCRBY', KEYS[1], 'max_bandwidth_allocated', bandwidthDelta)
+redis.call('HINCRBY', KEYS[1], 'total_traffic_allocated', trafficDelta)
+if ARGV[1] ~= '' then
+	redis.call('HSET', KEYS[2], 'max_bandwidth_limit', ARGV[1])
+end
+if ARGV[2] ~= '' then
+	redis.call('HSET', KEYS[2], 'total_traffic_limit', ARGV[2])
+end
+return {0, oldBandwidth, oldTraffic}
+`
+
+// SetSubUserQuota save the limits of the sub user and adjust the allocated of the user in one step,
+// so the concurrent edits never count the delta from a stale limit. the limits are refused if
+// the sub user is deleting or deprecating, or its limits are not expect. return the limits before
+func SetSubUserQuota(ctx context.Context, rdb *redis.Redis, uuid, username string, limit, expect QuotaLimit) (bandwidth, traffic int64, err error) {
+	if uuid == "" || username == "" {
+		return 0, 0, fmt.Errorf("empty uuid or username")
+	}
+
+	keys := []string{userKey(uuid), subUserKey(username), pendingOpKey(username)}
+	result, err := rdb.EvalCtx(ctx, setSubUserQuotaScript, keys,
+		quotaLimitArg(limit.Bandwidth), quotaLimitArg(limit.Traffic), quotaLimitArg(expect.Bandwidth), quotaLimitArg(expect.Traffic))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	values, ok := result.([]any)
+	if !ok || len(values) != 3 {
+		return 0, 0, fmt.Errorf("unexpected set sub user quota result %v", result)
+	}
+
+	code, _ := values[0].(int64)
+	bandwidth, _ = values[1].(int64)
+	traffic, _ = values[2].(int64)
+
+	switch code {
+	case quotaOK:
+		return bandwidth, traffic, nil
+	case quotaUserNotExist:
+		return 0, 0, ErrUserNotExist
+	case quotaNotEnoughBandwidth:
+		return 0, 0, ErrNotEnoughBandwidth
+	case quotaNotEnoughTraffic:
+		return 0, 0, ErrNotEnoughTraffic
+	case quotaAllocationChanged:
+		return 0, 0, ErrAllocationChanged
+	case quotaSubUserNotExist:
+		return 0, 0, ErrSubUserNotExist
+	case quotaSubUserBusy:
+		return 0, 0, ErrPendingOpExist
+	}
+	return 0, 0, fmt.Errorf("unexpected set sub user quota result %v", code)
+}
@@ -0,0 +1,284 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func newTestRedis(t *testing.T) *redis.Redis {
+	mr := miniredis.RunT(t)
+	return redis.New(mr.Addr())
+}
+
+func TestReserveQuotaConcurrent(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	user := &User{UUID: "u1", MaxBandwidthLimit: 1000, TotalTrafficLimit: 100000}
+	if err := SaveUser(rdb, user); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		success int
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ReserveQuota(ctx, rdb, "u1", 100, 1000)
+			if err == nil {
+				mu.Lock()
+				success++
+				mu.Unlock()
+				return
+			}
+			if !errors.Is(err, ErrNotEnoughBandwidth) {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if success != 10 {
+		t.Fatalf("expect 10 reserve success, got %d", success)
+	}
+
+	user, err := GetUser(rdb, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MaxBandwidthAllocated != 1000 || user.TotalTrafficAllocated != 10000 {
+		t.Fatalf("unexpected allocation %d %d", user.MaxBandwidthAllocated, user.TotalTrafficAllocated)
+	}
+}
+
+func TestAdjustQuota(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := ReserveQuota(ctx, rdb, "nobody", 1, 1); !errors.Is(err, ErrUserNotExist) {
+		t.Fatalf("expect ErrUserNotExist, got %v", err)
+	}
+
+	user := &User{UUID: "u2", MaxBandwidthLimit: 100, TotalTrafficLimit: 100}
+	if err := SaveUser(rdb, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReserveQuota(ctx, rdb, "u2", 100, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReserveQuota(ctx, rdb, "u2", 0, 1); !errors.Is(err, ErrNotEnoughTraffic) {
+		t.Fatalf("expect ErrNotEnoughTraffic, got %v", err)
+	}
+
+	if err := ReserveQuota(ctx, rdb, "u2", -1, 0); !errors.Is(err, ErrNegativeQuota) {
+		t.Fatalf("expect ErrNegativeQuota, got %v", err)
+	}
+
+	// decrease bandwidth and increase traffic in one step
+	if err := AdjustQuota(ctx, rdb, "u2", -50, 1); !errors.Is(err, ErrNotEnoughTraffic) {
+		t.Fatalf("expect ErrNotEnoughTraffic, got %v", err)
+	}
+
+	if err := ReleaseQuota(ctx, rdb, "u2", 40, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := GetUser(rdb, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MaxBandwidthAllocated != 60 || user.TotalTrafficAllocated != 40 {
+		t.Fatalf("unexpected allocation %d %d", user.MaxBandwidthAllocated, user.TotalTrafficAllocated)
+	}
+}
+
+func TestSetQuotaLimit(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	user := &User{UUID: "u1", MaxBandwidthLimit: 1000, TotalTrafficLimit: 1000, MaxBandwidthAllocated: 500, TotalTrafficAllocated: 500}
+	if err := SaveUser(rdb, user); err != nil {
+		t.Fatal(err)
+	}
+
+	low := int64(100)
+	if err := SetQuotaLimit(ctx, rdb, "u1", &low, nil); !errors.Is(err, ErrBandwidthBelowAllocated) {
+		t.Fatalf("expect ErrBandwidthBelowAllocated, got %v", err)
+	}
+
+	high := int64(2000)
+	if err := SetQuotaLimit(ctx, rdb, "u1", nil, &high); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := GetUser(rdb, "u1")
+	if got.MaxBandwidthLimit != 1000 || got.TotalTrafficLimit != 2000 {
+		t.Fatalf("unexpected limit %d/%d", got.MaxBandwidthLimit, got.TotalTrafficLimit)
+	}
+
+	if err := SetQuotaLimit(ctx, rdb, "u2", &high, nil); !errors.Is(err, ErrUserNotExist) {
+		t.Fatalf("expect ErrUserNotExist, got %v", err)
+	}
+}
+
+func TestReserveQuotaMarkPendingOps(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := SaveUser(rdb, &User{UUID: "u3", MaxBandwidthLimit: 100, TotalTrafficLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"s1", "s2"} {
+		if err := BeginPendingOp(rdb, &PendingOp{Kind: PendingOpCreate, UserID: "u3", SubUsername: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing changed if one of the ops missing
+	if err := ReserveQuota(ctx, rdb, "u3", 10, 10, "s1", "s3"); !errors.Is(err, ErrPendingOpNotExist) {
+		t.Fatalf("expect ErrPendingOpNotExist, got %v", err)
+	}
+
+	if err := ReserveQuota(ctx, rdb, "u3", 20, 20, "s1", "s2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"s1", "s2"} {
+		op, err := GetPendingOp(rdb, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !op.QuotaReserved {
+			t.Fatalf("pending op %s not marked quota reserved", name)
+		}
+	}
+
+	if op, _ := GetPendingOp(rdb, "s3"); op != nil {
+		t.Fatal("pending op s3 should not be created")
+	}
+
+	user, err := GetUser(rdb, "u3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MaxBandwidthAllocated != 20 || user.TotalTrafficAllocated != 20 {
+		t.Fatalf("unexpected allocation %d %d", user.MaxBandwidthAllocated, user.TotalTrafficAllocated)
+	}
+}
+
+func TestSetAllocatedQuota(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := SaveUser(rdb, &User{UUID: "u4", MaxBandwidthLimit: 100, TotalTrafficLimit: 100, MaxBandwidthAllocated: 50, TotalTrafficAllocated: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSubUser(rdb, &SubUser{Username: "s1", UserID: "u4", MaxBandwidthLimit: 10, TotalTrafficLimit: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddSubUserToList(rdb, "u4", "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := GetUser(rdb, "u4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sum of the sub users not match
+	if err := SetAllocatedQuota(ctx, rdb, user, 10, 30); !errors.Is(err, ErrAllocationChanged) {
+		t.Fatalf("expect ErrAllocationChanged, got %v", err)
+	}
+
+	// the allocated changed after read
+	if err := ReserveQuota(ctx, rdb, "u4", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAllocatedQuota(ctx, rdb, user, 10, 20); !errors.Is(err, ErrAllocationChanged) {
+		t.Fatalf("expect ErrAllocationChanged, got %v", err)
+	}
+
+	if user, err = GetUser(rdb, "u4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAllocatedQuota(ctx, rdb, user, 10, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err = GetUser(rdb, "u4"); err != nil {
+		t.Fatal(err)
+	}
+	if user.MaxBandwidthAllocated != 10 || user.TotalTrafficAllocated != 20 {
+		t.Fatalf("unexpected allocation %d %d", user.MaxBandwidthAllocated, user.TotalTrafficAllocated)
+	}
+}
+
+func TestSetSubUserQuota(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := SaveUser(rdb, &User{UUID: "u5", MaxBandwidthLimit: 100, TotalTrafficLimit: 100, MaxBandwidthAllocated: 10, TotalTrafficAllocated: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSubUser(rdb, &SubUser{Username: "s1", UserID: "u5", MaxBandwidthLimit: 10, TotalTrafficLimit: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	bandwidth := int64(30)
+	bandwidth, traffic, err := SetSubUserQuota(ctx, rdb, "u5", "s1", QuotaLimit{Bandwidth: &bandwidth}, QuotaLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bandwidth != 10 || traffic != 20 {
+		t.Fatalf("unexpected old limits %d %d", bandwidth, traffic)
+	}
+
+	// the delta is counted from the saved limit
+	tooMuch := int64(101)
+	if _, _, err := SetSubUserQuota(ctx, rdb, "u5", "s1", QuotaLimit{Traffic: &tooMuch}, QuotaLimit{}); !errors.Is(err, ErrNotEnoughTraffic) {
+		t.Fatalf("expect ErrNotEnoughTraffic, got %v", err)
+	}
+
+	// revert only if still the limit set
+	old, set := int64(10), int64(20)
+	if _, _, err := SetSubUserQuota(ctx, rdb, "u5", "s1", QuotaLimit{Bandwidth: &old}, QuotaLimit{Bandwidth: &set}); !errors.Is(err, ErrAllocationChanged) {
+		t.Fatalf("expect ErrAllocationChanged, got %v", err)
+	}
+
+	user, err := GetUser(rdb, "u5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MaxBandwidthAllocated != 30 || user.TotalTrafficAllocated != 20 {
+		t.Fatalf("unexpected allocation %d %d", user.MaxBandwidthAllocated, user.TotalTrafficAllocated)
+	}
+
+	// refused while deleting
+	if err := BeginPendingOp(rdb, &PendingOp{Kind: PendingOpDelete, UserID: "u5", SubUsername: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SetSubUserQuota(ctx, rdb, "u5", "s1", QuotaLimit{Bandwidth: &old}, QuotaLimit{}); !errors.Is(err, ErrPendingOpExist) {
+		t.Fatalf("expect ErrPendingOpExist, got %v", err)
+	}
+
+	op := &PendingOp{SubUsername: "s1"}
+	if err := RefreshPendingOpLimits(rdb, op); err != nil {
+		t.Fatal(err)
+	}
+	if op.MaxBandwidthLimit != 30 || op.TotalTrafficLimit != 20 {
+		t.Fatalf("unexpected pending op limits %d %d", op.MaxBandwidthLimit, op.TotalTrafficLimit)
+	}
+}
@@ -5,3 +5,28 @@ const redisKeySubUserTable = "titan:ipweb:subuser:%s"
 const redisKeyUserSubUserZset = "titan:ipweb:subuserzset:%s"
 const redisKeyInvalidSubUserZset = "titan:ipweb:deprecatedsubuser:%s"
 const redisKeyUserIndex = "titan:ipweb:index"
+const redisKeyPendingOpTable = "titan:ipweb:pendingop:%s"
+const redisKeyPendingOpZset = "titan:ipweb:pendingops"
+const redisKeyUsageLastSeen = "titan:ipweb:usage:lastseen"
+const redisKeyWebhookTable = "titan:ipweb:webhook:%s"
+const redisKeyUserWebhookZset = "titan:ipweb:userwebhooks:%s"
+const redisKeyWebhookDeliveryTable = "titan:ipweb:whdelivery:%s"
+const redisKeyWebhookDeliveryZset = "titan:ipweb:whqueue"
+const redisKeyWebhookDeliveryList = "titan:ipweb:whlog:%s"
+const redisKeyAuditStream = "titan:ipweb:audit:%s"
+const redisKeyAPIKeyTable = "titan:ipweb:apikey:%s"
+const redisKeyUserAPIKeyZset = "titan:ipweb:userapikeys:%s"
+const redisKeyTeamTable = "titan:ipweb:team:%s"
+const redisKeyTeamMemberZset = "titan:ipweb:teammembers:%s"
+const redisKeyMembershipTable = "titan:ipweb:membership:%s"
+const redisKeyTeamInviteTable = "titan:ipweb:teaminvite:%s:%s"
+const redisKeyTeamInviteZset = "titan:ipweb:teaminvites:%s"
+const redisKeySubUserStatusZset = "titan:ipweb:substatus:%s:%s"
+const redisKeySubUserPopZset = "titan:ipweb:subpop:%s:%s"
+const redisKeySubUserNameZset = "titan:ipweb:subnames:%s"
+const redisKeySubUserTrafficZset = "titan:ipweb:subtraffic:%s"
+const redisKeySubUserIndexed = "titan:ipweb:subindexed:%s"
+const redisKeySubUserQuery = "titan:ipweb:subquery:%s"
+const redisKeyBaseStatsCache = "titan:ipweb:basestats:%s"
+const redisKeyHistoryZset = "titan:ipweb:history:%s:%s"
+const redisKeyHistorySubUserZset = "titan:ipweb:historysubusers:%s"
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const scanCount = 500
+
+// scanKeys return all the keys match the pattern
+func scanKeys(ctx context.Context, rdb *redis.Redis, pattern string) ([]string, error) {
+	keys := make([]string, 0)
+	cursor := uint64(0)
+	for {
+		ks, next, err := rdb.ScanCtx(ctx, cursor, pattern, scanCount)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, ks...)
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return keys, nil
+}
+
+// scanHashes return all the hash tables whose key match the pattern
+func scanHashes(ctx context.Context, rdb *redis.Redis, pattern string) ([]map[string]string, error) {
+	keys, err := scanKeys(ctx, rdb, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		pipe.HGetAll(ctx, key)
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]map[string]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		result, err := cmd.(*goredis.MapStringStringCmd).Result()
+		if err != nil {
+			logx.Errorf("scanHashes parse result failed:%s", err.Error())
+			continue
+		}
+
+		if len(result) == 0 {
+			continue
+		}
+		tables = append(tables, result)
+	}
+
+	return tables, nil
+}
+
+// GetAllUsers scan all the users, only for background jobs
+func GetAllUsers(ctx context.Context, rdb *redis.Redis) ([]*User, error) {
+	tables, err := scanHashes(ctx, rdb, userKey("*"))
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(tables))
+	for _, table := range tables {
+		user := User{}
+		if err := mapToStruct(table, &user); err != nil {
+			logx.Errorf("GetAllUsers mapToStruct error:%s", err.Error())
+			continue
+		}
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+// BrokenSubUser is a sub user record can not be decoded, the fields are what can be read
+type BrokenSubUser struct {
+	Username string
+	UserID   string
+	Err      error
+}
+
+// GetAllSubUsers scan the sub users of all users, only for background jobs.
+// the password is not decrypted and left empty, so a missing key never hide the sub users from the jobs.
+// the broken records are logged and skipped, so one of them not stop the jobs of all users
+func GetAllSubUsers(ctx context.Context, rdb *redis.Redis) ([]*SubUser, error) {
+	subUsers, broken, err := ScanSubUsers(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range broken {
+		logx.Errorf("GetAllSubUsers skip sub user %s:%v", b.Username, b.Err)
+	}
+	return subUsers, nil
+}
+
+// ScanSubUsers is GetAllSubUsers return the broken records too,
+// for the reconciler which must not take them as not exist
+func ScanSubUsers(ctx context.Context, rdb *redis.Redis) ([]*SubUser, []*BrokenSubUser, error) {
+	keys, err := scanKeys(ctx, rdb, subUserKey("*"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		pipe.HGetAll(ctx, key)
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subUsers := make([]*SubUser, 0, len(cmds))
+	broken := make([]*BrokenSubUser, 0)
+	for i, cmd := range cmds {
+		table, err := cmd.(*goredis.MapStringStringCmd).Result()
+		if err == nil && len(table) == 0 {
+			// removed after scanned
+			continue
+		}
+
+		var subUser *SubUser
+		if err == nil {
+			subUser, err = decodeSubUserRecord(table)
+		}
+		if err != nil {
+			// the username is in the key even if the record is broken
+			username := strings.TrimPrefix(keys[i], subUserKey(""))
+			broken = append(broken, &BrokenSubUser{Username: username, UserID: table["user_id"], Err: err})
+			continue
+		}
+
+		subUser.Password = ""
+		subUsers = append(subUsers, subUser)
+	}
+	return subUsers, broken, nil
+}
@@ -12,7 +12,8 @@ import (
 )
 
 type SubUser struct {
-	Username          string `redis:"username"`
+	Username string `redis:"username"`
+	// encrypted if PasswordKeyID is not empty
 	Password          string `redis:"password"`
 	ServerAddress     string `redis:"server_address"`
 	UploadRateLimit   int64  `redis:"upload_rate_limit"`
@@ -22,10 +23,41 @@ type SubUser struct {
 	CreateTime        int64  `redis:"create_time"`
 	DeprecatedTime    int64  `redis:"deprecated_time"`
 	Status            string `redis:"status"`
-	StartTime         int64  `redis:"start_time"`
-	EndTime           int64  `redis:"end_time"`
-	UserID            string `redis:"user_id"`
-	PopID             string `redis:"pop_id"`
+	// why the sub user is stopped by system, empty if by user
+	StatusReason string `redis:"status_reason"`
+	StartTime    int64  `redis:"start_time"`
+	EndTime      int64  `redis:"end_time"`
+	// begin of the first period, the month periods end at its day
+	PeriodAnchor int64  `redis:"period_anchor"`
+	UserID       string `redis:"user_id"`
+	PopID        string `redis:"pop_id"`
+	// day, week, month or custom
+	PeriodType string `redis:"period_type"`
+	PeriodDays int64  `redis:"period_days"`
+	// auto or stop
+	RenewMode string `redis:"renew_mode"`
+	// route of the sub user, same as ippm server
+	RouteMode            int    `redis:"route_mode"`
+	RouteNodeID          string `redis:"route_node_id"`
+	RouteIntervalMinutes int    `redis:"route_interval_minutes"`
+	RouteUtcMinuteOfDay  int    `redis:"route_utc_minute_of_day"`
+	// the key used to encrypt password, empty means plaintext
+	PasswordKeyID string `redis:"password_key_id"`
+	// the highest traffic threshold notified in current period
+	NotifiedThreshold int64 `redis:"notified_threshold"`
+	// the rate limit set by the bandwidth checker, the configured UploadRateLimit and DownloadRateLimit
+	// are kept and restored after the bandwidth drop
+	Throttled                  bool  `redis:"throttled"`
+	ThrottledUploadRateLimit   int64 `redis:"throttled_upload_rate_limit"`
+	ThrottledDownloadRateLimit int64 `redis:"throttled_download_rate_limit"`
+}
+
+// EffectiveRateLimit return the rate limit on the IPPM server, the throttled one if throttled
+func (s *SubUser) EffectiveRateLimit() (upload, download int64) {
+	if s.Throttled {
+		return s.ThrottledUploadRateLimit, s.ThrottledDownloadRateLimit
+	}
+	return s.UploadRateLimit, s.DownloadRateLimit
 }
 
 func subUserKey(username string) string {
@@ -49,18 +81,197 @@ func SaveSubUser(rdb *redis.Redis, subUser *SubUser) error {
 		return fmt.Errorf("empty Username")
 	}
 
-	m, err := structToMap(subUser)
+	// the caller keep the plaintext
+	record := *subUser
+	password, keyID, err := encryptPassword(record.Username, record.Password)
+	if err != nil {
+		return err
+	}
+	record.Password = password
+	record.PasswordKeyID = keyID
+
+	m, err := structToMap(&record)
 	if err != nil {
 		return err
 	}
 
 	key := subUserKey(subUser.Username)
-	return rdb.Hmset(key, m)
+	if err := rdb.Hmset(key, m); err != nil {
+		return err
+	}
+
+	return indexSubUser(context.Background(), rdb, subUser)
+}
+
+// decodeSubUserRecord convert the hash to sub user, the password is left encrypted
+func decodeSubUserRecord(data map[string]string) (*SubUser, error) {
+	subUser := &SubUser{}
+	if err := mapToStruct(data, subUser); err != nil {
+		return nil, fmt.Errorf("decode sub user %s failed:%w", data["username"], err)
+	}
+	return subUser, nil
+}
+
+// decodeSubUser convert the hash to sub user and decrypt the password
+func decodeSubUser(data map[string]string) (*SubUser, error) {
+	subUser, err := decodeSubUserRecord(data)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := decryptPassword(subUser.Username, subUser.Password, subUser.PasswordKeyID)
+	if err != nil {
+		return nil, err
+	}
+	subUser.Password = password
+	return subUser, nil
+}
+
+var ErrSubUserNotExist = errors.New("sub user not exist")
+
+// KEYS[1] sub user table, ARGV the field and value pairs
+// only update the existing sub user, so the removed one is not created again
+const updateSubUserScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HMSET', KEYS[1], unpack(ARGV))
+return 1
+`
+
+// updateSubUser set the fields of the sub user, return ErrSubUserNotExist if it is removed
+func updateSubUser(ctx context.Context, rdb *redis.Redis, username string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(fields)*2)
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	result, err := rdb.EvalCtx(ctx, updateSubUserScript, []string{subUserKey(username)}, args...)
+	if err != nil {
+		return err
+	}
+
+	if code, ok := result.(int64); !ok || code == 0 {
+		return ErrSubUserNotExist
+	}
+	return nil
+}
+
+// UpdateSubUserFields only save the named fields of the sub user, such as "status",
+// the fields changed by the background jobs meanwhile are kept
+func UpdateSubUserFields(rdb *redis.Redis, subUser *SubUser, fields ...string) error {
+	if subUser == nil || subUser.Username == "" {
+		return fmt.Errorf("empty Username")
+	}
+
+	record := *subUser
+	for _, field := range fields {
+		if field != "password" {
+			continue
+		}
+
+		password, keyID, err := encryptPassword(record.Username, record.Password)
+		if err != nil {
+			return err
+		}
+		record.Password = password
+		record.PasswordKeyID = keyID
+		fields = append(fields, "password_key_id")
+		break
+	}
+
+	m, err := structToMap(&record)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(fields))
+	reindex := false
+	for _, field := range fields {
+		value, ok := m[field]
+		if !ok {
+			return fmt.Errorf("unknown sub user field %s", field)
+		}
+		values[field] = value
+		reindex = reindex || field == "status" || field == "pop_id"
+	}
+
+	ctx := context.Background()
+	if err := updateSubUser(ctx, rdb, subUser.Username, values); err != nil {
+		return err
+	}
+
+	if !reindex {
+		return nil
+	}
+	return indexSubUserFields(ctx, rdb, subUser.Username)
+}
+
+// SetSubUserPeriod only update the traffic period, avoid overwriting other fields.
+// the notified threshold is reset for the new period
+func SetSubUserPeriod(rdb *redis.Redis, username string, anchor, startTime, endTime int64) error {
+	return updateSubUser(context.Background(), rdb, username, map[string]string{
+		"period_anchor":      fmt.Sprintf("%d", anchor),
+		"start_time":         fmt.Sprintf("%d", startTime),
+		"end_time":           fmt.Sprintf("%d", endTime),
+		"notified_threshold": "0",
+	})
+}
+
+func SetSubUserNotifiedThreshold(rdb *redis.Redis, username string, threshold int64) error {
+	return updateSubUser(context.Background(), rdb, username, map[string]string{
+		"notified_threshold": fmt.Sprintf("%d", threshold),
+	})
+}
+
+// SetSubUserStatus only update the status and reason, avoid overwriting other fields
+func SetSubUserStatus(rdb *redis.Redis, username string, status, reason string) error {
+	ctx := context.Background()
+	err := updateSubUser(ctx, rdb, username, map[string]string{
+		"status":        status,
+		"status_reason": reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return indexSubUserFields(ctx, rdb, username)
+}
+
+// SetSubUserThrottled save the throttled rate limit, the configured rate limit is not changed
+func SetSubUserThrottled(rdb *redis.Redis, username string, uploadRateLimit, downloadRateLimit int64) error {
+	return updateSubUser(context.Background(), rdb, username, map[string]string{
+		"throttled":                     "true",
+		"throttled_upload_rate_limit":   fmt.Sprintf("%d", uploadRateLimit),
+		"throttled_download_rate_limit": fmt.Sprintf("%d", downloadRateLimit),
+	})
+}
+
+// ClearSubUserThrottled mark the configured rate limit is restored
+func ClearSubUserThrottled(rdb *redis.Redis, username string) error {
+	return updateSubUser(context.Background(), rdb, username, map[string]string{
+		"throttled":                     "false",
+		"throttled_upload_rate_limit":   "0",
+		"throttled_download_rate_limit": "0",
+	})
 }
 
 func RemoveSubUser(rdb *redis.Redis, uuid, subUsername string) error {
 	key := subUserKey(subUsername)
-	_, err := rdb.Del(key)
+	popID, err := rdb.Hget(key, "pop_id")
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	if err := unindexSubUser(context.Background(), rdb, uuid, subUsername, popID); err != nil {
+		return err
+	}
+
+	_, err = rdb.Del(key)
 	if err != nil {
 		return err
 	}
@@ -73,6 +284,12 @@ func RemoveSubUser(rdb *redis.Redis, uuid, subUsername string) error {
 
 	key = deprecatedSubUserListKey(uuid)
 	_, err = rdb.Zrem(key, subUsername)
+	if err != nil {
+		return err
+	}
+
+	// forget the last seen traffic
+	_, err = rdb.Hdel(redisKeyUsageLastSeen, subUsername)
 	return err
 }
 
@@ -90,11 +307,7 @@ func GetSubUser(rdb *redis.Redis, username string) (*SubUser, error) {
 		return nil, nil
 	}
 
-	subUser := &SubUser{}
-	if err := mapToStruct(data, subUser); err != nil {
-		return nil, err
-	}
-	return subUser, nil
+	return decodeSubUser(data)
 }
 
 func AddSubUserToList(rdb *redis.Redis, uuid string, subUsername string) error {
@@ -103,6 +316,18 @@ func AddSubUserToList(rdb *redis.Redis, uuid string, subUsername string) error {
 	return err
 }
 
+func IsSubUserInList(rdb *redis.Redis, uuid string, subUsername string) (bool, error) {
+	key := subUserListKey(uuid)
+	_, err := rdb.Zscore(key, subUsername)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func GetSubUsers(ctx context.Context, rdb *redis.Redis, uuid string, start, stop int) ([]*SubUser, error) {
 	key := subUserListKey(uuid)
 	usernames, err := rdb.Zrange(key, int64(start), int64(stop))
@@ -133,14 +358,13 @@ func GetSubUsers(ctx context.Context, rdb *redis.Redis, uuid string, start, stop
 			continue
 		}
 
-		subUser := SubUser{}
-		err = mapToStruct(result, &subUser)
+		subUser, err := decodeSubUser(result)
 		if err != nil {
-			logx.Errorf("ListNode mapToStruct error:%s", err.Error())
+			logx.Errorf("ListNode decodeSubUser error:%s", err.Error())
 			continue
 		}
 
-		subUsers = append(subUsers, &subUser)
+		subUsers = append(subUsers, subUser)
 	}
 
 	return subUsers, nil
@@ -191,14 +415,13 @@ func GetDeprecatedSubUsers(ctx context.Context, rdb *redis.Redis, uuid string, s
 			continue
 		}
 
-		subUser := SubUser{}
-		err = mapToStruct(result, &subUser)
+		subUser, err := decodeSubUser(result)
 		if err != nil {
-			logx.Errorf("ListNode mapToStruct error:%s", err.Error())
+			logx.Errorf("ListNode decodeSubUser error:%s", err.Error())
 			continue
 		}
 
-		subUsers = append(subUsers, &subUser)
+		subUsers = append(subUsers, subUser)
 	}
 
 	return subUsers, nil
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/mitchellh/mapstructure"
@@ -17,3 +19,111 @@ func TestSubUser(t *testing.T) {
 	t.Logf("subUser:%v", data)
 
 }
+
+func TestUpdateSubUserFields(t *testing.T) {
+	rdb := newTestRedis(t)
+
+	subUser := &SubUser{Username: "00001_a", UserID: "u1", Status: "active", StartTime: 100, EndTime: 200}
+	if err := SaveSubUser(rdb, subUser); err != nil {
+		t.Fatal(err)
+	}
+
+	// renewed by the scheduler while the request is handling
+	if err := SetSubUserPeriod(rdb, "00001_a", 100, 200, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	subUser.Status = "stop"
+	if err := UpdateSubUserFields(rdb, subUser, "status", "status_reason"); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := GetSubUser(rdb, "00001_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != "stop" || saved.StartTime != 200 || saved.EndTime != 300 {
+		t.Fatalf("unexpected sub user %#v", saved)
+	}
+
+	if err := UpdateSubUserFields(rdb, subUser, "unknown"); err == nil {
+		t.Fatal("expect error of unknown field")
+	}
+
+	if err := RemoveSubUser(rdb, "u1", "00001_a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSubUserStatus(rdb, "00001_a", "stop", "traffic_exhausted"); !errors.Is(err, ErrSubUserNotExist) {
+		t.Fatalf("expect ErrSubUserNotExist, got %v", err)
+	}
+
+	saved, err = GetSubUser(rdb, "00001_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != nil {
+		t.Fatalf("removed sub user created again %#v", saved)
+	}
+}
+
+func TestSubUserThrottled(t *testing.T) {
+	rdb := newTestRedis(t)
+
+	if err := SaveSubUser(rdb, &SubUser{Username: "00001_a", UserID: "u1", UploadRateLimit: 100, DownloadRateLimit: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetSubUserThrottled(rdb, "00001_a", 50, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	subUser, err := GetSubUser(rdb, "00001_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, download := subUser.EffectiveRateLimit()
+	if !subUser.Throttled || upload != 50 || download != 50 || subUser.UploadRateLimit != 100 || subUser.DownloadRateLimit != 0 {
+		t.Fatalf("unexpected throttled sub user %#v", subUser)
+	}
+
+	if err := ClearSubUserThrottled(rdb, "00001_a"); err != nil {
+		t.Fatal(err)
+	}
+
+	subUser, err = GetSubUser(rdb, "00001_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, download = subUser.EffectiveRateLimit()
+	if subUser.Throttled || upload != 100 || download != 0 {
+		t.Fatalf("unexpected restored sub user %#v", subUser)
+	}
+}
+
+func TestScanSubUsersSkipBroken(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := SaveSubUser(rdb, &SubUser{Username: "sub1", UserID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.Hmset(subUserKey("sub2"), map[string]string{"user_id": "u2", "max_bandwidth_limit": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	subUsers, err := GetAllSubUsers(ctx, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subUsers) != 1 || subUsers[0].Username != "sub1" {
+		t.Fatalf("unexpected sub users %#v", subUsers)
+	}
+
+	_, broken, err := ScanSubUsers(ctx, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0].Username != "sub2" || broken[0].UserID != "u2" {
+		t.Fatalf("unexpected broken sub users %#v", broken)
+	}
+}
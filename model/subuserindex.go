@@ -0,0 +1,419 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// the sort of the sub user list
+const (
+	SubUserSortCreateTime = "create_time"
+	SubUserSortTraffic    = "traffic"
+)
+
+// the deprecated sub users leave the list, so they are not indexed
+const subUserStatusDeprecated = "deprecated"
+
+var indexedSubUserStatuses = []string{"active", "stop"}
+
+// the query result is kept shortly for the intersection
+const subUserQueryExpire = 60 * time.Second
+
+// read the list page by page to skip the sub users before the cursor
+const subUserQueryBatch = 200
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SubUserPage is a page of the query result
+type SubUserPage struct {
+	Usernames []string
+	// empty if no more sub users
+	NextCursor string
+	// count of all the matched sub users
+	Total int64
+}
+
+// SubUserQuery select the sub users in the list of a user, the empty fields are not filtered
+type SubUserQuery struct {
+	Status string
+	PopID  string
+	// prefix of the full username
+	Prefix string
+	// create_time or traffic
+	Sort string
+	Desc bool
+	// returned by the last page, empty for the first page
+	Cursor string
+	Limit  int
+}
+
+func subUserStatusIndexKey(uuid, status string) string {
+	return fmt.Sprintf(redisKeySubUserStatusZset, uuid, status)
+}
+
+func subUserPopIndexKey(uuid, popID string) string {
+	return fmt.Sprintf(redisKeySubUserPopZset, uuid, popID)
+}
+
+func subUserNameIndexKey(uuid string) string {
+	return fmt.Sprintf(redisKeySubUserNameZset, uuid)
+}
+
+func subUserTrafficIndexKey(uuid string) string {
+	return fmt.Sprintf(redisKeySubUserTrafficZset, uuid)
+}
+
+func subUserQueryKey() string {
+	return fmt.Sprintf(redisKeySubUserQuery, uuid.NewString())
+}
+
+// indexSubUser put the sub user into the status, pop, name and traffic indexes of its user,
+// the deprecated one is removed from them
+func indexSubUser(ctx context.Context, rdb *redis.Redis, subUser *SubUser) error {
+	if subUser.UserID == "" {
+		return nil
+	}
+
+	if subUser.Status == subUserStatusDeprecated {
+		return unindexSubUser(ctx, rdb, subUser.UserID, subUser.Username, subUser.PopID)
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return err
+	}
+
+	member := goredis.Z{Score: float64(subUser.CreateTime), Member: subUser.Username}
+	for _, status := range indexedSubUserStatuses {
+		if status != subUser.Status {
+			pipe.ZRem(ctx, subUserStatusIndexKey(subUser.UserID, status), subUser.Username)
+		}
+	}
+	pipe.ZAdd(ctx, subUserStatusIndexKey(subUser.UserID, subUser.Status), member)
+	pipe.ZAdd(ctx, subUserPopIndexKey(subUser.UserID, subUser.PopID), member)
+	pipe.ZAdd(ctx, subUserNameIndexKey(subUser.UserID), goredis.Z{Score: 0, Member: subUser.Username})
+	// keep the traffic recorded by the usage watcher
+	pipe.ZAddNX(ctx, subUserTrafficIndexKey(subUser.UserID), goredis.Z{Score: 0, Member: subUser.Username})
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func unindexSubUser(ctx context.Context, rdb *redis.Redis, uuid, subUsername, popID string) error {
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range indexedSubUserStatuses {
+		pipe.ZRem(ctx, subUserStatusIndexKey(uuid, status), subUsername)
+	}
+	pipe.ZRem(ctx, subUserPopIndexKey(uuid, popID), subUsername)
+	pipe.ZRem(ctx, subUserNameIndexKey(uuid), subUsername)
+	pipe.ZRem(ctx, subUserTrafficIndexKey(uuid), subUsername)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// indexSubUserFields index the sub user by the fields in redis, for the partial updates
+func indexSubUserFields(ctx context.Context, rdb *redis.Redis, username string) error {
+	values, err := rdb.HmgetCtx(ctx, subUserKey(username), "user_id", "status", "pop_id", "create_time")
+	if err != nil {
+		return err
+	}
+
+	if len(values) != 4 || values[0] == "" {
+		return nil
+	}
+
+	createTime, _ := strconv.ParseInt(values[3], 10, 64)
+	return indexSubUser(ctx, rdb, &SubUser{
+		Username:   username,
+		UserID:     values[0],
+		Status:     values[1],
+		PopID:      values[2],
+		CreateTime: createTime,
+	})
+}
+
+// setSubUserTrafficIndex update the traffic used of the indexed sub user
+func setSubUserTrafficIndex(ctx context.Context, rdb *redis.Redis, uuid, subUsername string, total int64) error {
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return err
+	}
+
+	pipe.ZAddXX(ctx, subUserTrafficIndexKey(uuid), goredis.Z{Score: float64(total), Member: subUsername})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RebuildSubUserIndex index all the sub users in the list of the user again
+func RebuildSubUserIndex(ctx context.Context, rdb *redis.Redis, uuid string) error {
+	subUsers, err := GetSubUsers(ctx, rdb, uuid, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, subUser := range subUsers {
+		if err := indexSubUser(ctx, rdb, subUser); err != nil {
+			return err
+		}
+
+		total, err := rdb.HgetCtx(ctx, redisKeyUsageLastSeen, subUser.Username)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if used, _ := strconv.ParseInt(total, 10, 64); used > 0 {
+			if err := setSubUserTrafficIndex(ctx, rdb, uuid, subUser.Username, used); err != nil {
+				return err
+			}
+		}
+	}
+
+	return rdb.SetCtx(ctx, fmt.Sprintf(redisKeySubUserIndexed, uuid), strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// ensureSubUserIndex build the index of the users created before the index support
+func ensureSubUserIndex(ctx context.Context, rdb *redis.Redis, uuid string) error {
+	ok, err := rdb.ExistsCtx(ctx, fmt.Sprintf(redisKeySubUserIndexed, uuid))
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return nil
+	}
+	return RebuildSubUserIndex(ctx, rdb, uuid)
+}
+
+// QuerySubUsers return a page of the usernames of the sub users matched the query
+func QuerySubUsers(ctx context.Context, rdb *redis.Redis, uuid string, query *SubUserQuery) (*SubUserPage, error) {
+	if uuid == "" {
+		return nil, fmt.Errorf("empty uuid")
+	}
+
+	if query.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	if query.Sort != "" && query.Sort != SubUserSortCreateTime && query.Sort != SubUserSortTraffic {
+		return nil, fmt.Errorf("unsupported sort %s", query.Sort)
+	}
+
+	if err := ensureSubUserIndex(ctx, rdb, uuid); err != nil {
+		return nil, err
+	}
+
+	key, temps, err := buildSubUserQuery(ctx, rdb, uuid, query)
+	if len(temps) > 0 {
+		defer rdb.DelCtx(context.WithoutCancel(ctx), temps...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return &SubUserPage{Usernames: []string{}}, nil
+	}
+
+	page, err := pageSubUsers(ctx, rdb, key, query)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := rdb.ZcardCtx(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	page.Total = int64(total)
+	return page, nil
+}
+
+// buildSubUserQuery return the zset of the matched sub users scored by the sort,
+// the temporary keys should be deleted after use
+func buildSubUserQuery(ctx context.Context, rdb *redis.Redis, uuid string, query *SubUserQuery) (string, []string, error) {
+	listKey := subUserListKey(uuid)
+	keys := []string{listKey}
+	weights := []float64{1}
+	if query.Sort == SubUserSortTraffic {
+		keys = []string{subUserTrafficIndexKey(uuid), listKey}
+		weights = []float64{1, 0}
+	}
+
+	if query.Status != "" {
+		keys = append(keys, subUserStatusIndexKey(uuid, query.Status))
+		weights = append(weights, 0)
+	}
+
+	if query.PopID != "" {
+		keys = append(keys, subUserPopIndexKey(uuid, query.PopID))
+		weights = append(weights, 0)
+	}
+
+	temps := make([]string, 0, 2)
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if query.Prefix != "" {
+		cmd := pipe.ZRangeByLex(ctx, subUserNameIndexKey(uuid), &goredis.ZRangeBy{
+			Min: "[" + query.Prefix,
+			Max: "[" + query.Prefix + "\xff",
+		})
+		if _, err := pipe.Exec(ctx); err != nil {
+			return "", nil, err
+		}
+
+		names := cmd.Val()
+		if len(names) == 0 {
+			return "", nil, nil
+		}
+
+		searchKey := subUserQueryKey()
+		temps = append(temps, searchKey)
+		members := make([]goredis.Z, 0, len(names))
+		for _, name := range names {
+			members = append(members, goredis.Z{Score: 0, Member: name})
+		}
+		pipe.ZAdd(ctx, searchKey, members...)
+		pipe.Expire(ctx, searchKey, subUserQueryExpire)
+
+		keys = append(keys, searchKey)
+		weights = append(weights, 0)
+	}
+
+	if len(keys) == 1 {
+		return listKey, temps, nil
+	}
+
+	dest := subUserQueryKey()
+	temps = append(temps, dest)
+	pipe.ZInterStore(ctx, dest, &goredis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"})
+	pipe.Expire(ctx, dest, subUserQueryExpire)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", temps, err
+	}
+	return dest, temps, nil
+}
+
+// pageSubUsers read the zset from the cursor, the sub users with the same score are ordered by name,
+// so the cursor stay stable while the new sub users are added
+func pageSubUsers(ctx context.Context, rdb *redis.Redis, key string, query *SubUserQuery) (*SubUserPage, error) {
+	hasCursor := query.Cursor != ""
+	var cursorScore int64
+	var cursorName string
+	if hasCursor {
+		var err error
+		if cursorScore, cursorName, err = parseSubUserCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	rangeBy := &goredis.ZRangeBy{Min: "-inf", Max: "+inf", Count: subUserQueryBatch}
+	if hasCursor && query.Desc {
+		rangeBy.Max = strconv.FormatInt(cursorScore, 10)
+	} else if hasCursor {
+		rangeBy.Min = strconv.FormatInt(cursorScore, 10)
+	}
+
+	// one more to know if there is a next page
+	matched := make([]goredis.Z, 0, query.Limit+1)
+	for len(matched) <= query.Limit {
+		pipe, err := rdb.TxPipeline()
+		if err != nil {
+			return nil, err
+		}
+
+		var cmd *goredis.ZSliceCmd
+		if query.Desc {
+			cmd = pipe.ZRevRangeByScoreWithScores(ctx, key, rangeBy)
+		} else {
+			cmd = pipe.ZRangeByScoreWithScores(ctx, key, rangeBy)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+
+		zs := cmd.Val()
+		for _, z := range zs {
+			name, _ := z.Member.(string)
+			if hasCursor && !afterSubUserCursor(int64(z.Score), name, cursorScore, cursorName, query.Desc) {
+				continue
+			}
+			matched = append(matched, z)
+			if len(matched) > query.Limit {
+				break
+			}
+		}
+
+		if len(zs) < subUserQueryBatch {
+			break
+		}
+		rangeBy.Offset += int64(len(zs))
+	}
+
+	next := ""
+	if len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+		last := matched[len(matched)-1]
+		next = fmt.Sprintf("%d:%s", int64(last.Score), last.Member)
+	}
+
+	usernames := make([]string, 0, len(matched))
+	for _, z := range matched {
+		name, _ := z.Member.(string)
+		usernames = append(usernames, name)
+	}
+	return &SubUserPage{Usernames: usernames, NextCursor: next}, nil
+}
+
+func afterSubUserCursor(score int64, name string, cursorScore int64, cursorName string, desc bool) bool {
+	if desc {
+		return score < cursorScore || (score == cursorScore && name < cursorName)
+	}
+	return score > cursorScore || (score == cursorScore && name > cursorName)
+}
+
+func parseSubUserCursor(cursor string) (int64, string, error) {
+	score, name, ok := strings.Cut(cursor, ":")
+	if !ok || name == "" {
+		return 0, "", ErrInvalidCursor
+	}
+
+	n, err := strconv.ParseInt(score, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return n, name, nil
+}
+
+// GetSubUsersByName return the sub users in the order of the usernames, the missing and broken ones are skipped
+func GetSubUsersByName(ctx context.Context, rdb *redis.Redis, usernames []string) ([]*SubUser, error) {
+	tables, err := getHashes(ctx, rdb, usernames, subUserKey)
+	if err != nil {
+		return nil, err
+	}
+
+	subUsers := make([]*SubUser, 0, len(tables))
+	for _, table := range tables {
+		subUser, err := decodeSubUser(table)
+		if err != nil {
+			logx.Errorf("GetSubUsersByName decodeSubUser error:%s", err.Error())
+			continue
+		}
+		subUsers = append(subUsers, subUser)
+	}
+	return subUsers, nil
+}
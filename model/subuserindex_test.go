@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestQuerySubUsers(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	add := func(name, status, pop string) {
+		t.Helper()
+		subUser := &SubUser{Username: name, UserID: "u1", Status: status, PopID: pop, CreateTime: 100}
+		if err := SaveSubUser(rdb, subUser); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddSubUserToList(rdb, "u1", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i <= 5; i++ {
+		status := "active"
+		if i%2 == 0 {
+			status = "stop"
+		}
+		add(fmt.Sprintf("00001_a%d", i), status, "pop1")
+	}
+	add("00001_b1", "active", "pop2")
+
+	query := func(q *SubUserQuery) ([]string, string) {
+		t.Helper()
+		page, err := QuerySubUsers(ctx, rdb, "u1", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Usernames, page.NextCursor
+	}
+
+	names, _ := query(&SubUserQuery{Status: "stop", Limit: 10})
+	if !reflect.DeepEqual(names, []string{"00001_a2", "00001_a4"}) {
+		t.Fatalf("unexpected stop sub users %v", names)
+	}
+
+	names, _ = query(&SubUserQuery{PopID: "pop2", Limit: 10})
+	if !reflect.DeepEqual(names, []string{"00001_b1"}) {
+		t.Fatalf("unexpected pop2 sub users %v", names)
+	}
+
+	names, _ = query(&SubUserQuery{Prefix: "00001_a", Status: "active", Limit: 10})
+	if !reflect.DeepEqual(names, []string{"00001_a1", "00001_a3", "00001_a5"}) {
+		t.Fatalf("unexpected search result %v", names)
+	}
+
+	// the sub users created in the same second are paged by name
+	names, next := query(&SubUserQuery{Limit: 4})
+	if len(names) != 4 || next == "" {
+		t.Fatalf("unexpected first page %v %s", names, next)
+	}
+
+	add("00001_c1", "active", "pop1")
+	names, next = query(&SubUserQuery{Limit: 4, Cursor: next})
+	if !reflect.DeepEqual(names, []string{"00001_a5", "00001_b1", "00001_c1"}) || next != "" {
+		t.Fatalf("unexpected second page %v %s", names, next)
+	}
+
+	// status changed by the workers
+	if err := SetSubUserStatus(rdb, "00001_a1", "stop", "traffic_exhausted"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = query(&SubUserQuery{Status: "stop", Limit: 10})
+	if !reflect.DeepEqual(names, []string{"00001_a1", "00001_a2", "00001_a4"}) {
+		t.Fatalf("unexpected stop sub users after status changed %v", names)
+	}
+
+	if _, err := RecordSubUserTraffic(ctx, rdb, "u1", "00001_a3", 300); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecordSubUserTraffic(ctx, rdb, "u1", "00001_b1", 200); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = query(&SubUserQuery{Sort: SubUserSortTraffic, Desc: true, Limit: 2})
+	if !reflect.DeepEqual(names, []string{"00001_a3", "00001_b1"}) {
+		t.Fatalf("unexpected sort by traffic %v", names)
+	}
+
+	if err := RemoveSubUser(rdb, "u1", "00001_b1"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = query(&SubUserQuery{PopID: "pop2", Limit: 10})
+	if len(names) != 0 {
+		t.Fatalf("removed sub user still indexed %v", names)
+	}
+}
+
+func TestRebuildSubUserIndex(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// the sub user saved before the index support
+	if err := rdb.Hmset(subUserKey("00001_old"), map[string]string{
+		"username": "00001_old", "user_id": "u1", "status": "active", "pop_id": "pop1", "create_time": "100",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddSubUserToList(rdb, "u1", "00001_old"); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := QuerySubUsers(ctx, rdb, "u1", &SubUserQuery{PopID: "pop1", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page.Usernames, []string{"00001_old"}) || page.Total != 1 {
+		t.Fatalf("unexpected page %#v", page)
+	}
+}
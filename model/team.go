@@ -0,0 +1,295 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	// create and delete the team, invite and remove members
+	TeamRoleOwner = "owner"
+	// manage the sub users of the team
+	TeamRoleMember = "member"
+	// read only
+	TeamRoleViewer = "viewer"
+)
+
+// the team share the quota and sub users of the owner's account
+type Team struct {
+	ID         string `redis:"id"`
+	Name       string `redis:"name"`
+	OwnerID    string `redis:"owner_id"`
+	CreateTime int64  `redis:"create_time"`
+}
+
+// Membership of a user, a user join one team at most
+type Membership struct {
+	TeamID string `redis:"team_id"`
+	// the account shared by the team, it is the owner id
+	AccountID string `redis:"account_id"`
+	UserID    string `redis:"user_id"`
+	Email     string `redis:"email"`
+	Role      string `redis:"role"`
+	JoinTime  int64  `redis:"join_time"`
+}
+
+type TeamInvite struct {
+	TeamID     string `redis:"team_id"`
+	Email      string `redis:"email"`
+	Role       string `redis:"role"`
+	InviterID  string `redis:"inviter_id"`
+	CreateTime int64  `redis:"create_time"`
+	ExpireTime int64  `redis:"expire_time"`
+}
+
+func IsValidTeamRole(role string) bool {
+	return role == TeamRoleOwner || role == TeamRoleMember || role == TeamRoleViewer
+}
+
+func teamKey(id string) string {
+	return fmt.Sprintf(redisKeyTeamTable, id)
+}
+
+func teamMemberListKey(id string) string {
+	return fmt.Sprintf(redisKeyTeamMemberZset, id)
+}
+
+func membershipKey(uuid string) string {
+	return fmt.Sprintf(redisKeyMembershipTable, uuid)
+}
+
+func teamInviteKey(id, email string) string {
+	return fmt.Sprintf(redisKeyTeamInviteTable, id, email)
+}
+
+func teamInviteListKey(id string) string {
+	return fmt.Sprintf(redisKeyTeamInviteZset, id)
+}
+
+// AddTeam create the team and the owner membership
+func AddTeam(rdb *redis.Redis, team *Team, ownerEmail string) error {
+	if team.ID == "" || team.OwnerID == "" {
+		return fmt.Errorf("empty team id or owner id")
+	}
+
+	m, err := structToMap(team)
+	if err != nil {
+		return err
+	}
+
+	if err := rdb.Hmset(teamKey(team.ID), m); err != nil {
+		return err
+	}
+
+	return AddMembership(rdb, &Membership{
+		TeamID:    team.ID,
+		AccountID: team.OwnerID,
+		UserID:    team.OwnerID,
+		Email:     ownerEmail,
+		Role:      TeamRoleOwner,
+		JoinTime:  team.CreateTime,
+	})
+}
+
+func GetTeam(rdb *redis.Redis, id string) (*Team, error) {
+	data, err := rdb.Hgetall(teamKey(id))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	team := &Team{}
+	if err := mapToStruct(data, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// RemoveTeam delete the team, its members and invitations
+func RemoveTeam(ctx context.Context, rdb *redis.Redis, id string) error {
+	members, err := rdb.ZrangeCtx(ctx, teamMemberListKey(id), 0, -1)
+	if err != nil {
+		return err
+	}
+
+	emails, err := rdb.ZrangeCtx(ctx, teamInviteListKey(id), 0, -1)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{teamKey(id), teamMemberListKey(id), teamInviteListKey(id)}
+	for _, member := range members {
+		keys = append(keys, membershipKey(member))
+	}
+	for _, email := range emails {
+		keys = append(keys, teamInviteKey(id, email))
+	}
+
+	_, err = rdb.DelCtx(ctx, keys...)
+	return err
+}
+
+func AddMembership(rdb *redis.Redis, membership *Membership) error {
+	m, err := structToMap(membership)
+	if err != nil {
+		return err
+	}
+
+	if err := rdb.Hmset(membershipKey(membership.UserID), m); err != nil {
+		return err
+	}
+
+	_, err = rdb.Zadd(teamMemberListKey(membership.TeamID), membership.JoinTime, membership.UserID)
+	return err
+}
+
+// GetMembership return nil if the user not in any team
+func GetMembership(rdb *redis.Redis, uuid string) (*Membership, error) {
+	data, err := rdb.Hgetall(membershipKey(uuid))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	membership := &Membership{}
+	if err := mapToStruct(data, membership); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+func SetMembershipRole(rdb *redis.Redis, uuid, role string) error {
+	return rdb.Hset(membershipKey(uuid), "role", role)
+}
+
+func RemoveMembership(rdb *redis.Redis, teamID, uuid string) error {
+	if _, err := rdb.Del(membershipKey(uuid)); err != nil {
+		return err
+	}
+
+	_, err := rdb.Zrem(teamMemberListKey(teamID), uuid)
+	return err
+}
+
+func GetTeamMembers(ctx context.Context, rdb *redis.Redis, id string) ([]*Membership, error) {
+	uuids, err := rdb.ZrangeCtx(ctx, teamMemberListKey(id), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := getHashes(ctx, rdb, uuids, membershipKey)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*Membership, 0, len(tables))
+	for _, table := range tables {
+		member := &Membership{}
+		if err := mapToStruct(table, member); err != nil {
+			logx.Errorf("GetTeamMembers mapToStruct error:%s", err.Error())
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func TeamMemberCount(rdb *redis.Redis, id string) (int, error) {
+	return rdb.Zcard(teamMemberListKey(id))
+}
+
+// SaveTeamInvite overwrite the previous invitation of the email, it expire at ExpireTime
+func SaveTeamInvite(rdb *redis.Redis, invite *TeamInvite) error {
+	m, err := structToMap(invite)
+	if err != nil {
+		return err
+	}
+
+	key := teamInviteKey(invite.TeamID, invite.Email)
+	if err := rdb.Hmset(key, m); err != nil {
+		return err
+	}
+
+	if err := rdb.Expireat(key, invite.ExpireTime); err != nil {
+		return err
+	}
+
+	_, err = rdb.Zadd(teamInviteListKey(invite.TeamID), invite.ExpireTime, invite.Email)
+	return err
+}
+
+// GetTeamInvite return nil if not invited or expired
+func GetTeamInvite(rdb *redis.Redis, id, email string) (*TeamInvite, error) {
+	data, err := rdb.Hgetall(teamInviteKey(id, email))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	invite := &TeamInvite{}
+	if err := mapToStruct(data, invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// GetTeamInvites return the pending invitations, the expired are cleaned
+func GetTeamInvites(ctx context.Context, rdb *redis.Redis, id string) ([]*TeamInvite, error) {
+	key := teamInviteListKey(id)
+	if _, err := rdb.ZremrangebyscoreCtx(ctx, key, 0, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+
+	emails, err := rdb.ZrangeCtx(ctx, key, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := getHashes(ctx, rdb, emails, func(email string) string { return teamInviteKey(id, email) })
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]*TeamInvite, 0, len(tables))
+	for _, table := range tables {
+		invite := &TeamInvite{}
+		if err := mapToStruct(table, invite); err != nil {
+			logx.Errorf("GetTeamInvites mapToStruct error:%s", err.Error())
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+func RemoveTeamInvite(rdb *redis.Redis, id, email string) error {
+	if _, err := rdb.Del(teamInviteKey(id, email)); err != nil {
+		return err
+	}
+
+	_, err := rdb.Zrem(teamInviteListKey(id), email)
+	return err
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRemoveTeam(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	team := &Team{ID: "t1", Name: "dev", OwnerID: "u1", CreateTime: time.Now().Unix()}
+	if err := AddTeam(rdb, team, "u1@a.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	member := &Membership{TeamID: "t1", AccountID: "u1", UserID: "u2", Email: "u2@a.com", Role: TeamRoleMember}
+	if err := AddMembership(rdb, member); err != nil {
+		t.Fatal(err)
+	}
+
+	invite := &TeamInvite{TeamID: "t1", Email: "u3@a.com", Role: TeamRoleViewer, ExpireTime: time.Now().Unix() + 60}
+	if err := SaveTeamInvite(rdb, invite); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetMembership(rdb, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.AccountID != "u1" || got.Role != TeamRoleMember {
+		t.Fatalf("unexpected membership %#v", got)
+	}
+
+	if invites, _ := GetTeamInvites(ctx, rdb, "t1"); len(invites) != 1 {
+		t.Fatalf("expect 1 invite, got %d", len(invites))
+	}
+
+	if err := RemoveTeam(ctx, rdb, "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uuid := range []string{"u1", "u2"} {
+		if got, _ := GetMembership(rdb, uuid); got != nil {
+			t.Fatalf("membership of %s not removed", uuid)
+		}
+	}
+	if got, _ := GetTeamInvite(rdb, "t1", "u3@a.com"); got != nil {
+		t.Fatal("invite not removed")
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// KEYS[1] last seen traffic hash, KEYS[2] user table
+// ARGV[1] sub username, ARGV[2] traffic used reported by ippm server
+// the traffic used is reset at the start of sub user period, count it all as new
+const recordTrafficScript = `
+local last = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local total = tonumber(ARGV[2])
+local delta = total - last
+if delta < 0 then
+	delta = total
+end
+
+redis.call('HSET', KEYS[1], ARGV[1], total)
+if delta > 0 and redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('HINCRBY', KEYS[2], 'traffic_consumed', delta)
+end
+return delta
+`
+
+// RecordSubUserTraffic add the traffic consumed since last record to the user, return the delta
+func RecordSubUserTraffic(ctx context.Context, rdb *redis.Redis, uuid, subUsername string, total int64) (int64, error) {
+	if uuid == "" {
+		return 0, fmt.Errorf("empty uuid")
+	}
+
+	result, err := rdb.EvalCtx(ctx, recordTrafficScript, []string{redisKeyUsageLastSeen, userKey(uuid)}, subUsername, total)
+	if err != nil {
+		return 0, err
+	}
+
+	delta, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected record traffic result %v", result)
+	}
+
+	// for sorting the sub user list by traffic used
+	if err := setSubUserTrafficIndex(ctx, rdb, uuid, subUsername, total); err != nil {
+		return 0, err
+	}
+	return delta, nil
+}
+
+// ResetBillingPeriod start a new billing period of user, the consumed traffic is cleared
+func ResetBillingPeriod(rdb *redis.Redis, uuid string, anchor, start, end int64) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	key := userKey(uuid)
+	return rdb.Hmset(key, map[string]string{
+		"traffic_consumed": "0",
+		"billing_anchor":   fmt.Sprintf("%d", anchor),
+		"billing_start":    fmt.Sprintf("%d", start),
+		"billing_end":      fmt.Sprintf("%d", end),
+	})
+}
+
+func SetUserSuspended(rdb *redis.Redis, uuid string, suspended bool) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	key := userKey(uuid)
+	return rdb.Hset(key, "suspended", fmt.Sprintf("%t", suspended))
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecordSubUserTraffic(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	if err := SaveUser(rdb, &User{UUID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the third record is after the sub user period reset
+	for _, total := range []int64{100, 250, 30} {
+		if _, err := RecordSubUserTraffic(ctx, rdb, "u1", "sub1", total); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := RecordSubUserTraffic(ctx, rdb, "u1", "sub2", 20); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := GetUser(rdb, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TrafficConsumed != 300 {
+		t.Fatalf("expect consumed 300, got %d", user.TrafficConsumed)
+	}
+
+	if err := ResetBillingPeriod(rdb, "u1", 1, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ = GetUser(rdb, "u1"); user.TrafficConsumed != 0 || user.BillingAnchor != 1 || user.BillingEnd != 2 {
+		t.Fatalf("unexpected user after reset %#v", user)
+	}
+}
@@ -15,12 +15,28 @@ type User struct {
 	MaxBandwidthAllocated int64  `redis:"max_bandwidth_allocated"`
 	TotalTrafficLimit     int64  `redis:"total_traffic_limit"`
 	TotalTrafficAllocated int64  `redis:"total_traffic_allocated"`
+	// ceiling of the rate limit of each sub user
+	MaxUploadRateLimit   int64 `redis:"max_upload_rate_limit"`
+	MaxDownloadRateLimit int64 `redis:"max_download_rate_limit"`
+	// traffic consumed by all sub users in the billing period
+	TrafficConsumed int64 `redis:"traffic_consumed"`
+	BillingStart    int64 `redis:"billing_start"`
+	BillingEnd      int64 `redis:"billing_end"`
+	// begin of the first billing period, the periods end at its day
+	BillingAnchor int64 `redis:"billing_anchor"`
+	// all sub users are stopped for the consumed traffic reach TotalTrafficLimit
+	Suspended bool `redis:"suspended"`
+	// all sub users are stopped by the admin
+	Frozen bool `redis:"frozen"`
+	// role from the user server at the last login, empty if not logged in since recorded
+	Role string `redis:"role"`
 }
 
 func userKey(uuid string) string {
 	return fmt.Sprintf(redisKeyUserTable, uuid)
 }
 
+// SaveUser overwrite all fields of user, use AdjustQuota to change the allocated quota
 func SaveUser(rdb *redis.Redis, user *User) error {
 	if user == nil {
 		return fmt.Errorf("user is nil")
@@ -74,3 +90,20 @@ func GetAllSubUsername(rdb *redis.Redis, uuid string) ([]string, error) {
 	}
 	return usernames, nil
 }
+
+func SetUserFrozen(rdb *redis.Redis, uuid string, frozen bool) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	return rdb.Hset(userKey(uuid), "frozen", fmt.Sprintf("%t", frozen))
+}
+
+// SetUserRole record the role from the user server, the api keys take the role from here
+func SetUserRole(rdb *redis.Redis, uuid, role string) error {
+	if uuid == "" {
+		return fmt.Errorf("empty uuid")
+	}
+
+	return rdb.Hset(userKey(uuid), "role", role)
+}
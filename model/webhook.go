@@ -0,0 +1,349 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+
+	// keep the last deliveries of each webhook
+	maxDeliveryLog = 100
+	// deliveries expire 7 days after the last save, the pending ones are saved on each attempt
+	deliveryExpire = 7 * 24 * 60 * 60
+)
+
+type Webhook struct {
+	ID     string `redis:"id"`
+	UserID string `redis:"user_id"`
+	URL    string `redis:"url"`
+	// key of the HMAC signature
+	Secret string `redis:"secret"`
+	// comma separated event types, empty means all
+	Events     string `redis:"events"`
+	CreateTime int64  `redis:"create_time"`
+}
+
+// Subscribed return true if the webhook want the event type
+func (w *Webhook) Subscribed(eventType string) bool {
+	if w.Events == "" {
+		return true
+	}
+
+	for _, e := range strings.Split(w.Events, ",") {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID        string `redis:"id"`
+	WebhookID string `redis:"webhook_id"`
+	EventType string `redis:"event_type"`
+	// the json body to post
+	Payload      string `redis:"payload"`
+	Status       string `redis:"status"`
+	Attempts     int64  `redis:"attempts"`
+	ResponseCode int64  `redis:"response_code"`
+	LastError    string `redis:"last_error"`
+	CreateTime   int64  `redis:"create_time"`
+	// time of the next attempt
+	NextTime int64 `redis:"next_time"`
+}
+
+func webhookKey(id string) string {
+	return fmt.Sprintf(redisKeyWebhookTable, id)
+}
+
+func userWebhookListKey(uuid string) string {
+	return fmt.Sprintf(redisKeyUserWebhookZset, uuid)
+}
+
+func webhookDeliveryKey(id string) string {
+	return fmt.Sprintf(redisKeyWebhookDeliveryTable, id)
+}
+
+func webhookDeliveryListKey(webhookID string) string {
+	return fmt.Sprintf(redisKeyWebhookDeliveryList, webhookID)
+}
+
+func AddWebhook(rdb *redis.Redis, webhook *Webhook) error {
+	if webhook.ID == "" || webhook.UserID == "" {
+		return fmt.Errorf("empty webhook id or user id")
+	}
+
+	m, err := structToMap(webhook)
+	if err != nil {
+		return err
+	}
+
+	if err := rdb.Hmset(webhookKey(webhook.ID), m); err != nil {
+		return err
+	}
+
+	_, err = rdb.Zadd(userWebhookListKey(webhook.UserID), webhook.CreateTime, webhook.ID)
+	return err
+}
+
+func GetWebhook(rdb *redis.Redis, id string) (*Webhook, error) {
+	data, err := rdb.Hgetall(webhookKey(id))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	webhook := &Webhook{}
+	if err := mapToStruct(data, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func GetUserWebhooks(ctx context.Context, rdb *redis.Redis, uuid string) ([]*Webhook, error) {
+	ids, err := rdb.ZrangeCtx(ctx, userWebhookListKey(uuid), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := getHashes(ctx, rdb, ids, webhookKey)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*Webhook, 0, len(tables))
+	for _, table := range tables {
+		webhook := &Webhook{}
+		if err := mapToStruct(table, webhook); err != nil {
+			logx.Errorf("GetUserWebhooks mapToStruct error:%s", err.Error())
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func WebhookCount(rdb *redis.Redis, uuid string) (int, error) {
+	return rdb.Zcard(userWebhookListKey(uuid))
+}
+
+// RemoveWebhook delete the webhook and its deliveries, the queued ones are removed from the queue
+func RemoveWebhook(rdb *redis.Redis, uuid, id string) error {
+	ids, err := rdb.Lrange(webhookDeliveryListKey(id), 0, -1)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		members := make([]any, 0, len(ids))
+		keys := make([]string, 0, len(ids))
+		for _, deliveryID := range ids {
+			members = append(members, deliveryID)
+			keys = append(keys, webhookDeliveryKey(deliveryID))
+		}
+
+		if _, err := rdb.Zrem(redisKeyWebhookDeliveryZset, members...); err != nil {
+			return err
+		}
+		if _, err := rdb.Del(keys...); err != nil {
+			return err
+		}
+	}
+
+	if _, err := rdb.Del(webhookKey(id), webhookDeliveryListKey(id)); err != nil {
+		return err
+	}
+
+	_, err = rdb.Zrem(userWebhookListKey(uuid), id)
+	return err
+}
+
+// EnqueueDelivery save the delivery and queue it to send at NextTime
+func EnqueueDelivery(rdb *redis.Redis, delivery *WebhookDelivery) error {
+	if err := SaveDelivery(rdb, delivery); err != nil {
+		return err
+	}
+
+	listKey := webhookDeliveryListKey(delivery.WebhookID)
+	if _, err := rdb.Lpush(listKey, delivery.ID); err != nil {
+		return err
+	}
+
+	if err := rdb.Ltrim(listKey, 0, maxDeliveryLog-1); err != nil {
+		return err
+	}
+
+	return ScheduleDelivery(rdb, delivery.ID, delivery.NextTime)
+}
+
+func SaveDelivery(rdb *redis.Redis, delivery *WebhookDelivery) error {
+	m, err := structToMap(delivery)
+	if err != nil {
+		return err
+	}
+
+	key := webhookDeliveryKey(delivery.ID)
+	if err := rdb.Hmset(key, m); err != nil {
+		return err
+	}
+
+	// the pending one lost by a crash expire too
+	return rdb.Expire(key, deliveryExpire)
+}
+
+// FinishDelivery save the delivery succeeded or failed, and remove it from the queue
+func FinishDelivery(rdb *redis.Redis, delivery *WebhookDelivery) error {
+	if err := SaveDelivery(rdb, delivery); err != nil {
+		return err
+	}
+
+	_, err := rdb.Zrem(redisKeyWebhookDeliveryZset, delivery.ID)
+	return err
+}
+
+func ScheduleDelivery(rdb *redis.Redis, id string, next int64) error {
+	_, err := rdb.Zadd(redisKeyWebhookDeliveryZset, next, id)
+	return err
+}
+
+func GetDelivery(rdb *redis.Redis, id string) (*WebhookDelivery, error) {
+	data, err := rdb.Hgetall(webhookDeliveryKey(id))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	delivery := &WebhookDelivery{}
+	if err := mapToStruct(data, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// KEYS[1] the delivery queue
+// ARGV[1] now, ARGV[2] the lease time, ARGV[3] limit
+// the claimed deliveries stay in the queue and due again when the lease time passed
+const claimDeliveriesScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], 0, ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + tonumber(ARGV[2]), id)
+end
+return ids
+`
+
+// ClaimDueDeliveries lease the due deliveries for lease seconds and return them, only one instance can claim a delivery.
+// the claimed one must be finished or scheduled again, otherwise it is sent again after the lease
+func ClaimDueDeliveries(ctx context.Context, rdb *redis.Redis, limit int, lease int64) ([]*WebhookDelivery, error) {
+	result, err := rdb.EvalCtx(ctx, claimDeliveriesScript, []string{redisKeyWebhookDeliveryZset}, time.Now().Unix(), lease, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, ok := result.([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claim deliveries result %v", result)
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(ids))
+	for _, v := range ids {
+		id, _ := v.(string)
+		delivery, err := GetDelivery(rdb, id)
+		if err != nil {
+			logx.Errorf("get delivery %s failed:%v", id, err)
+			continue
+		}
+
+		// expired or removed with the webhook
+		if delivery == nil {
+			if _, err := rdb.ZremCtx(ctx, redisKeyWebhookDeliveryZset, id); err != nil {
+				logx.Errorf("remove delivery %s from queue failed:%v", id, err)
+			}
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDeliveries return the latest deliveries of webhook
+func GetWebhookDeliveries(ctx context.Context, rdb *redis.Redis, webhookID string, start, stop int) ([]*WebhookDelivery, error) {
+	ids, err := rdb.LrangeCtx(ctx, webhookDeliveryListKey(webhookID), start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := getHashes(ctx, rdb, ids, webhookDeliveryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(tables))
+	for _, table := range tables {
+		delivery := &WebhookDelivery{}
+		if err := mapToStruct(table, delivery); err != nil {
+			logx.Errorf("GetWebhookDeliveries mapToStruct error:%s", err.Error())
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// getHashes return the hash tables of ids in order, the missing ones are skipped
+func getHashes(ctx context.Context, rdb *redis.Redis, ids []string, keyFunc func(string) string) ([]map[string]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	pipe, err := rdb.TxPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		pipe.HGetAll(ctx, keyFunc(id))
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]map[string]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		result, err := cmd.(*goredis.MapStringStringCmd).Result()
+		if err != nil {
+			logx.Errorf("getHashes parse result failed:%s", err.Error())
+			continue
+		}
+
+		if len(result) == 0 {
+			continue
+		}
+		tables = append(tables, result)
+	}
+	return tables, nil
+}
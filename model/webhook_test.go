@@ -0,0 +1,79 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClaimDueDeliveries(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	for _, d := range []*WebhookDelivery{
+		{ID: "d1", WebhookID: "w1", Status: DeliveryPending, NextTime: now},
+		{ID: "d2", WebhookID: "w1", Status: DeliveryPending, NextTime: now + 3600},
+	} {
+		if err := EnqueueDelivery(rdb, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the lease passed at once, as the instance crashed after claimed
+	deliveries, err := ClaimDueDeliveries(ctx, rdb, 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != "d1" {
+		t.Fatalf("expect only d1 due, got %#v", deliveries)
+	}
+
+	if deliveries, _ = ClaimDueDeliveries(ctx, rdb, 10, 60); len(deliveries) != 1 {
+		t.Fatalf("expect d1 due again after the lease, got %d", len(deliveries))
+	}
+
+	// claimed delivery can not be claimed again in the lease
+	if deliveries, _ = ClaimDueDeliveries(ctx, rdb, 10, 60); len(deliveries) != 0 {
+		t.Fatalf("expect no delivery, got %d", len(deliveries))
+	}
+
+	d1 := &WebhookDelivery{ID: "d1", WebhookID: "w1", Status: DeliverySuccess}
+	if err := FinishDelivery(rdb, d1); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rdb.Zcard(redisKeyWebhookDeliveryZset); n != 1 {
+		t.Fatalf("expect only d2 queued, got %d", n)
+	}
+
+	log, err := GetWebhookDeliveries(ctx, rdb, "w1", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].ID != "d2" {
+		t.Fatalf("unexpected delivery log %#v", log)
+	}
+
+	// the queued deliveries removed with the webhook
+	if err := RemoveWebhook(rdb, "u1", "w1"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rdb.Zcard(redisKeyWebhookDeliveryZset); n != 0 {
+		t.Fatalf("expect empty queue, got %d", n)
+	}
+	if d, _ := GetDelivery(rdb, "d2"); d != nil {
+		t.Fatal("delivery d2 should be removed")
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	w := &Webhook{}
+	if !w.Subscribed("sub_user.created") {
+		t.Fatal("empty events should subscribe all")
+	}
+
+	w.Events = "sub_user.created,sub_user.deleted"
+	if !w.Subscribed("sub_user.deleted") || w.Subscribed("sub_user.stopped") {
+		t.Fatal("unexpected subscribed result")
+	}
+}